@@ -16,8 +16,10 @@ import (
 	dbPkg "im-system/pkg/db"
 	"im-system/pkg/jwt"
 	"im-system/pkg/logger"
+	"im-system/pkg/mail"
 	"im-system/pkg/redis"
 	"im-system/pkg/response"
+	"im-system/pkg/storage"
 	"im-system/pkg/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -66,27 +68,96 @@ func main() {
 	}()
 	log.Info("Redis连接成功")
 
-	// 3.3 初始化Redis缓存配置
+	// 3.3 启用跨节点消息路由（多实例部署时通过Redis转发消息）
+	nodeID := cfg.Server.NodeID
+	if nodeID == "" {
+		hostname, _ := os.Hostname()
+		nodeID = hostname + ":" + cfg.Server.Port
+	}
+	if err := websocket.GetManager().EnableCluster(redis.GetClient(), nodeID); err != nil {
+		log.Fatal("启用跨节点消息路由失败", zap.Error(err))
+	}
+	defer websocket.GetManager().Close()
+	log.Info("跨节点消息路由已启用", zap.String("node_id", nodeID))
+
+	// 3.4 初始化Redis缓存配置
 	redis.SetCacheConfig(cfg.Cache.MessageTTL, cfg.Cache.MaxCachedMessages, cfg.Cache.MaxCachedConversations)
 	log.Info("Redis缓存配置初始化完成",
 		zap.Duration("messageTTL", cfg.Cache.MessageTTL),
 		zap.Int("maxCachedMessages", cfg.Cache.MaxCachedMessages),
 		zap.Int("maxCachedConversations", cfg.Cache.MaxCachedConversations))
 
-	// 3.4 自动迁移表结构
-	if err := dbPkg.AutoMigrate(&model.User{}, &model.Message{}, &model.Friendship{}); err != nil {
+	// 3.5 自动迁移表结构
+	if err := dbPkg.AutoMigrate(&model.User{}, &model.UserSession{}, &model.AuditLog{}, &model.Message{}, &model.MessageRevision{}, &model.Friendship{}, &model.Group{}, &model.GroupMember{}, &model.File{}, &model.FileUpload{}, &model.FileThumbnail{}, &model.Conversation{}, &model.ConversationMember{}); err != nil {
 		log.Fatal("自动迁移失败", zap.Error(err))
 	}
 	log.Info("自动迁移完成")
 
-	// 3.5 初始化业务服务
-	jwtSvc := jwt.NewJWTService(cfg.JWT)
-	userRepo := repository.NewUserRepository()
+	// 3.5.1 创建消息全文索引
+	searchIndex := repository.NewMySQLSearchIndex(dbPkg.GetDB())
+	if err := searchIndex.Migrate(); err != nil {
+		log.Fatal("创建消息全文索引失败", zap.Error(err))
+	}
+
+	// 3.5.2 补齐历史消息的会话序号并创建 (会话, 序号) 唯一索引
 	messageRepo := repository.NewMessageRepository(dbPkg.GetDB())
-	userSvc := service.NewUserService(userRepo, jwtSvc)
-	messageSvc := service.NewMessageService(messageRepo, userRepo)
-	userHandler := handler.NewUserHandler(userSvc)
+	if err := messageRepo.MigrateSeq(); err != nil {
+		log.Fatal("补齐消息序号失败", zap.Error(err))
+	}
+
+	// 3.5.3 为已有的私聊消息创建会话（会话表为空时执行）
+	conversationRepo := repository.NewConversationRepository(dbPkg.GetDB())
+	if err := conversationRepo.BackfillPrivate(); err != nil {
+		log.Fatal("初始化会话数据失败", zap.Error(err))
+	}
+
+	// 3.6 初始化业务服务
+	jwtSvc, err := jwt.NewJWTService(cfg.JWT)
+	if err != nil {
+		log.Fatal("初始化JWT服务失败", zap.Error(err))
+	}
+	userRepo := repository.NewUserRepository()
+	sessionRepo := repository.NewUserSessionRepository(dbPkg.GetDB())
+	auditRepo := repository.NewAuditLogRepository(dbPkg.GetDB())
+	groupRepo := repository.NewGroupRepository(dbPkg.GetDB())
+	friendshipRepo := repository.NewFriendshipRepository(dbPkg.GetDB())
+	fileRepo := repository.NewFileRepository(dbPkg.GetDB())
+	fileStore, err := storage.NewBackend(cfg.Storage)
+	if err != nil {
+		log.Fatal("初始化文件存储失败", zap.Error(err))
+	}
+	mailer, err := mail.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal("初始化邮件发送器失败", zap.Error(err))
+	}
+	loginGuard := service.NewLoginGuard(cfg.Auth, auditRepo)
+	userSvc := service.NewUserService(userRepo, sessionRepo, auditRepo, jwtSvc, loginGuard, mailer, cfg.Password)
+	messageSvc := service.NewMessageService(messageRepo, userRepo, groupRepo, friendshipRepo, fileRepo, conversationRepo, searchIndex, cfg.Message)
+	groupSvc := service.NewGroupService(groupRepo, userRepo)
+	friendSvc := service.NewFriendService(friendshipRepo, userRepo)
+	mediaWorker := service.NewMediaWorker(fileRepo, fileStore, cfg.Media)
+	fileSvc := service.NewFileService(fileRepo, fileStore, mediaWorker, cfg.Storage)
+	unreadReconciler := service.NewUnreadReconciler(messageSvc, cfg.Message.UnreadReconcileInterval)
+	userHandler := handler.NewUserHandler(userSvc, friendSvc)
 	messageHandler := handler.NewMessageHandler(messageSvc)
+	groupHandler := handler.NewGroupHandler(groupSvc, messageSvc)
+	friendHandler := handler.NewFriendHandler(friendSvc)
+	fileHandler := handler.NewFileHandler(fileSvc)
+	adminHandler := handler.NewAdminHandler(userSvc, cfg.Auth.AdminUserIDs)
+
+	// 图片后台处理（提取尺寸、生成缩略图）
+	mediaWorker.Start()
+	defer mediaWorker.Stop()
+
+	// 定时以数据库为准校正Redis中的会话未读数
+	unreadReconciler.Start()
+	defer unreadReconciler.Stop()
+
+	// WebSocket上行聊天消息复用MessageService的校验与落库逻辑
+	websocket.SetMessageSender(messageSvc)
+	websocket.SetSignalAuthorizer(messageSvc)
+	websocket.SetReadMarker(messageSvc)
+	websocket.SetDraftSaver(messageSvc)
 
 	// 4. 设置Gin模式
 	if os.Getenv("GIN_MODE") == "" {
@@ -96,9 +167,18 @@ func main() {
 	// 5. 创建Gin路由
 	router := gin.New()
 
-	// 注入jwt_config到Gin context，供WebSocket使用
+	// 只信任配置的反向代理转发的 X-Forwarded-For（gin 默认信任所有代理，客户端可伪造来源IP）
+	var trustedProxies []string
+	if len(cfg.Server.TrustedProxies) > 0 {
+		trustedProxies = cfg.Server.TrustedProxies
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("受信任代理配置无效", zap.Error(err))
+	}
+
+	// 注入jwt_service到Gin context，供WebSocket使用
 	router.Use(func(c *gin.Context) {
-		c.Set("jwt_config", cfg.JWT)
+		c.Set("jwt_service", jwtSvc)
 		c.Set("ws_config", cfg.WebSocket)
 		c.Next()
 	})
@@ -110,6 +190,13 @@ func main() {
 	// 6. 设置基础路由
 	setupBasicRoutes(router)
 
+	// 6.0 公布JWT验证公钥（JWKS），其他服务据此校验令牌，无需持有签名密钥；HS256 时为空
+	// 使用标准 JWKS 格式，不包装为统一响应结构
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{"keys": jwtSvc.JWKS()})
+	})
+
 	// 6.1 绑定用户路由
 	v1 := router.Group("/api/v1")
 	{
@@ -118,6 +205,9 @@ func main() {
 			// 公开接口（无需认证）
 			users.POST("/register", userHandler.Register)
 			users.POST("/login", userHandler.Login)
+			users.POST("/token/refresh", userHandler.RefreshToken)     // 刷新令牌（轮换）
+			users.POST("/password/forgot", userHandler.ForgotPassword) // 发送重置密码邮件
+			users.POST("/password/reset", userHandler.ResetPassword)   // 使用重置令牌设置新密码
 
 			// 需要认证的接口
 			authUsers := users.Group("")
@@ -126,6 +216,9 @@ func main() {
 				authUsers.GET("/profile", userHandler.GetProfile)
 				authUsers.GET("/test-auth", userHandler.TestAuth) //这个接口可以用来测试JWT认证是否成功
 				authUsers.POST("/logout", userHandler.Logout)
+				authUsers.PUT("/password", userHandler.ChangePassword)         // 修改密码（吊销其他登录会话）
+				authUsers.GET("/sessions", userHandler.ListSessions)           // 获取登录会话（设备）列表
+				authUsers.DELETE("/sessions/:id", userHandler.KickSession)     // 吊销登录会话（踢下线）
 				authUsers.GET("/online", userHandler.GetOnlineUsers)           //获取在线用户列表
 				authUsers.GET("/online/:user_id", userHandler.CheckUserOnline) //检查指定用户是否在线
 			}
@@ -136,6 +229,7 @@ func main() {
 		messages.Use(jwtSvc.AuthMiddleware())
 		{
 			messages.POST("/send", messageHandler.SendMessage)                                  // 发送消息
+			messages.GET("/search", messageHandler.SearchMessages)                              // 搜索消息
 			messages.GET("/conversations", messageHandler.GetRecentConversations)               // 获取最近对话
 			messages.GET("/conversation-list", messageHandler.GetConversationList)              // 获取对话列表（带缓存）
 			messages.GET("/unread", messageHandler.GetUnreadMessages)                           // 获取未读消息
@@ -147,13 +241,86 @@ func main() {
 			messages.GET("/offline/count", messageHandler.GetOfflineMessageCount)               // 获取离线消息数量
 			messages.DELETE("/offline", messageHandler.ClearOfflineMessages)                    // 清空离线消息
 			messages.DELETE("/:message_id", messageHandler.DeleteMessage)                       // 删除消息
+			messages.POST("/:message_id/recall", messageHandler.RecallMessage)                  // 撤回消息
+			messages.PUT("/:message_id", messageHandler.EditMessage)                            // 编辑消息
+			messages.GET("/:message_id/revisions", messageHandler.GetMessageRevisions)          // 获取消息编辑历史
 		}
 
-		// 私聊消息历史（需要认证）
+		// 私聊会话与消息历史（需要认证）
 		conversations := v1.Group("/conversations")
 		conversations.Use(jwtSvc.AuthMiddleware())
 		{
+			conversations.GET("", messageHandler.ListConversations)                    // 获取会话列表（?archived=true 获取已归档的会话）
+			conversations.POST("", messageHandler.OpenConversation)                    // 打开与指定用户的会话
+			conversations.GET("/:user_id", messageHandler.GetConversation)             // 获取会话设置
+			conversations.PUT("/:user_id", messageHandler.UpdateConversation)          // 修改会话设置（置顶/免打扰/归档/名称）
+			conversations.DELETE("/:user_id", messageHandler.DeleteConversation)       // 从会话列表中删除会话
 			conversations.GET("/:user_id/messages", messageHandler.GetPrivateMessages) // 获取与指定用户的私聊消息
+			conversations.GET("/:user_id/sync", messageHandler.SyncPrivateMessages)    // 按序号增量同步私聊消息
+			conversations.PUT("/:user_id/draft", messageHandler.SaveDraft)             // 保存草稿（多设备同步）
+			conversations.GET("/:user_id/draft", messageHandler.GetDraft)              // 获取草稿
+		}
+
+		// 群组路由（需要认证）
+		groups := v1.Group("/groups")
+		groups.Use(jwtSvc.AuthMiddleware())
+		{
+			groups.POST("", groupHandler.CreateGroup)                                  // 创建群组
+			groups.GET("", groupHandler.GetMyGroups)                                   // 获取我加入的群组
+			groups.GET("/:group_id/members", groupHandler.GetMembers)                  // 获取群成员
+			groups.POST("/:group_id/members", groupHandler.InviteMembers)              // 邀请入群
+			groups.DELETE("/:group_id/members/:user_id", groupHandler.KickMember)      // 移除群成员
+			groups.PUT("/:group_id/members/:user_id/role", groupHandler.SetMemberRole) // 设置成员角色
+			groups.POST("/:group_id/leave", groupHandler.LeaveGroup)                   // 退出群组
+			groups.PUT("/:group_id/owner", groupHandler.TransferOwnership)             // 转让群主
+			groups.POST("/:group_id/messages", groupHandler.SendGroupMessage)          // 发送群聊消息
+			groups.GET("/:group_id/messages", groupHandler.GetGroupMessages)           // 获取群聊消息历史
+			groups.GET("/:group_id/sync", groupHandler.SyncGroupMessages)              // 按序号增量同步群聊消息
+		}
+
+		// 好友路由（需要认证）
+		friends := v1.Group("/friends")
+		friends.Use(jwtSvc.AuthMiddleware())
+		{
+			friends.GET("", friendHandler.GetFriends)                                // 获取好友列表
+			friends.DELETE("/:user_id", friendHandler.RemoveFriend)                  // 删除好友
+			friends.POST("/requests", friendHandler.SendRequest)                     // 发送好友请求
+			friends.GET("/requests/received", friendHandler.GetReceivedRequests)     // 获取收到的好友请求
+			friends.GET("/requests/sent", friendHandler.GetSentRequests)             // 获取发出的好友请求
+			friends.PUT("/requests/:request_id/accept", friendHandler.AcceptRequest) // 接受好友请求
+			friends.PUT("/requests/:request_id/reject", friendHandler.RejectRequest) // 拒绝好友请求
+			friends.DELETE("/requests/:request_id", friendHandler.CancelRequest)     // 撤回好友请求
+		}
+
+		// 黑名单路由（需要认证）
+		blocks := v1.Group("/blocks")
+		blocks.Use(jwtSvc.AuthMiddleware())
+		{
+			blocks.GET("", friendHandler.GetBlockedUsers)         // 获取黑名单
+			blocks.POST("", friendHandler.BlockUser)              // 拉黑用户
+			blocks.DELETE("/:user_id", friendHandler.UnblockUser) // 取消拉黑
+		}
+
+		// 附件路由（需要认证）
+		files := v1.Group("/files")
+		files.Use(jwtSvc.AuthMiddleware())
+		{
+			files.POST("", fileHandler.Upload)                                      // 上传文件
+			files.POST("/uploads", fileHandler.InitUpload)                          // 创建分片上传
+			files.GET("/uploads/:upload_id", fileHandler.GetUploadStatus)           // 获取分片上传进度
+			files.PUT("/uploads/:upload_id/chunks/:index", fileHandler.UploadChunk) // 上传分片
+			files.POST("/uploads/:upload_id/complete", fileHandler.CompleteUpload)  // 完成分片上传
+			files.DELETE("/uploads/:upload_id", fileHandler.AbortUpload)            // 取消分片上传
+			files.GET("/:file_id", fileHandler.Download)                            // 下载附件
+			files.GET("/:file_id/thumbnail", fileHandler.DownloadThumbnail)         // 下载图片缩略图
+			files.GET("/:file_id/info", fileHandler.GetInfo)                        // 获取附件信息
+		}
+
+		// 管理路由（需要认证且为管理员）
+		admin := v1.Group("/admin")
+		admin.Use(jwtSvc.AuthMiddleware(), adminHandler.RequireAdmin())
+		{
+			admin.POST("/users/:user_id/unlock", adminHandler.UnlockUser) // 解除账号登录锁定
 		}
 	}
 
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -17,6 +18,12 @@ type Config struct {
 	Redis     RedisConfig     `yaml:"redis"`
 	WebSocket WebSocketConfig `yaml:"websocket"`
 	Cache     CacheConfig     `yaml:"cache"`
+	Message   MessageConfig   `yaml:"message"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Media     MediaConfig     `yaml:"media"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Password  PasswordConfig  `yaml:"password"`
+	Mail      MailConfig      `yaml:"mail"`
 }
 
 // ServerConfig 服务器配置
@@ -25,6 +32,9 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"readTimeout"`  // 读取超时时间
 	WriteTimeout time.Duration `yaml:"writeTimeout"` // 写入超时时间
 	IdleTimeout  time.Duration `yaml:"idleTimeout"`  // 空闲超时时间
+	NodeID       string        `yaml:"nodeID"`       // 节点ID（多实例部署时需唯一，为空则使用 主机名:端口）
+	// 受信任的反向代理（IP或CIDR），只有来自这些地址的请求才采用 X-Forwarded-For 中的客户端IP；为空时不信任任何代理
+	TrustedProxies []string `yaml:"trustedProxies"`
 }
 
 // DatabaseConfig 数据库配置
@@ -42,9 +52,22 @@ type DatabaseConfig struct {
 
 // JWTConfig JWT配置
 type JWTConfig struct {
-	Secret     string        `yaml:"secret"`     // JWT密钥
-	ExpireTime time.Duration `yaml:"expireTime"` // JWT过期时间
-	Issuer     string        `yaml:"issuer"`     // JWT签发者
+	Secret            string        `yaml:"secret"`            // JWT密钥
+	ExpireTime        time.Duration `yaml:"expireTime"`        // 访问令牌过期时间
+	RefreshExpireTime time.Duration `yaml:"refreshExpireTime"` // 刷新令牌过期时间（每次刷新时轮换）
+	Issuer            string        `yaml:"issuer"`            // JWT签发者
+
+	// 非对称签名（RS256 / EdDSA）：私钥签名，其他服务只需公钥即可验证（公钥通过 /.well-known/jwks.json 公布）
+	Algorithm        string         `yaml:"algorithm"`        // 签名算法：HS256（默认，使用 Secret）/ RS256 / EdDSA
+	SigningKeyFile   string         `yaml:"signingKeyFile"`   // 签名私钥 PEM 文件
+	SigningKeyID     string         `yaml:"signingKeyID"`     // 签名密钥ID（kid），为空时根据公钥生成
+	VerificationKeys []JWTKeyConfig `yaml:"verificationKeys"` // 额外的验证公钥（轮换密钥时保留旧公钥，直到旧令牌全部过期）
+}
+
+// JWTKeyConfig JWT验证公钥配置
+type JWTKeyConfig struct {
+	ID   string `yaml:"id"`   // 密钥ID（kid），为空时根据公钥生成
+	File string `yaml:"file"` // 公钥 PEM 文件（也可以是私钥文件）
 }
 
 // LogConfig 日志配置
@@ -67,8 +90,11 @@ type RedisConfig struct {
 
 // WebSocketConfig WebSocket 心跳配置
 type WebSocketConfig struct {
-	PingInterval time.Duration `yaml:"pingInterval"` // 发送ping的间隔
-	ReadTimeout  time.Duration `yaml:"readTimeout"`  // 读超时时间（未收到任何数据则断开）
+	PingInterval   time.Duration `yaml:"pingInterval"`   // 发送ping的间隔
+	ReadTimeout    time.Duration `yaml:"readTimeout"`    // 读超时时间（未收到任何数据则断开）
+	AckTimeout     time.Duration `yaml:"ackTimeout"`     // 等待客户端投递确认的超时时间，超时重传
+	MaxRetransmits int           `yaml:"maxRetransmits"` // 最大重传次数，仍未确认则放回离线队列
+	TypingTimeout  time.Duration `yaml:"typingTimeout"`  // 正在输入状态的过期时间，超时未续期自动结束
 }
 
 // CacheConfig 缓存配置
@@ -79,6 +105,64 @@ type CacheConfig struct {
 	MaxCachedConversations int           `yaml:"maxCachedConversations"` // 最大缓存对话数
 }
 
+// MessageConfig 消息配置
+type MessageConfig struct {
+	RecallWindow            time.Duration `yaml:"recallWindow"`            // 发送后允许撤回的时间窗口
+	EditWindow              time.Duration `yaml:"editWindow"`              // 发送后允许编辑的时间窗口
+	UnreadReconcileInterval time.Duration `yaml:"unreadReconcileInterval"` // 以数据库为准校正Redis会话未读数的间隔，0 表示不校正
+}
+
+// StorageConfig 附件存储配置
+type StorageConfig struct {
+	Driver      string `yaml:"driver"`      // 存储驱动（目前支持 local）
+	LocalDir    string `yaml:"localDir"`    // 本地存储目录
+	MaxFileSize int64  `yaml:"maxFileSize"` // 单个文件最大字节数
+	ChunkSize   int64  `yaml:"chunkSize"`   // 分片上传的分片大小（字节，最后一片可以更小）
+}
+
+// MediaConfig 图片处理配置
+type MediaConfig struct {
+	ThumbnailSizes []int `yaml:"thumbnailSizes"` // 缩略图规格（长边像素）
+	JPEGQuality    int   `yaml:"jpegQuality"`    // 缩略图 JPEG 编码质量
+	MaxPixels      int   `yaml:"maxPixels"`      // 允许处理的最大像素数，超过的图片不生成缩略图
+	Workers        int   `yaml:"workers"`        // 后台处理协程数
+}
+
+// AuthConfig 登录安全配置
+// 同一账号连续失败 BackoffAfter 次后，每次失败需等待 BackoffBase*2^(n-BackoffAfter)（不超过 BackoffMax）才能再次尝试；
+// 账号失败 MaxAccountFailures 次或同一IP失败 MaxIPFailures 次后锁定 LockoutDuration；失败计数在 FailureWindow 内无失败时清零
+type AuthConfig struct {
+	MaxAccountFailures int           `yaml:"maxAccountFailures"` // 账号锁定前允许的连续失败次数
+	MaxIPFailures      int           `yaml:"maxIPFailures"`      // IP锁定前允许的失败次数（所有账号合计）
+	FailureWindow      time.Duration `yaml:"failureWindow"`      // 失败计数窗口
+	BackoffAfter       int           `yaml:"backoffAfter"`       // 账号连续失败多少次后开始退避
+	BackoffBase        time.Duration `yaml:"backoffBase"`        // 退避基数
+	BackoffMax         time.Duration `yaml:"backoffMax"`         // 最长退避时间
+	LockoutDuration    time.Duration `yaml:"lockoutDuration"`    // 锁定时长
+	AdminUserIDs       []uint        `yaml:"adminUserIDs"`       // 管理员用户ID（可解除账号锁定）
+}
+
+// PasswordConfig 密码策略与重置密码配置
+// 字符类别分为小写字母、大写字母、数字、符号四类
+type PasswordConfig struct {
+	MinLength     int           `yaml:"minLength"`     // 最少字符数
+	MinClasses    int           `yaml:"minClasses"`    // 至少包含的字符类别数（1-4）
+	RequireUpper  bool          `yaml:"requireUpper"`  // 必须包含大写字母
+	RequireLower  bool          `yaml:"requireLower"`  // 必须包含小写字母
+	RequireDigit  bool          `yaml:"requireDigit"`  // 必须包含数字
+	RequireSymbol bool          `yaml:"requireSymbol"` // 必须包含符号
+	ResetTokenTTL time.Duration `yaml:"resetTokenTTL"` // 重置密码令牌有效期
+	ResetCooldown time.Duration `yaml:"resetCooldown"` // 同一账号两次发送重置邮件的最短间隔
+	ResetURL      string        `yaml:"resetURL"`      // 重置密码页面地址，{token} 替换为令牌；为空时邮件中只包含令牌
+}
+
+// MailConfig 邮件配置
+type MailConfig struct {
+	Driver string `yaml:"driver"` // 邮件驱动：log（写入日志）/ file（写入 .eml 文件）
+	From   string `yaml:"from"`   // 发件人
+	Dir    string `yaml:"dir"`    // file 驱动的邮件目录
+}
+
 // LoadConfig 加载配置（混合方式：YAML文件 + 环境变量）
 func LoadConfig() *Config {
 	// 1. 首先从YAML文件加载默认配置
@@ -124,6 +208,12 @@ func overrideWithEnvVars(config *Config) {
 	if timeout := getEnvDuration("SERVER_IDLE_TIMEOUT", 0); timeout > 0 {
 		config.Server.IdleTimeout = timeout
 	}
+	if nodeID := getEnv("SERVER_NODE_ID", ""); nodeID != "" {
+		config.Server.NodeID = nodeID
+	}
+	if proxies := getEnvList("SERVER_TRUSTED_PROXIES"); proxies != nil {
+		config.Server.TrustedProxies = proxies
+	}
 
 	// 数据库配置
 	if host := getEnv("DB_HOST", ""); host != "" {
@@ -161,6 +251,21 @@ func overrideWithEnvVars(config *Config) {
 	if issuer := getEnv("JWT_ISSUER", ""); issuer != "" {
 		config.JWT.Issuer = issuer
 	}
+	if refreshExpireTime := getEnvDuration("JWT_REFRESH_EXPIRE_TIME", 0); refreshExpireTime > 0 {
+		config.JWT.RefreshExpireTime = refreshExpireTime
+	}
+	if algorithm := getEnv("JWT_ALGORITHM", ""); algorithm != "" {
+		config.JWT.Algorithm = algorithm
+	}
+	if keyFile := getEnv("JWT_SIGNING_KEY_FILE", ""); keyFile != "" {
+		config.JWT.SigningKeyFile = keyFile
+	}
+	if keyID := getEnv("JWT_SIGNING_KEY_ID", ""); keyID != "" {
+		config.JWT.SigningKeyID = keyID
+	}
+	if keys := getEnvJWTKeys("JWT_VERIFICATION_KEYS"); len(keys) > 0 {
+		config.JWT.VerificationKeys = keys
+	}
 
 	// 日志配置
 	if level := getEnv("LOG_LEVEL", ""); level != "" {
@@ -200,6 +305,15 @@ func overrideWithEnvVars(config *Config) {
 	if d := getEnvDuration("WS_READ_TIMEOUT", 0); d > 0 {
 		config.WebSocket.ReadTimeout = d
 	}
+	if d := getEnvDuration("WS_ACK_TIMEOUT", 0); d > 0 {
+		config.WebSocket.AckTimeout = d
+	}
+	if n := getEnvInt("WS_MAX_RETRANSMITS", 0); n > 0 {
+		config.WebSocket.MaxRetransmits = n
+	}
+	if d := getEnvDuration("WS_TYPING_TIMEOUT", 0); d > 0 {
+		config.WebSocket.TypingTimeout = d
+	}
 
 	// 缓存配置
 	if d := getEnvDuration("CACHE_MESSAGE_TTL", 0); d > 0 {
@@ -211,6 +325,106 @@ func overrideWithEnvVars(config *Config) {
 	if max := getEnvInt("CACHE_MAX_CONVERSATIONS", 0); max > 0 {
 		config.Cache.MaxCachedConversations = max
 	}
+
+	// 消息配置
+	if d := getEnvDuration("MSG_RECALL_WINDOW", 0); d > 0 {
+		config.Message.RecallWindow = d
+	}
+	if d := getEnvDuration("MSG_EDIT_WINDOW", 0); d > 0 {
+		config.Message.EditWindow = d
+	}
+	if d := getEnvDuration("MSG_UNREAD_RECONCILE_INTERVAL", -1); d >= 0 {
+		config.Message.UnreadReconcileInterval = d
+	}
+
+	// 附件存储配置
+	if driver := getEnv("STORAGE_DRIVER", ""); driver != "" {
+		config.Storage.Driver = driver
+	}
+	if dir := getEnv("STORAGE_LOCAL_DIR", ""); dir != "" {
+		config.Storage.LocalDir = dir
+	}
+	if size := getEnvInt("STORAGE_MAX_FILE_SIZE", 0); size > 0 {
+		config.Storage.MaxFileSize = int64(size)
+	}
+	if size := getEnvInt("STORAGE_CHUNK_SIZE", 0); size > 0 {
+		config.Storage.ChunkSize = int64(size)
+	}
+
+	// 图片处理配置
+	if sizes := getEnvIntList("MEDIA_THUMBNAIL_SIZES"); len(sizes) > 0 {
+		config.Media.ThumbnailSizes = sizes
+	}
+	if quality := getEnvInt("MEDIA_JPEG_QUALITY", 0); quality > 0 {
+		config.Media.JPEGQuality = quality
+	}
+	if maxPixels := getEnvInt("MEDIA_MAX_PIXELS", 0); maxPixels > 0 {
+		config.Media.MaxPixels = maxPixels
+	}
+	if workers := getEnvInt("MEDIA_WORKERS", 0); workers > 0 {
+		config.Media.Workers = workers
+	}
+
+	// 登录安全配置
+	if n := getEnvInt("AUTH_MAX_ACCOUNT_FAILURES", 0); n > 0 {
+		config.Auth.MaxAccountFailures = n
+	}
+	if n := getEnvInt("AUTH_MAX_IP_FAILURES", 0); n > 0 {
+		config.Auth.MaxIPFailures = n
+	}
+	if window := getEnvDuration("AUTH_FAILURE_WINDOW", 0); window > 0 {
+		config.Auth.FailureWindow = window
+	}
+	if n := getEnvInt("AUTH_BACKOFF_AFTER", 0); n > 0 {
+		config.Auth.BackoffAfter = n
+	}
+	if base := getEnvDuration("AUTH_BACKOFF_BASE", 0); base > 0 {
+		config.Auth.BackoffBase = base
+	}
+	if max := getEnvDuration("AUTH_BACKOFF_MAX", 0); max > 0 {
+		config.Auth.BackoffMax = max
+	}
+	if lockout := getEnvDuration("AUTH_LOCKOUT_DURATION", 0); lockout > 0 {
+		config.Auth.LockoutDuration = lockout
+	}
+	if ids := getEnvIntList("AUTH_ADMIN_USER_IDS"); len(ids) > 0 {
+		config.Auth.AdminUserIDs = make([]uint, 0, len(ids))
+		for _, id := range ids {
+			config.Auth.AdminUserIDs = append(config.Auth.AdminUserIDs, uint(id))
+		}
+	}
+
+	// 密码策略与重置密码配置
+	if n := getEnvInt("PASSWORD_MIN_LENGTH", 0); n > 0 {
+		config.Password.MinLength = n
+	}
+	if n := getEnvInt("PASSWORD_MIN_CLASSES", 0); n > 0 {
+		config.Password.MinClasses = n
+	}
+	config.Password.RequireUpper = getEnvBool("PASSWORD_REQUIRE_UPPER", config.Password.RequireUpper)
+	config.Password.RequireLower = getEnvBool("PASSWORD_REQUIRE_LOWER", config.Password.RequireLower)
+	config.Password.RequireDigit = getEnvBool("PASSWORD_REQUIRE_DIGIT", config.Password.RequireDigit)
+	config.Password.RequireSymbol = getEnvBool("PASSWORD_REQUIRE_SYMBOL", config.Password.RequireSymbol)
+	if ttl := getEnvDuration("PASSWORD_RESET_TOKEN_TTL", 0); ttl > 0 {
+		config.Password.ResetTokenTTL = ttl
+	}
+	if cooldown := getEnvDuration("PASSWORD_RESET_COOLDOWN", 0); cooldown > 0 {
+		config.Password.ResetCooldown = cooldown
+	}
+	if url := getEnv("PASSWORD_RESET_URL", ""); url != "" {
+		config.Password.ResetURL = url
+	}
+
+	// 邮件配置
+	if driver := getEnv("MAIL_DRIVER", ""); driver != "" {
+		config.Mail.Driver = driver
+	}
+	if from := getEnv("MAIL_FROM", ""); from != "" {
+		config.Mail.From = from
+	}
+	if dir := getEnv("MAIL_DIR", ""); dir != "" {
+		config.Mail.Dir = dir
+	}
 }
 
 // getDefaultConfig 获取默认配置
@@ -234,9 +448,11 @@ func getDefaultConfig() *Config {
 			MaxOpen:  100,
 		},
 		JWT: JWTConfig{
-			Secret:     "your-secret-key",
-			ExpireTime: 24 * time.Hour,
-			Issuer:     "im-system",
+			Secret:            "your-secret-key",
+			ExpireTime:        15 * time.Minute,
+			Issuer:            "im-system",
+			RefreshExpireTime: 7 * 24 * time.Hour,
+			Algorithm:         "HS256",
 		},
 		Log: LogConfig{
 			Level:      "info",
@@ -253,8 +469,11 @@ func getDefaultConfig() *Config {
 			DB:       0,
 		},
 		WebSocket: WebSocketConfig{
-			PingInterval: 30 * time.Second,
-			ReadTimeout:  90 * time.Second,
+			PingInterval:   30 * time.Second,
+			ReadTimeout:    90 * time.Second,
+			AckTimeout:     10 * time.Second,
+			MaxRetransmits: 3,
+			TypingTimeout:  6 * time.Second,
 		},
 		Cache: CacheConfig{
 			Enabled:                true,
@@ -262,6 +481,43 @@ func getDefaultConfig() *Config {
 			MaxCachedMessages:      30,
 			MaxCachedConversations: 10,
 		},
+		Message: MessageConfig{
+			RecallWindow:            2 * time.Minute,
+			EditWindow:              15 * time.Minute,
+			UnreadReconcileInterval: 10 * time.Minute,
+		},
+		Storage: StorageConfig{
+			Driver:      "local",
+			LocalDir:    "data/files",
+			MaxFileSize: 100 << 20, // 100MB
+			ChunkSize:   4 << 20,   // 4MB
+		},
+		Media: MediaConfig{
+			ThumbnailSizes: []int{160, 480, 1080},
+			JPEGQuality:    80,
+			MaxPixels:      50_000_000,
+			Workers:        2,
+		},
+		Auth: AuthConfig{
+			MaxAccountFailures: 10,
+			MaxIPFailures:      100,
+			FailureWindow:      15 * time.Minute,
+			BackoffAfter:       3,
+			BackoffBase:        time.Second,
+			BackoffMax:         time.Minute,
+			LockoutDuration:    15 * time.Minute,
+		},
+		Password: PasswordConfig{
+			MinLength:     8,
+			MinClasses:    2,
+			ResetTokenTTL: 30 * time.Minute,
+			ResetCooldown: time.Minute,
+		},
+		Mail: MailConfig{
+			Driver: "log",
+			From:   "IM System <no-reply@im-system.local>",
+			Dir:    "data/mail",
+		},
 	}
 }
 
@@ -293,6 +549,59 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// 辅助函数：获取逗号分隔的字符串列表环境变量，忽略空项
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// 辅助函数：获取逗号分隔的整数列表环境变量，格式错误时返回nil
+func getEnvIntList(key string) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil
+		}
+		list = append(list, n)
+	}
+	return list
+}
+
+// 辅助函数：获取JWT验证公钥列表环境变量，格式为 "kid=文件路径,kid=文件路径"（kid 可省略）
+func getEnvJWTKeys(key string) []JWTKeyConfig {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	var keys []JWTKeyConfig
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k := JWTKeyConfig{File: item}
+		if id, file, ok := strings.Cut(item, "="); ok {
+			k = JWTKeyConfig{ID: strings.TrimSpace(id), File: strings.TrimSpace(file)}
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 // 辅助函数：获取时间环境变量
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
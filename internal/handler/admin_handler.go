@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"im-system/internal/service"
+	"im-system/pkg/jwt"
+	"im-system/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	userService *service.UserService
+	adminIDs    map[uint]struct{}
+}
+
+// NewAdminHandler 创建AdminHandler实例，adminIDs 为管理员用户ID
+func NewAdminHandler(us *service.UserService, adminIDs []uint) *AdminHandler {
+	ids := make(map[uint]struct{}, len(adminIDs))
+	for _, id := range adminIDs {
+		ids[id] = struct{}{}
+	}
+	return &AdminHandler{userService: us, adminIDs: ids}
+}
+
+// RequireAdmin 管理员权限中间件（需在JWT中间件之后使用）
+func (h *AdminHandler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var uid uint
+		if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+			response.Unauthorized(c, "invalid user id")
+			c.Abort()
+			return
+		}
+		if _, ok := h.adminIDs[uid]; !ok {
+			response.Forbidden(c, "需要管理员权限")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// UnlockUser 解除账号的登录锁定并清空失败计数（需要管理员权限）
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	var adminID uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &adminID); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user_id")
+		return
+	}
+
+	err = h.userService.UnlockLogin(adminID, uint(userID))
+	if errors.Is(err, service.ErrUserNotFound) {
+		response.NotFound(c, "用户不存在")
+		return
+	}
+	if err != nil {
+		response.InternalError(c, "解除登录锁定失败")
+		return
+	}
+	response.SuccessWithMessage(c, "解除登录锁定成功", gin.H{"user_id": userID})
+}
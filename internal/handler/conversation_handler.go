@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"im-system/internal/service"
+	"im-system/pkg/jwt"
+	"im-system/pkg/redis"
+	"im-system/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListConversations 获取会话列表
+// 默认返回未归档的会话（置顶在前）；archived=true 时返回已归档的会话
+func (h *MessageHandler) ListConversations(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	var conversations []redis.CachedConversation
+	if c.Query("archived") == "true" {
+		conversations, err = h.service.GetArchivedConversations(uint(userID), limit)
+	} else {
+		conversations, err = h.service.GetConversationList(uint(userID), limit)
+	}
+	if err != nil {
+		response.InternalError(c, "获取会话列表失败")
+		return
+	}
+
+	conversationList := make([]gin.H, 0, len(conversations))
+	for i := range conversations {
+		conversationList = append(conversationList, conversationResponse(&conversations[i]))
+	}
+	response.SuccessWithMessage(c, "获取会话列表成功", gin.H{
+		"conversations": conversationList,
+		"total":         len(conversationList),
+	})
+}
+
+// OpenConversation 打开与指定用户的会话（尚无消息时创建）
+func (h *MessageHandler) OpenConversation(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	type req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	conv, err := h.service.OpenConversation(uint(userID), strconv.FormatUint(uint64(r.UserID), 10))
+	if errors.Is(err, service.ErrBlocked) {
+		response.Blocked(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "打开会话成功", conversationResponse(conv))
+}
+
+// GetConversation 获取与指定用户的会话设置
+func (h *MessageHandler) GetConversation(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	conv, err := h.service.GetConversation(uint(userID), c.Param("user_id"))
+	if errors.Is(err, service.ErrConversationNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取会话成功", conversationResponse(conv))
+}
+
+// UpdateConversation 修改会话设置（置顶、免打扰、归档、自定义名称），未传的字段保持不变
+func (h *MessageHandler) UpdateConversation(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	var settings service.ConversationSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	conv, err := h.service.UpdateConversationSettings(uint(userID), c.Param("user_id"), &settings)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "会话设置已更新", conversationResponse(conv))
+}
+
+// DeleteConversation 从会话列表中删除与指定用户的会话（不删除消息）
+func (h *MessageHandler) DeleteConversation(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.DeleteConversation(uint(userID), c.Param("user_id"))
+	if errors.Is(err, service.ErrConversationNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "会话已删除", nil)
+}
+
+// SaveDraft 保存与指定用户私聊的草稿，content 为空时清空草稿
+func (h *MessageHandler) SaveDraft(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	type req struct {
+		Content string `json:"content"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	draft, err := h.service.SaveDraft(uint(userID), c.Param("user_id"), r.Content)
+	if errors.Is(err, service.ErrBlocked) {
+		response.Blocked(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "草稿已保存", draftResponse(draft))
+}
+
+// GetDraft 获取与指定用户私聊的草稿
+func (h *MessageHandler) GetDraft(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	draft, err := h.service.GetDraft(uint(userID), c.Param("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取草稿成功", draftResponse(draft))
+}
+
+// draftResponse 草稿响应格式（没有草稿时 updated_at 为空）
+func draftResponse(draft *redis.Draft) gin.H {
+	updatedAt := ""
+	if draft.Content != "" && !draft.UpdatedAt.IsZero() {
+		updatedAt = draft.UpdatedAt.Format("2006-01-02 15:04:05")
+	}
+	return gin.H{
+		"content":    draft.Content,
+		"updated_at": updatedAt,
+	}
+}
+
+// conversationResponse 会话响应格式
+func conversationResponse(conv *redis.CachedConversation) gin.H {
+	lastTime := ""
+	if !conv.LastTime.IsZero() {
+		lastTime = conv.LastTime.Format("2006-01-02 15:04:05")
+	}
+	draftUpdatedAt := ""
+	if conv.DraftUpdatedAt != nil {
+		draftUpdatedAt = conv.DraftUpdatedAt.Format("2006-01-02 15:04:05")
+	}
+	return gin.H{
+		"user_id":          conv.UserID,
+		"username":         conv.Username,
+		"title":            conv.Title,
+		"last_message":     conv.LastMessage,
+		"last_time":        lastTime,
+		"unread_count":     conv.UnreadCount,
+		"pinned":           conv.Pinned,
+		"muted":            conv.Muted,
+		"archived":         conv.Archived,
+		"last_read_msg_id": conv.LastReadMsgID,
+		"last_read_seq":    conv.LastReadSeq,
+		"draft":            conv.Draft,
+		"draft_updated_at": draftUpdatedAt,
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"im-system/internal/service"
+	"im-system/pkg/jwt"
+	"im-system/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileHandler 附件处理器
+type FileHandler struct {
+	service *service.FileService
+}
+
+// NewFileHandler 创建FileHandler实例
+func NewFileHandler(service *service.FileService) *FileHandler {
+	return &FileHandler{service: service}
+}
+
+// Upload 上传文件（multipart/form-data，字段名 file）
+func (h *FileHandler) Upload(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.BadRequest(c, "file is required")
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	defer f.Close()
+
+	info, err := h.service.Upload(uint(userID), fileHeader.Filename, f)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "文件上传成功", info)
+}
+
+// InitUpload 创建分片上传
+func (h *FileHandler) InitUpload(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		Name   string `json:"name" binding:"required"`
+		Size   int64  `json:"size" binding:"required"`
+		SHA256 string `json:"sha256"` // 可选，合并分片时校验
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	status, err := h.service.InitUpload(uint(userID), r.Name, r.Size, r.SHA256)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "创建分片上传成功", status)
+}
+
+// GetUploadStatus 获取分片上传进度
+func (h *FileHandler) GetUploadStatus(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	status, err := h.service.GetUploadStatus(uint(userID), c.Param("upload_id"))
+	if err != nil {
+		response.NotFound(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取上传进度成功", status)
+}
+
+// UploadChunk 上传分片（请求体为分片的原始字节）
+func (h *FileHandler) UploadChunk(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.BadRequest(c, "invalid chunk index")
+		return
+	}
+
+	if err := h.service.UploadChunk(uint(userID), c.Param("upload_id"), index, c.Request.Body); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "分片上传成功", gin.H{"index": index})
+}
+
+// CompleteUpload 完成分片上传
+func (h *FileHandler) CompleteUpload(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	info, err := h.service.CompleteUpload(uint(userID), c.Param("upload_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "文件上传成功", info)
+}
+
+// AbortUpload 取消分片上传
+func (h *FileHandler) AbortUpload(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	if err := h.service.AbortUpload(uint(userID), c.Param("upload_id")); err != nil {
+		response.NotFound(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已取消上传", nil)
+}
+
+// Download 下载附件（支持 Range 请求）
+func (h *FileHandler) Download(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	download, err := h.service.Open(uint(userID), c.Param("file_id"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.InternalError(c, "读取文件失败")
+		return
+	}
+	serveDownload(c, download)
+}
+
+// DownloadThumbnail 下载图片缩略图（?size= 指定规格，返回不小于该规格的最小缩略图）
+func (h *FileHandler) DownloadThumbnail(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	size := 0
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		if size, err = strconv.Atoi(sizeStr); err != nil || size < 0 {
+			response.BadRequest(c, "invalid size")
+			return
+		}
+	}
+
+	download, err := h.service.OpenThumbnail(uint(userID), c.Param("file_id"), size)
+	if errors.Is(err, service.ErrFileNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	serveDownload(c, download)
+}
+
+// GetInfo 获取附件信息（图片含尺寸、处理状态与缩略图列表）
+func (h *FileHandler) GetInfo(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	info, err := h.service.GetInfo(uint(userID), c.Param("file_id"))
+	if errors.Is(err, service.ErrFileNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.InternalError(c, "获取附件信息失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取附件信息成功", info)
+}
+
+// serveDownload 输出下载内容
+func serveDownload(c *gin.Context, download *service.Download) {
+	defer download.Reader.Close()
+
+	c.Header("Content-Type", download.Mime)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename*=UTF-8''%s", url.PathEscape(download.Name)))
+	c.Header("ETag", `"`+download.ETag+`"`)
+	if download.Final {
+		// 内容寻址的文件内容不会变化，可长期缓存
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	http.ServeContent(c.Writer, c.Request, download.Name, time.Time{}, download.Reader)
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"im-system/internal/service"
+	"im-system/pkg/jwt"
+	"im-system/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FriendHandler 好友处理器
+type FriendHandler struct {
+	service *service.FriendService
+}
+
+// NewFriendHandler 创建FriendHandler实例
+func NewFriendHandler(s *service.FriendService) *FriendHandler {
+	return &FriendHandler{service: s}
+}
+
+// SendRequest 发送好友请求
+func (h *FriendHandler) SendRequest(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		ToUserID string `json:"to_user_id" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	friendship, err := h.service.SendRequest(uint(userID), r.ToUserID)
+	if errors.Is(err, service.ErrBlocked) {
+		response.Blocked(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "好友请求已发送", friendship)
+}
+
+// AcceptRequest 接受好友请求
+func (h *FriendHandler) AcceptRequest(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	friendship, err := h.service.AcceptRequest(uint(userID), c.Param("request_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已接受好友请求", friendship)
+}
+
+// RejectRequest 拒绝好友请求
+func (h *FriendHandler) RejectRequest(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.RejectRequest(uint(userID), c.Param("request_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已拒绝好友请求", nil)
+}
+
+// CancelRequest 撤回好友请求
+func (h *FriendHandler) CancelRequest(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.CancelRequest(uint(userID), c.Param("request_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已撤回好友请求", nil)
+}
+
+// GetReceivedRequests 获取收到的好友请求
+func (h *FriendHandler) GetReceivedRequests(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	requests, err := h.service.GetReceivedRequests(uint(userID))
+	if err != nil {
+		response.InternalError(c, "获取好友请求失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取好友请求成功", gin.H{
+		"requests": requests,
+		"total":    len(requests),
+	})
+}
+
+// GetSentRequests 获取发出的好友请求
+func (h *FriendHandler) GetSentRequests(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	requests, err := h.service.GetSentRequests(uint(userID))
+	if err != nil {
+		response.InternalError(c, "获取好友请求失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取好友请求成功", gin.H{
+		"requests": requests,
+		"total":    len(requests),
+	})
+}
+
+// GetFriends 获取好友列表
+func (h *FriendHandler) GetFriends(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	friends, err := h.service.GetFriends(uint(userID))
+	if err != nil {
+		response.InternalError(c, "获取好友列表失败")
+		return
+	}
+
+	// 过滤敏感字段
+	list := make([]*response.UserInfo, 0, len(friends))
+	for _, f := range friends {
+		list = append(list, response.FilterUserInfo(f))
+	}
+
+	response.SuccessWithMessage(c, "获取好友列表成功", gin.H{
+		"friends": list,
+		"total":   len(list),
+	})
+}
+
+// RemoveFriend 删除好友
+func (h *FriendHandler) RemoveFriend(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.RemoveFriend(uint(userID), c.Param("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已删除好友", nil)
+}
+
+// BlockUser 拉黑用户
+func (h *FriendHandler) BlockUser(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	err = h.service.BlockUser(uint(userID), r.UserID)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已拉黑该用户", nil)
+}
+
+// UnblockUser 取消拉黑
+func (h *FriendHandler) UnblockUser(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.UnblockUser(uint(userID), c.Param("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已取消拉黑", nil)
+}
+
+// GetBlockedUsers 获取黑名单
+func (h *FriendHandler) GetBlockedUsers(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	users, err := h.service.GetBlockedUsers(uint(userID))
+	if err != nil {
+		response.InternalError(c, "获取黑名单失败")
+		return
+	}
+
+	// 过滤敏感字段
+	list := make([]*response.UserInfo, 0, len(users))
+	for _, u := range users {
+		list = append(list, response.FilterUserInfo(u))
+	}
+
+	response.SuccessWithMessage(c, "获取黑名单成功", gin.H{
+		"users": list,
+		"total": len(list),
+	})
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"im-system/internal/service"
+	"im-system/pkg/jwt"
+	"im-system/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupHandler 群组处理器
+type GroupHandler struct {
+	service        *service.GroupService
+	messageService *service.MessageService
+}
+
+// NewGroupHandler 创建GroupHandler实例
+func NewGroupHandler(s *service.GroupService, ms *service.MessageService) *GroupHandler {
+	return &GroupHandler{service: s, messageService: ms}
+}
+
+// CreateGroup 创建群组
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		Name      string `json:"name" binding:"required"`
+		MemberIDs []uint `json:"member_ids"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	group, err := h.service.CreateGroup(uint(userID), r.Name, r.MemberIDs)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "创建群组成功", group)
+}
+
+// GetMyGroups 获取我加入的群组
+func (h *GroupHandler) GetMyGroups(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	groups, err := h.service.GetUserGroups(uint(userID))
+	if err != nil {
+		response.InternalError(c, "获取群组列表失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取群组列表成功", gin.H{
+		"groups": groups,
+		"total":  len(groups),
+	})
+}
+
+// GetMembers 获取群成员列表
+func (h *GroupHandler) GetMembers(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	members, err := h.service.GetMembers(uint(userID), c.Param("group_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取群成员成功", gin.H{
+		"members": members,
+		"total":   len(members),
+	})
+}
+
+// InviteMembers 邀请用户入群
+func (h *GroupHandler) InviteMembers(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		UserIDs []uint `json:"user_ids" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	added, err := h.service.InviteMembers(uint(userID), c.Param("group_id"), r.UserIDs)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "邀请成功", gin.H{
+		"added": added,
+	})
+}
+
+// KickMember 移除群成员
+func (h *GroupHandler) KickMember(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.KickMember(uint(userID), c.Param("group_id"), c.Param("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "移除成员成功", nil)
+}
+
+// SetMemberRole 设置成员角色（admin/member）
+func (h *GroupHandler) SetMemberRole(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	err = h.service.SetMemberRole(uint(userID), c.Param("group_id"), c.Param("user_id"), r.Role)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "设置成员角色成功", nil)
+}
+
+// LeaveGroup 退出群组
+func (h *GroupHandler) LeaveGroup(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	err = h.service.LeaveGroup(uint(userID), c.Param("group_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "已退出群组", nil)
+}
+
+// TransferOwnership 转让群主
+func (h *GroupHandler) TransferOwnership(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		NewOwnerID string `json:"new_owner_id" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	err = h.service.TransferOwnership(uint(userID), c.Param("group_id"), r.NewOwnerID)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "转让群主成功", nil)
+}
+
+// SendGroupMessage 发送群聊消息
+func (h *GroupHandler) SendGroupMessage(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		MsgType string          `json:"msg_type"` // 为空时为文本消息
+		Content string          `json:"content"`  // 文本消息必填，其他类型为可选说明
+		Payload json.RawMessage `json:"payload"`  // 非文本消息的结构化内容
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	message, err := h.messageService.SendGroupMessage(uint(userID), c.Param("group_id"), r.MsgType, r.Content, r.Payload)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "消息发送成功", message)
+}
+
+// GetGroupMessages 获取群聊消息历史
+func (h *GroupHandler) GetGroupMessages(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 获取分页参数
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	messages, err := h.messageService.GetGroupMessages(uint(userID), c.Param("group_id"), page, pageSize)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取群聊消息成功", messages)
+}
+
+// SyncGroupMessages 按会话序号增量同步群聊消息
+func (h *GroupHandler) SyncGroupMessages(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 获取同步参数
+	afterSeq, err := strconv.ParseUint(c.DefaultQuery("after_seq", "0"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid after_seq")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	messages, hasMore, err := h.messageService.SyncGroupMessages(uint(userID), c.Param("group_id"), afterSeq, limit)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "同步群聊消息成功", syncResult(messages, hasMore, afterSeq))
+}
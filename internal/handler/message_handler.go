@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"strconv"
+	"time"
 
+	"im-system/internal/model"
 	"im-system/internal/service"
 	"im-system/pkg/jwt"
 	"im-system/pkg/redis"
@@ -33,8 +38,10 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 
 	// 绑定请求参数
 	type req struct {
-		ReceiverID string `json:"receiver_id" binding:"required"`
-		Content    string `json:"content" binding:"required"`
+		ReceiverID string          `json:"receiver_id" binding:"required"`
+		MsgType    string          `json:"msg_type"` // 为空时为文本消息
+		Content    string          `json:"content"`  // 文本消息必填，其他类型为可选说明
+		Payload    json.RawMessage `json:"payload"`  // 非文本消息的结构化内容
 	}
 	var r req
 	if err := c.ShouldBindJSON(&r); err != nil {
@@ -43,7 +50,11 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}
 
 	// 发送消息
-	message, err := h.service.SendMessage(uint(userID), r.ReceiverID, r.Content)
+	message, err := h.service.SendMessage(uint(userID), r.ReceiverID, r.MsgType, r.Content, r.Payload)
+	if errors.Is(err, service.ErrBlocked) {
+		response.Blocked(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.BadRequest(c, err.Error())
 		return
@@ -69,28 +80,60 @@ func (h *MessageHandler) GetPrivateMessages(c *gin.Context) {
 		return
 	}
 
-	// 获取分页参数
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "20")
+	// 获取游标参数
+	beforeID, err := strconv.ParseUint(c.DefaultQuery("before_id", "0"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid before_id")
+		return
+	}
+	afterID, err := strconv.ParseUint(c.DefaultQuery("after_id", "0"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid after_id")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
 
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	// 获取消息历史
+	page, err := h.service.GetPrivateMessages(uint(userID), otherUserID, uint(beforeID), uint(afterID), limit)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
 	}
 
-	pageSize, err := strconv.Atoi(pageSizeStr)
-	if err != nil || pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	response.SuccessWithMessage(c, "获取消息历史成功", page)
+}
+
+// SyncPrivateMessages 按会话序号增量同步私聊消息
+func (h *MessageHandler) SyncPrivateMessages(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
 	}
 
-	// 获取消息历史
-	messages, err := h.service.GetPrivateMessages(uint(userID), otherUserID, page, pageSize)
+	// 获取同步参数
+	afterSeq, err := strconv.ParseUint(c.DefaultQuery("after_seq", "0"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid after_seq")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	messages, hasMore, err := h.service.SyncPrivateMessages(uint(userID), c.Param("user_id"), afterSeq, limit)
 	if err != nil {
 		response.BadRequest(c, err.Error())
 		return
 	}
 
-	response.SuccessWithMessage(c, "获取消息历史成功", messages)
+	response.SuccessWithMessage(c, "同步消息成功", syncResult(messages, hasMore, afterSeq))
 }
 
 // GetUnreadMessages 获取未读消息
@@ -189,6 +232,93 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 	response.SuccessWithMessage(c, "消息删除成功", nil)
 }
 
+// RecallMessage 撤回消息
+func (h *MessageHandler) RecallMessage(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 获取消息ID
+	messageID := c.Param("message_id")
+	if messageID == "" {
+		response.BadRequest(c, "message_id is required")
+		return
+	}
+
+	// 撤回消息
+	message, err := h.service.RecallMessage(messageID, uint(userID))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "消息撤回成功", message)
+}
+
+// EditMessage 编辑消息
+func (h *MessageHandler) EditMessage(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 获取消息ID
+	messageID := c.Param("message_id")
+	if messageID == "" {
+		response.BadRequest(c, "message_id is required")
+		return
+	}
+
+	// 绑定请求参数
+	type req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	// 编辑消息
+	message, err := h.service.EditMessage(messageID, uint(userID), r.Content)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "消息编辑成功", message)
+}
+
+// GetMessageRevisions 获取消息编辑历史
+func (h *MessageHandler) GetMessageRevisions(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	// 获取编辑历史
+	revisions, err := h.service.GetMessageRevisions(c.Param("message_id"), uint(userID))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "获取编辑历史成功", gin.H{
+		"revisions": revisions,
+		"total":     len(revisions),
+	})
+}
+
 // GetRecentConversations 获取最近对话
 func (h *MessageHandler) GetRecentConversations(c *gin.Context) {
 	// 获取当前用户ID
@@ -241,15 +371,9 @@ func (h *MessageHandler) GetConversationList(c *gin.Context) {
 	}
 
 	// 转换为响应格式
-	var conversationList []gin.H
-	for _, conv := range conversations {
-		conversationList = append(conversationList, gin.H{
-			"user_id":      conv.UserID,
-			"username":     conv.Username,
-			"last_message": conv.LastMessage,
-			"last_time":    conv.LastTime.Format("2006-01-02 15:04:05"),
-			"unread_count": conv.UnreadCount,
-		})
+	conversationList := make([]gin.H, 0, len(conversations))
+	for i := range conversations {
+		conversationList = append(conversationList, conversationResponse(&conversations[i]))
 	}
 
 	response.SuccessWithMessage(c, "获取对话列表成功", gin.H{
@@ -276,14 +400,32 @@ func (h *MessageHandler) MarkConversationAsRead(c *gin.Context) {
 		return
 	}
 
+	// 可选：只标记到指定消息ID / 序号为止，不传请求体时标记全部
+	var req struct {
+		UpToMsgID uint   `json:"up_to_msg_id"`
+		UpToSeq   uint64 `json:"up_to_seq"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(c, "invalid request body")
+		return
+	}
+
 	// 标记对话为已读
-	err = h.service.MarkConversationAsRead(uint(userID), uint(otherUserID))
+	rng, err := h.service.MarkConversationAsRead(uint(userID), uint(otherUserID), req.UpToMsgID, req.UpToSeq)
 	if err != nil {
 		response.InternalError(c, "标记对话为已读失败")
 		return
 	}
 
-	response.SuccessWithMessage(c, "标记对话为已读成功", nil)
+	data := gin.H{"read_count": 0}
+	if rng != nil {
+		data = gin.H{
+			"read_count":   rng.Count,
+			"up_to_msg_id": rng.MaxID,
+			"up_to_seq":    rng.MaxSeq,
+		}
+	}
+	response.SuccessWithMessage(c, "标记对话为已读成功", data)
 }
 
 // MarkAllAsRead 标记所有消息为已读
@@ -323,16 +465,34 @@ func (h *MessageHandler) GetOfflineMessages(c *gin.Context) {
 		return
 	}
 
-	// 转换为API格式
+	// 转换为API格式（与 WebSocket 推送的 chat / group_chat 消息字段一致）
 	var messageList []gin.H
 	for _, msg := range offlineMessages {
-		messageList = append(messageList, gin.H{
+		item := gin.H{
 			"id":         msg.ID,
+			"msg_id":     msg.ID,
 			"sender_id":  msg.SenderID,
 			"content":    msg.Content,
+			"msg_type":   model.MsgTypeText,
 			"type":       msg.Type,
 			"created_at": msg.CreatedAt.Format("2006-01-02 15:04:05"),
-		})
+		}
+		if msg.GroupID > 0 {
+			item["group_id"] = msg.GroupID
+		}
+		if msg.Seq > 0 {
+			item["seq"] = msg.Seq
+		}
+		if msg.MsgType != "" {
+			item["msg_type"] = msg.MsgType
+		}
+		if len(msg.Payload) > 0 {
+			item["payload"] = msg.Payload
+		}
+		if msg.Status != "" {
+			item["status"] = msg.Status
+		}
+		messageList = append(messageList, item)
 	}
 
 	response.SuccessWithMessage(c, "获取离线消息成功", gin.H{
@@ -382,3 +542,75 @@ func (h *MessageHandler) GetOfflineMessageCount(c *gin.Context) {
 		"count": count,
 	})
 }
+
+// SearchMessages 搜索消息
+// 参数: q 关键词（空格分隔，需全部匹配）、with 对方用户ID、from/to 日期范围（YYYY-MM-DD 或 RFC3339）、before_id 游标、limit
+func (h *MessageHandler) SearchMessages(c *gin.Context) {
+	// 获取当前用户ID
+	userIDStr := jwt.GetUserID(c)
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid user ID")
+		return
+	}
+
+	from, err := parseSearchTime(c.Query("from"), false)
+	if err != nil {
+		response.BadRequest(c, "invalid from")
+		return
+	}
+	to, err := parseSearchTime(c.Query("to"), true)
+	if err != nil {
+		response.BadRequest(c, "invalid to")
+		return
+	}
+	beforeID, err := strconv.ParseUint(c.DefaultQuery("before_id", "0"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "invalid before_id")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	page, err := h.service.SearchMessages(uint(userID), c.Query("q"), c.Query("with"), from, to, uint(beforeID), limit)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "搜索消息成功", page)
+}
+
+// parseSearchTime 解析搜索的日期参数，支持 YYYY-MM-DD（服务器本地时区）与 RFC3339
+// 日期格式的结束日期包含当天，转换为次日零点
+func parseSearchTime(value string, endOfRange bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfRange {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// syncResult 构造增量同步响应，latest_seq 为本次返回的最大序号，客户端以此作为下次的 after_seq
+func syncResult(messages []*model.Message, hasMore bool, afterSeq uint64) gin.H {
+	latestSeq := afterSeq
+	if len(messages) > 0 {
+		latestSeq = messages[len(messages)-1].Seq
+	}
+	return gin.H{
+		"messages":   messages,
+		"has_more":   hasMore,
+		"latest_seq": latestSeq,
+	}
+}
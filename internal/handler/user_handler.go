@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"im-system/internal/service"
 	"im-system/pkg/jwt"
@@ -11,34 +12,38 @@ import (
 )
 
 type UserHandler struct {
-	service *service.UserService
+	service       *service.UserService
+	friendService *service.FriendService
 }
 
-func NewUserHandler(s *service.UserService) *UserHandler {
-	return &UserHandler{service: s}
+func NewUserHandler(s *service.UserService, fs *service.FriendService) *UserHandler {
+	return &UserHandler{service: s, friendService: fs}
 }
 
 // Register 用户注册
 func (h *UserHandler) Register(c *gin.Context) {
 	type req struct {
-		Username string `json:"username" binding:"required"`
-		Email    string `json:"email"`
-		Password string `json:"password" binding:"required"`
+		Username   string `json:"username" binding:"required"`
+		Email      string `json:"email"`
+		Password   string `json:"password" binding:"required"`
+		DeviceName string `json:"device_name"`
 	}
 	var r req
 	if err := c.ShouldBindJSON(&r); err != nil {
 		response.BadRequest(c, err.Error())
 		return
 	}
-	user, token, err := h.service.Register(r.Username, r.Email, r.Password)
+	user, tokens, err := h.service.Register(r.Username, r.Email, r.Password, clientInfo(c, r.DeviceName))
 	if err != nil {
 		response.BadRequest(c, err.Error())
 		return
 	}
 
 	response.SuccessWithMessage(c, "注册成功", &response.RegisterResponse{
-		User:        response.FilterUserInfo(user),
-		AccessToken: token,
+		User:         response.FilterUserInfo(user),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
 	})
 }
 
@@ -47,24 +52,213 @@ func (h *UserHandler) Login(c *gin.Context) {
 	type req struct {
 		UsernameOrEmail string `json:"usernameOrEmail" binding:"required"`
 		Password        string `json:"password" binding:"required"`
+		DeviceName      string `json:"device_name"`
 	}
 	var r req
 	if err := c.ShouldBindJSON(&r); err != nil {
 		response.BadRequest(c, err.Error())
 		return
 	}
-	user, token, err := h.service.Login(r.UsernameOrEmail, r.Password)
+	user, tokens, err := h.service.Login(r.UsernameOrEmail, r.Password, clientInfo(c, r.DeviceName))
+	if loginRejected(c, err) {
+		return
+	}
 	if err != nil {
 		response.Unauthorized(c, err.Error())
 		return
 	}
 
 	response.SuccessWithMessage(c, "登录成功", &response.LoginResponse{
-		User:        response.FilterUserInfo(user),
-		AccessToken: token,
+		User:         response.FilterUserInfo(user),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
 	})
 }
 
+// RefreshToken 使用刷新令牌换取新的访问令牌与刷新令牌（旧的刷新令牌随即失效）
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	type req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	tokens, err := h.service.RefreshToken(r.RefreshToken, clientInfo(c, ""))
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		response.Unauthorized(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.InternalError(c, "刷新令牌失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "刷新令牌成功", &response.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	})
+}
+
+// ListSessions 获取当前用户的登录会话（需要JWT认证），current 标记发起请求的会话
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	var uid uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	sessions, err := h.service.ListSessions(uid)
+	if err != nil {
+		response.InternalError(c, "获取登录会话失败")
+		return
+	}
+
+	currentID := ""
+	if claims := jwt.GetClaims(c); claims != nil {
+		currentID = claims.SessionID
+	}
+	list := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, gin.H{
+			"id":           s.ID,
+			"device_name":  s.DeviceName,
+			"ip":           s.IP,
+			"user_agent":   s.UserAgent,
+			"created_at":   s.CreatedAt.Format("2006-01-02 15:04:05"),
+			"last_seen_at": s.LastSeenAt.Format("2006-01-02 15:04:05"),
+			"expires_at":   s.ExpiresAt.Format("2006-01-02 15:04:05"),
+			"current":      s.ID == currentID,
+		})
+	}
+	response.SuccessWithMessage(c, "获取登录会话成功", gin.H{
+		"sessions": list,
+		"total":    len(list),
+	})
+}
+
+// KickSession 吊销指定的登录会话（需要JWT认证）：令牌失效，该会话的WebSocket连接被断开
+func (h *UserHandler) KickSession(c *gin.Context) {
+	var uid uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	err := h.service.KickSession(uid, c.Param("id"))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		response.NotFound(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.InternalError(c, "吊销登录会话失败")
+		return
+	}
+	response.SuccessWithMessage(c, "登录会话已吊销", nil)
+}
+
+// ChangePassword 修改密码（需要JWT认证与原密码），成功后其他登录会话被吊销，当前会话保持登录
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	type req struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	var uid uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	sessionID := ""
+	if claims := jwt.GetClaims(c); claims != nil {
+		sessionID = claims.SessionID
+	}
+
+	err := h.service.ChangePassword(uid, sessionID, r.OldPassword, r.NewPassword, clientInfo(c, ""))
+	if loginRejected(c, err) {
+		return
+	}
+	switch {
+	case err == nil:
+		response.SuccessWithMessage(c, "修改密码成功", nil)
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrSamePassword), errors.Is(err, service.ErrWeakPassword):
+		response.BadRequest(c, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		response.NotFound(c, err.Error())
+	default:
+		response.InternalError(c, "修改密码失败")
+	}
+}
+
+// ForgotPassword 申请重置密码：向注册邮箱发送一次性的重置令牌
+// 无论邮箱是否注册都返回成功
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	type req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if err := h.service.RequestPasswordReset(r.Email, clientInfo(c, "")); err != nil {
+		response.InternalError(c, "申请重置密码失败")
+		return
+	}
+	response.SuccessWithMessage(c, "如果该邮箱已注册，重置密码邮件已发送", nil)
+}
+
+// ResetPassword 使用重置令牌设置新密码，成功后该用户的所有登录会话被吊销
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	type req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	var r req
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	err := h.service.ResetPassword(r.Token, r.NewPassword, clientInfo(c, ""))
+	switch {
+	case err == nil:
+		response.SuccessWithMessage(c, "重置密码成功，请重新登录", nil)
+	case errors.Is(err, service.ErrInvalidResetToken), errors.Is(err, service.ErrWeakPassword):
+		response.BadRequest(c, err.Error())
+	default:
+		response.InternalError(c, "重置密码失败")
+	}
+}
+
+// loginRejected 登录被限制（退避或锁定）时写入响应并返回 true
+func loginRejected(c *gin.Context, err error) bool {
+	var blocked *service.LoginBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	if errors.Is(blocked, service.ErrLoginLocked) {
+		response.LoginRejected(c, response.CodeLoginLocked, "登录失败次数过多，账号已被临时锁定", blocked.RetrySeconds())
+	} else {
+		response.LoginRejected(c, response.CodeLoginThrottled, "登录失败次数过多，请稍后再试", blocked.RetrySeconds())
+	}
+	return true
+}
+
+// clientInfo 从请求中提取客户端信息
+// IP 用于登录失败计数：路由只信任 Server.TrustedProxies 中的代理，其他请求的 ClientIP 即连接的对端地址，无法通过 X-Forwarded-For 伪造
+func clientInfo(c *gin.Context, deviceName string) *service.ClientInfo {
+	return &service.ClientInfo{
+		DeviceName: deviceName,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+}
+
 // GetProfile 获取用户资料（需要JWT认证）
 func (h *UserHandler) GetProfile(c *gin.Context) {
 	// 从JWT中间件设置的Context中获取用户信息
@@ -108,7 +302,7 @@ func (h *UserHandler) TestAuth(c *gin.Context) {
 	})
 }
 
-// Logout 用户登出（需要JWT认证）：仅更新在线状态为offline
+// Logout 用户登出（需要JWT认证）：吊销当前令牌与登录会话，并更新在线状态为offline
 func (h *UserHandler) Logout(c *gin.Context) {
 	userIDStr := jwt.GetUserID(c)
 	if userIDStr == "" {
@@ -121,15 +315,26 @@ func (h *UserHandler) Logout(c *gin.Context) {
 		response.BadRequest(c, "invalid user id")
 		return
 	}
-	if err := h.service.Logout(uid); err != nil {
+	if err := h.service.Logout(uid, jwt.GetClaims(c)); err != nil {
 		response.InternalError(c, "登出失败")
 		return
 	}
 	response.SuccessWithMessage(c, "已离线", nil)
 }
 
-// GetOnlineUsers 获取在线用户列表（需要JWT认证）
+// GetOnlineUsers 获取在线用户列表（需要JWT认证），不包含存在拉黑关系的用户
 func (h *UserHandler) GetOnlineUsers(c *gin.Context) {
+	var uid uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	hidden, err := h.friendService.GetBlockRelatedIDs(uid)
+	if err != nil {
+		response.InternalError(c, "获取在线用户失败")
+		return
+	}
+
 	// 获取在线用户详细信息
 	presences, err := redis.GetOnlineUsersWithDetails()
 	if err != nil {
@@ -140,6 +345,9 @@ func (h *UserHandler) GetOnlineUsers(c *gin.Context) {
 	// 转换为响应格式
 	var onlineUsers []gin.H
 	for _, presence := range presences {
+		if hidden[presence.UserID] {
+			continue
+		}
 		onlineUsers = append(onlineUsers, gin.H{
 			"user_id":   presence.UserID,
 			"username":  presence.Username,
@@ -170,6 +378,22 @@ func (h *UserHandler) CheckUserOnline(c *gin.Context) {
 		return
 	}
 
+	// 存在拉黑关系时不返回对方在线状态
+	var uid uint
+	if _, err := fmt.Sscanf(jwt.GetUserID(c), "%d", &uid); err != nil {
+		response.BadRequest(c, "invalid user id")
+		return
+	}
+	blocked, err := h.friendService.IsBlocked(uid, userID)
+	if err != nil {
+		response.InternalError(c, "检查用户在线状态失败")
+		return
+	}
+	if blocked {
+		response.Blocked(c, service.ErrBlocked.Error())
+		return
+	}
+
 	// 检查是否在线
 	online, err := redis.IsUserOnline(userID)
 	if err != nil {
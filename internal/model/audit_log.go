@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// 审计事件
+const (
+	AuditLoginLocked   = "login_locked"    // 账号因连续登录失败被锁定
+	AuditLoginIPLocked = "login_ip_locked" // 来源IP因登录失败过多被锁定
+	AuditLoginUnlocked = "login_unlocked"  // 管理员解除账号锁定
+
+	AuditPasswordChanged        = "password_changed"         // 用户修改密码
+	AuditPasswordResetRequested = "password_reset_requested" // 发送重置密码邮件
+	AuditPasswordReset          = "password_reset"           // 通过邮件令牌重置密码
+)
+
+// AuditLog 安全审计日志
+// UserID: 事件涉及的用户（IP锁定时为0）；ActorID: 操作者（系统触发时为0）
+
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	Action    string    `gorm:"type:varchar(32);not null;index;comment:事件"`
+	UserID    uint      `gorm:"not null;default:0;index;comment:涉及的用户ID"`
+	ActorID   uint      `gorm:"not null;default:0;comment:操作者ID"`
+	IP        string    `gorm:"type:varchar(64);not null;default:'';comment:IP地址"`
+	Detail    string    `gorm:"type:varchar(255);not null;default:'';comment:详情"`
+	CreatedAt time.Time `gorm:"index;comment:发生时间"`
+}
+
+func (AuditLog) TableName() string { return "audit_log" }
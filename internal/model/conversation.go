@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// 会话类型（与 Message.SessionType 一致）
+const (
+	ConversationPrivate = 1 // 私聊
+	ConversationGroup   = 2 // 群聊
+)
+
+// Conversation 会话
+// Key: 会话唯一标识，私聊为 private:{小ID}:{大ID}，群聊为 group:{群ID}
+// LastMessageID / LastMessageAt: 最后一条消息，用于会话列表排序与展示
+
+type Conversation struct {
+	ID            uint       `gorm:"primaryKey"`
+	Type          int        `gorm:"type:int;not null;default:1;comment:会话类型(1单聊,2群聊)"`
+	Key           string     `gorm:"column:conv_key;type:varchar(64);not null;uniqueIndex;comment:会话唯一标识"`
+	GroupID       *uint      `gorm:"index;comment:群ID(群聊)"`
+	LastMessageID uint       `gorm:"not null;default:0;comment:最后一条消息ID"`
+	LastMessageAt *time.Time `gorm:"comment:最后一条消息时间"`
+	CreatedAt     time.Time  `gorm:"comment:创建时间"`
+	UpdatedAt     time.Time  `gorm:"comment:更新时间"`
+}
+
+func (Conversation) TableName() string { return "conversation" }
+
+// ConversationMember 用户在会话中的个人设置
+// PeerID: 私聊的对方用户ID（群聊为0），按对方查找会话
+// Pinned / PinnedAt: 置顶的会话排在列表最前，多个置顶会话按置顶时间倒序
+// Muted: 免打扰；Archived: 归档的会话不出现在会话列表中，收到新消息时（免打扰的除外）自动取消归档
+// LastReadMsgID / LastReadSeq: 已读到的对方消息位置
+// Draft / DraftUpdatedAt: 未发送的草稿，多设备间同步
+
+type ConversationMember struct {
+	ConversationID uint       `gorm:"primaryKey;comment:会话ID"`
+	UserID         uint       `gorm:"primaryKey;index:idx_conversation_member_user_peer,priority:1;comment:用户ID"`
+	PeerID         uint       `gorm:"not null;default:0;index:idx_conversation_member_user_peer,priority:2;comment:私聊对方用户ID"`
+	Pinned         bool       `gorm:"not null;default:false;comment:是否置顶"`
+	PinnedAt       *time.Time `gorm:"comment:置顶时间"`
+	Muted          bool       `gorm:"not null;default:false;comment:是否免打扰"`
+	Archived       bool       `gorm:"not null;default:false;comment:是否归档"`
+	Title          string     `gorm:"type:varchar(64);not null;default:'';comment:自定义会话名称"`
+	LastReadMsgID  uint       `gorm:"not null;default:0;comment:已读到的消息ID"`
+	LastReadSeq    uint64     `gorm:"not null;default:0;comment:已读到的会话序号"`
+	Draft          string     `gorm:"type:text;comment:草稿"`
+	DraftUpdatedAt *time.Time `gorm:"comment:草稿更新时间"`
+	CreatedAt      time.Time  `gorm:"comment:加入时间"`
+	UpdatedAt      time.Time  `gorm:"comment:更新时间"`
+}
+
+func (ConversationMember) TableName() string { return "conversation_member" }
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+)
+
+// File 附件（按内容寻址）
+// ID 为文件内容的 SHA-256（十六进制），相同内容只存储一份
+// 图片会在后台提取尺寸并生成缩略图，MediaStatus 记录处理进度（非图片为空）
+
+type File struct {
+	ID          string    `gorm:"type:char(64);primaryKey;comment:内容SHA-256"`
+	Size        int64     `gorm:"not null;comment:文件大小(字节)"`
+	Mime        string    `gorm:"type:varchar(128);comment:MIME类型"`
+	Width       int       `gorm:"default:0;comment:图片宽度(按拍摄方向校正)"`
+	Height      int       `gorm:"default:0;comment:图片高度(按拍摄方向校正)"`
+	MediaStatus string    `gorm:"type:varchar(16);index;comment:图片处理状态"`
+	CreatedAt   time.Time `gorm:"comment:首次上传时间"`
+	UpdatedAt   time.Time `gorm:"comment:更新时间"`
+}
+
+func (File) TableName() string { return "file" }
+
+// 图片处理状态
+const (
+	MediaStatusPending    = "pending"    // 等待处理
+	MediaStatusProcessing = "processing" // 处理中
+	MediaStatusReady      = "ready"      // 已完成
+	MediaStatusFailed     = "failed"     // 处理失败（无法解码或超出像素上限）
+)
+
+// FileThumbnail 图片缩略图
+// Size 为规格（长边不超过的像素数），原图长边不大于该规格时不生成
+
+type FileThumbnail struct {
+	FileID string `gorm:"type:char(64);primaryKey;comment:附件ID"`
+	Size   int    `gorm:"primaryKey;comment:规格(长边像素)"`
+	Width  int    `gorm:"not null;comment:宽度"`
+	Height int    `gorm:"not null;comment:高度"`
+	Mime   string `gorm:"type:varchar(32);comment:MIME类型"`
+	Bytes  int64  `gorm:"not null;comment:文件大小(字节)"`
+}
+
+func (FileThumbnail) TableName() string { return "file_thumbnail" }
+
+// FileUpload 用户上传记录
+// 同一文件被多个用户上传时各保留一条，上传者可随时下载自己上传过的文件
+
+type FileUpload struct {
+	ID        uint      `gorm:"primaryKey"`
+	FileID    string    `gorm:"type:char(64);not null;uniqueIndex:idx_file_user;comment:附件ID"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_file_user;index;comment:上传者ID"`
+	Name      string    `gorm:"type:varchar(255);comment:上传时的文件名"`
+	CreatedAt time.Time `gorm:"comment:上传时间"`
+}
+
+func (FileUpload) TableName() string { return "file_upload" }
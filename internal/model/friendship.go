@@ -6,8 +6,16 @@ import (
 	"gorm.io/gorm"
 )
 
+// 好友关系状态
+const (
+	FriendshipPending  = "pending"  // 待处理的好友请求
+	FriendshipAccepted = "accepted" // 已成为好友
+	FriendshipBlocked  = "blocked"  // 已拉黑
+)
+
 // Friendship 好友关系
 // Status: pending/accepted/blocked
+// UserID 为发起方（请求发送者），FriendID 为接收方；好友关系双向共用一行
 
 type Friendship struct {
 	ID        uint           `gorm:"primaryKey"`
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 群成员角色
+const (
+	GroupRoleOwner  = "owner"  // 群主
+	GroupRoleAdmin  = "admin"  // 管理员
+	GroupRoleMember = "member" // 普通成员
+)
+
+// Group 群组模型
+// OwnerID 为当前群主，转让群主时同步更新
+
+type Group struct {
+	ID        uint           `gorm:"primaryKey"`
+	Name      string         `gorm:"type:varchar(64);not null;comment:群名称"`
+	OwnerID   uint           `gorm:"not null;index;comment:群主ID"`
+	Avatar    string         `gorm:"type:varchar(255);comment:群头像URL"`
+	Notice    string         `gorm:"type:varchar(512);comment:群公告"`
+	CreatedAt time.Time      `gorm:"comment:创建时间"`
+	UpdatedAt time.Time      `gorm:"comment:更新时间"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// TableName 指定表名（group 为 MySQL 保留字，这里加前缀）
+func (Group) TableName() string { return "im_group" }
+
+// GroupMember 群成员模型
+// Role: owner/admin/member
+
+type GroupMember struct {
+	ID        uint      `gorm:"primaryKey"`
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_group_user;comment:群ID"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_group_user;index;comment:用户ID"`
+	Role      string    `gorm:"type:varchar(32);default:'member';comment:成员角色"`
+	CreatedAt time.Time `gorm:"comment:加入时间"`
+	UpdatedAt time.Time `gorm:"comment:更新时间"`
+}
+
+func (GroupMember) TableName() string { return "group_member" }
@@ -1,28 +1,75 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// 消息类型
+const (
+	MsgTypeText     = "text"     // 文本
+	MsgTypeImage    = "image"    // 图片
+	MsgTypeFile     = "file"     // 文件
+	MsgTypeVoice    = "voice"    // 语音
+	MsgTypeLocation = "location" // 位置
+	MsgTypeCard     = "card"     // 链接/卡片
+)
+
 // Message 消息模型
 // SessionType: 1-单聊 2-群聊
-// Status: sent/delivered/read
+// Status: sent/delivered/read/recalled（撤回后内容清空，仅保留占位记录）
+// Payload: 非文本消息的结构化内容（JSON），Content 保存说明文字或 "[图片]" 等摘要
+// FileID: 图片/文件/语音消息引用的附件，会话参与者据此获得该附件的下载权限
+// Seq: 会话内单调递增序号（私聊按双方、群聊按群计数），用于客户端检测并补齐缺失消息
+// ConvKey: 会话标识（private:{小ID}:{大ID} / group:{群ID}），(ConvKey, Seq) 唯一；
+// 唯一索引由 MessageRepository.MigrateSeq 在补齐历史数据后创建，不能由 AutoMigrate 直接创建
 
 type Message struct {
-	ID          uint           `gorm:"primaryKey"`
-	SessionType int            `gorm:"type:int;not null;default:1;comment:会话类型(1单聊,2群聊)"`
-	SenderID    uint           `gorm:"not null;index;comment:发送者ID"`
-	ReceiverID  uint           `gorm:"index;comment:接收者ID(单聊)"`
-	GroupID     *uint          `gorm:"index;comment:群ID(群聊)"`
-	Content     string         `gorm:"type:text;not null;comment:消息内容"`
-	MsgType     string         `gorm:"type:varchar(32);default:'text';comment:消息类型"`
-	Status      string         `gorm:"type:varchar(32);default:'sent';comment:消息状态"`
-	IsRead      bool           `gorm:"default:false;comment:是否已读"`
-	CreatedAt   time.Time      `gorm:"comment:创建时间"`
-	UpdatedAt   time.Time      `gorm:"comment:更新时间"`
-	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	ID          uint            `gorm:"primaryKey"`
+	SessionType int             `gorm:"type:int;not null;default:1;comment:会话类型(1单聊,2群聊)"`
+	SenderID    uint            `gorm:"not null;index;comment:发送者ID"`
+	ReceiverID  uint            `gorm:"index;comment:接收者ID(单聊)"`
+	GroupID     *uint           `gorm:"index;comment:群ID(群聊)"`
+	ConvKey     string          `gorm:"type:varchar(64);not null;default:'';comment:会话标识"`
+	Seq         uint64          `gorm:"not null;default:0;comment:会话内序号"`
+	Content     string          `gorm:"type:text;not null;comment:消息内容"`
+	MsgType     string          `gorm:"type:varchar(32);default:'text';comment:消息类型"`
+	Payload     json.RawMessage `gorm:"type:json;comment:结构化消息内容"`
+	FileID      string          `gorm:"type:char(64);index;comment:引用的附件ID"`
+	Status      string          `gorm:"type:varchar(32);default:'sent';comment:消息状态"`
+	IsRead      bool            `gorm:"default:false;comment:是否已读"`
+	RecalledAt  *time.Time      `gorm:"comment:撤回时间"`
+	EditedAt    *time.Time      `gorm:"comment:最后编辑时间"`
+	CreatedAt   time.Time       `gorm:"comment:创建时间"`
+	UpdatedAt   time.Time       `gorm:"comment:更新时间"`
+	DeletedAt   gorm.DeletedAt  `gorm:"index"`
 }
 
 func (Message) TableName() string { return "message" }
+
+// ConversationKey 消息所在会话的标识（与双方顺序无关）
+func (m *Message) ConversationKey() string {
+	if m.GroupID != nil {
+		return fmt.Sprintf("group:%d", *m.GroupID)
+	}
+	low, high := m.SenderID, m.ReceiverID
+	if low > high {
+		low, high = high, low
+	}
+	return fmt.Sprintf("private:%d:%d", low, high)
+}
+
+// MessageRevision 消息修订记录
+// 每次编辑前保存被替换的内容，按创建时间即可还原编辑历史
+
+type MessageRevision struct {
+	ID        uint      `gorm:"primaryKey"`
+	MessageID uint      `gorm:"not null;index;comment:消息ID"`
+	Content   string    `gorm:"type:text;not null;comment:编辑前的内容"`
+	CreatedAt time.Time `gorm:"comment:编辑时间"`
+}
+
+func (MessageRevision) TableName() string { return "message_revision" }
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// UserSession 登录会话（每次登录一条记录，刷新令牌时沿用）
+// ID: 会话ID，即令牌中的 sid
+// TokenID: 当前访问令牌的 jti，每次刷新令牌时更新
+// LastSeenAt: 最近活跃时间（刷新令牌、建立WebSocket连接时更新）
+// ExpiresAt: 当前刷新令牌的过期时间，过期后会话失效
+// RevokedAt / RevokeReason: 登出或被踢下线的时间与原因
+
+type UserSession struct {
+	ID           string     `gorm:"type:varchar(32);primaryKey;comment:会话ID"`
+	UserID       uint       `gorm:"not null;index;comment:用户ID"`
+	TokenID      string     `gorm:"column:jti;type:varchar(32);not null;index;comment:当前访问令牌ID"`
+	DeviceName   string     `gorm:"type:varchar(64);not null;default:'';comment:设备名称"`
+	IP           string     `gorm:"type:varchar(64);not null;default:'';comment:IP地址"`
+	UserAgent    string     `gorm:"type:varchar(255);not null;default:'';comment:User-Agent"`
+	LastSeenAt   time.Time  `gorm:"comment:最近活跃时间"`
+	ExpiresAt    time.Time  `gorm:"comment:过期时间"`
+	RevokedAt    *time.Time `gorm:"comment:吊销时间"`
+	RevokeReason string     `gorm:"type:varchar(32);not null;default:'';comment:吊销原因"`
+	CreatedAt    time.Time  `gorm:"comment:登录时间"`
+	UpdatedAt    time.Time  `gorm:"comment:更新时间"`
+}
+
+func (UserSession) TableName() string { return "user_session" }
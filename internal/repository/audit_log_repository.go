@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// AuditLogRepository 审计日志数据仓储
+type AuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository 创建AuditLogRepository实例
+func NewAuditLogRepository(db *gorm.DB) *AuditLogRepository {
+	return &AuditLogRepository{db: db}
+}
+
+// Create 写入审计日志
+func (r *AuditLogRepository) Create(entry *model.AuditLog) error {
+	return r.db.Create(entry).Error
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationEntry 用户会话列表中的一项：个人设置 + 会话的最后一条消息
+type ConversationEntry struct {
+	model.ConversationMember
+	Type          int
+	GroupID       *uint
+	LastMessageID uint
+	LastMessageAt *time.Time
+}
+
+// ConversationRepository 会话数据仓储
+type ConversationRepository struct {
+	db *gorm.DB
+}
+
+// NewConversationRepository 创建ConversationRepository实例
+func NewConversationRepository(db *gorm.DB) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+// PrivateConversationKey 私聊会话唯一标识（与双方顺序无关）
+func PrivateConversationKey(userID1, userID2 uint) string {
+	if userID1 > userID2 {
+		userID1, userID2 = userID2, userID1
+	}
+	return fmt.Sprintf("private:%d:%d", userID1, userID2)
+}
+
+// GetOrCreatePrivate 获取两个用户之间的私聊会话，不存在时创建；双方的会话成员记录不存在时一并创建
+func (r *ConversationRepository) GetOrCreatePrivate(userID, peerID uint) (*model.Conversation, error) {
+	return r.getOrCreatePrivate(userID, peerID, true)
+}
+
+// OpenPrivate 获取两个用户之间的私聊会话，不存在时创建；只创建 userID 的会话成员记录
+// 对方的成员记录在收到第一条消息时才创建（TouchPrivate），打开会话、保存草稿不会出现在对方的会话列表中
+func (r *ConversationRepository) OpenPrivate(userID, peerID uint) (*model.Conversation, error) {
+	return r.getOrCreatePrivate(userID, peerID, false)
+}
+
+// getOrCreatePrivate 获取或创建私聊会话及 userID 的成员记录，withPeer 为 true 时同时创建对方的成员记录
+func (r *ConversationRepository) getOrCreatePrivate(userID, peerID uint, withPeer bool) (*model.Conversation, error) {
+	conv := &model.Conversation{
+		Type: model.ConversationPrivate,
+		Key:  PrivateConversationKey(userID, peerID),
+	}
+	// 并发创建时只有一条生效，其余读取已存在的记录
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(conv).Error; err != nil {
+		return nil, err
+	}
+	if conv.ID == 0 {
+		if err := r.db.Where("conv_key = ?", conv.Key).First(conv).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	members := []*model.ConversationMember{
+		{ConversationID: conv.ID, UserID: userID, PeerID: peerID},
+	}
+	if withPeer {
+		members = append(members, &model.ConversationMember{ConversationID: conv.ID, UserID: peerID, PeerID: userID})
+	}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error; err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// TouchPrivate 私聊有新消息时更新会话的最后一条消息
+// 发送者的会话取消归档；接收者未设置免打扰时同样取消归档，已删除的会话重新出现在双方列表中
+func (r *ConversationRepository) TouchPrivate(message *model.Message) error {
+	conv, err := r.GetOrCreatePrivate(message.SenderID, message.ReceiverID)
+	if err != nil {
+		return err
+	}
+	if err := r.setLastMessage(conv.ID, message.ID, message.CreatedAt); err != nil {
+		return err
+	}
+	return r.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND archived = ? AND (user_id = ? OR muted = ?)", conv.ID, true, message.SenderID, false).
+		Update("archived", false).Error
+}
+
+// setLastMessage 更新会话的最后一条消息（只会向更新的消息推进）
+func (r *ConversationRepository) setLastMessage(conversationID, messageID uint, at time.Time) error {
+	return r.db.Model(&model.Conversation{}).
+		Where("id = ? AND last_message_id < ?", conversationID, messageID).
+		Updates(map[string]interface{}{
+			"last_message_id": messageID,
+			"last_message_at": at,
+		}).Error
+}
+
+// entries 会话列表查询：会话成员记录关联会话
+func (r *ConversationRepository) entries() *gorm.DB {
+	return r.db.Table("conversation_member AS m").
+		Select("m.*, c.type, c.group_id, c.last_message_id, c.last_message_at").
+		Joins("JOIN conversation AS c ON c.id = m.conversation_id")
+}
+
+// ListByUser 获取用户的会话列表
+// archived 为 false 时返回未归档的会话，置顶的在前（按置顶时间倒序），其余按最后一条消息时间倒序
+func (r *ConversationRepository) ListByUser(userID uint, archived bool, limit int) ([]*ConversationEntry, error) {
+	var entries []*ConversationEntry
+	err := r.entries().
+		Where("m.user_id = ? AND m.archived = ?", userID, archived).
+		Order("m.pinned DESC, m.pinned_at DESC, c.last_message_at DESC, c.id DESC").
+		Limit(limit).
+		Scan(&entries).Error
+	return entries, err
+}
+
+// GetPrivate 获取用户与指定用户的私聊会话，不存在（或已从用户的会话列表删除）时返回 nil
+func (r *ConversationRepository) GetPrivate(userID, peerID uint) (*ConversationEntry, error) {
+	var entry ConversationEntry
+	err := r.entries().
+		Where("m.user_id = ? AND m.peer_id = ? AND c.type = ?", userID, peerID, model.ConversationPrivate).
+		Take(&entry).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// UpdateMember 更新用户在会话中的设置
+func (r *ConversationRepository) UpdateMember(conversationID, userID uint, updates map[string]interface{}) error {
+	return r.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Updates(updates).Error
+}
+
+// DeleteMember 从用户的会话列表中删除会话（不删除消息，有新消息时重新出现）
+func (r *ConversationRepository) DeleteMember(conversationID, userID uint) error {
+	return r.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Delete(&model.ConversationMember{}).Error
+}
+
+// UpdatePrivateLastRead 更新用户在与指定用户私聊中的已读位置（只会向更新的消息推进）
+func (r *ConversationRepository) UpdatePrivateLastRead(userID, peerID, messageID uint, seq uint64) error {
+	return r.db.Model(&model.ConversationMember{}).
+		Where("user_id = ? AND peer_id = ? AND last_read_msg_id < ?", userID, peerID, messageID).
+		Updates(map[string]interface{}{
+			"last_read_msg_id": messageID,
+			"last_read_seq":    seq,
+		}).Error
+}
+
+// SetPrivateDraft 保存用户在与指定用户私聊中的草稿，content 为空时清空草稿
+func (r *ConversationRepository) SetPrivateDraft(userID, peerID uint, content string, at time.Time) error {
+	return r.db.Model(&model.ConversationMember{}).
+		Where("user_id = ? AND peer_id = ?", userID, peerID).
+		Updates(map[string]interface{}{
+			"draft":            content,
+			"draft_updated_at": at,
+		}).Error
+}
+
+// BackfillPrivate 为会话表启用前已有的私聊消息创建会话（会话表为空时执行）
+func (r *ConversationRepository) BackfillPrivate() error {
+	var count int64
+	if err := r.db.Model(&model.Conversation{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	var pairs []struct {
+		UserLow       uint
+		UserHigh      uint
+		LastMessageID uint
+		LastMessageAt time.Time
+	}
+	err := r.db.Model(&model.Message{}).
+		Select("LEAST(sender_id, receiver_id) AS user_low, GREATEST(sender_id, receiver_id) AS user_high, MAX(id) AS last_message_id, MAX(created_at) AS last_message_at").
+		Where("group_id IS NULL").
+		Group("user_low, user_high").
+		Scan(&pairs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pairs {
+		conv, err := r.GetOrCreatePrivate(p.UserLow, p.UserHigh)
+		if err != nil {
+			return err
+		}
+		if err := r.setLastMessage(conv.ID, p.LastMessageID, p.LastMessageAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FileRepository 附件数据仓储
+type FileRepository struct {
+	db *gorm.DB
+}
+
+// NewFileRepository 创建FileRepository实例
+func NewFileRepository(db *gorm.DB) *FileRepository {
+	return &FileRepository{db: db}
+}
+
+// Create 创建附件记录，相同内容并发上传时只保留一条
+func (r *FileRepository) Create(file *model.File) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(file).Error
+}
+
+// GetByID 根据ID获取附件
+func (r *FileRepository) GetByID(id string) (*model.File, error) {
+	var file model.File
+	err := r.db.Where("id = ?", id).First(&file).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// AddUpload 记录用户上传，重复上传同一文件时更新文件名
+func (r *FileRepository) AddUpload(upload *model.FileUpload) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name"}),
+	}).Create(upload).Error
+}
+
+// GetUpload 获取用户对指定附件的上传记录
+func (r *FileRepository) GetUpload(fileID string, userID uint) (*model.FileUpload, error) {
+	var upload model.FileUpload
+	err := r.db.Where("file_id = ? AND user_id = ?", fileID, userID).First(&upload).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// GetFirstUpload 获取附件最早的上传记录（用于确定下载文件名）
+func (r *FileRepository) GetFirstUpload(fileID string) (*model.FileUpload, error) {
+	var upload model.FileUpload
+	err := r.db.Where("file_id = ?", fileID).Order("id ASC").First(&upload).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// IsReferencedFor 判断附件是否被用户参与的会话中的消息引用（已撤回的消息不计）
+// 私聊为发送者或接收者，群聊为当前群成员
+func (r *FileRepository) IsReferencedFor(fileID string, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Message{}).
+		Where("file_id = ? AND status <> ?", fileID, "recalled").
+		Where(
+			r.db.Where("sender_id = ?", userID).
+				Or("group_id IS NULL AND receiver_id = ?", userID).
+				Or("group_id IN (?)", r.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)),
+		).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListMediaPending 获取待处理的图片ID
+// 包括等待处理的、处理中但超时未完成的（处理节点异常退出），以及启用缩略图前上传、尚未处理过的图片
+func (r *FileRepository) ListMediaPending(mimes []string, staleBefore time.Time, limit int) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&model.File{}).
+		Where("media_status = ?", model.MediaStatusPending).
+		Or("media_status = ? AND updated_at < ?", model.MediaStatusProcessing, staleBefore).
+		Or("media_status = '' AND mime IN ?", mimes).
+		Order("created_at ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ClaimMedia 将图片标记为处理中，多个节点同时处理时只有一个能成功
+func (r *FileRepository) ClaimMedia(id string, mimes []string, staleBefore time.Time) (bool, error) {
+	result := r.db.Model(&model.File{}).
+		Where("id = ?", id).
+		Where(
+			r.db.Where("media_status = ?", model.MediaStatusPending).
+				Or("media_status = ? AND updated_at < ?", model.MediaStatusProcessing, staleBefore).
+				Or("media_status = '' AND mime IN ?", mimes),
+		).
+		Updates(map[string]interface{}{"media_status": model.MediaStatusProcessing, "updated_at": time.Now()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// SaveMediaResult 保存图片尺寸与缩略图记录，并标记为处理完成
+func (r *FileRepository) SaveMediaResult(id string, width, height int, thumbnails []model.FileThumbnail) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", id).Delete(&model.FileThumbnail{}).Error; err != nil {
+			return err
+		}
+		if len(thumbnails) > 0 {
+			if err := tx.Create(&thumbnails).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.File{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"width":        width,
+			"height":       height,
+			"media_status": model.MediaStatusReady,
+		}).Error
+	})
+}
+
+// SetMediaStatus 更新图片处理状态
+func (r *FileRepository) SetMediaStatus(id, status string) error {
+	return r.db.Model(&model.File{}).Where("id = ?", id).Update("media_status", status).Error
+}
+
+// GetThumbnails 获取附件的缩略图（按规格升序）
+func (r *FileRepository) GetThumbnails(fileID string) ([]model.FileThumbnail, error) {
+	var thumbnails []model.FileThumbnail
+	err := r.db.Where("file_id = ?", fileID).Order("size ASC").Find(&thumbnails).Error
+	return thumbnails, err
+}
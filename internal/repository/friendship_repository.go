@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"errors"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// FriendshipRepository 好友关系数据仓储
+type FriendshipRepository struct {
+	db *gorm.DB
+}
+
+// NewFriendshipRepository 创建FriendshipRepository实例
+func NewFriendshipRepository(db *gorm.DB) *FriendshipRepository {
+	return &FriendshipRepository{db: db}
+}
+
+// Create 创建好友关系记录
+func (r *FriendshipRepository) Create(friendship *model.Friendship) error {
+	return r.db.Create(friendship).Error
+}
+
+// GetByID 根据ID获取好友关系记录
+func (r *FriendshipRepository) GetByID(id uint) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.db.First(&friendship, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("friend request not found")
+		}
+		return nil, err
+	}
+	return &friendship, nil
+}
+
+// GetFriendship 获取两个用户之间的好友请求或好友关系（双向，不含拉黑记录）
+func (r *FriendshipRepository) GetFriendship(userID, otherUserID uint) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.db.Where(
+		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status IN ?",
+		userID, otherUserID, otherUserID, userID,
+		[]string{model.FriendshipPending, model.FriendshipAccepted},
+	).First(&friendship).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &friendship, nil
+}
+
+// UpdateStatus 更新关系状态
+func (r *FriendshipRepository) UpdateStatus(id uint, status string) error {
+	return r.db.Model(&model.Friendship{}).
+		Where("id = ?", id).
+		Update("status", status).Error
+}
+
+// Delete 删除关系记录（软删除）
+func (r *FriendshipRepository) Delete(id uint) error {
+	return r.db.Delete(&model.Friendship{}, id).Error
+}
+
+// GetFriendIDs 获取用户的好友ID列表
+func (r *FriendshipRepository) GetFriendIDs(userID uint) ([]uint, error) {
+	var friendships []*model.Friendship
+	err := r.db.Where("(user_id = ? OR friend_id = ?) AND status = ?", userID, userID, model.FriendshipAccepted).
+		Find(&friendships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(friendships))
+	for _, f := range friendships {
+		if f.UserID == userID {
+			ids = append(ids, f.FriendID)
+		} else {
+			ids = append(ids, f.UserID)
+		}
+	}
+	return ids, nil
+}
+
+// GetReceivedRequests 获取用户收到的待处理好友请求
+func (r *FriendshipRepository) GetReceivedRequests(userID uint) ([]*model.Friendship, error) {
+	var requests []*model.Friendship
+	err := r.db.Where("friend_id = ? AND status = ?", userID, model.FriendshipPending).
+		Order("created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// GetSentRequests 获取用户发出的待处理好友请求
+func (r *FriendshipRepository) GetSentRequests(userID uint) ([]*model.Friendship, error) {
+	var requests []*model.Friendship
+	err := r.db.Where("user_id = ? AND status = ?", userID, model.FriendshipPending).
+		Order("created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// Block 拉黑用户：在同一事务中解除双方已有的好友请求或好友关系，并写入拉黑记录
+func (r *FriendshipRepository) Block(userID, targetID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(
+			"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status IN ?",
+			userID, targetID, targetID, userID,
+			[]string{model.FriendshipPending, model.FriendshipAccepted},
+		).Delete(&model.Friendship{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.Friendship{
+			UserID:   userID,
+			FriendID: targetID,
+			Status:   model.FriendshipBlocked,
+		}).Error
+	})
+}
+
+// GetBlock 获取userID对targetID的拉黑记录，不存在时返回nil
+func (r *FriendshipRepository) GetBlock(userID, targetID uint) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.db.Where("user_id = ? AND friend_id = ? AND status = ?", userID, targetID, model.FriendshipBlocked).
+		First(&friendship).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &friendship, nil
+}
+
+// IsBlocked 判断两个用户之间是否存在拉黑关系（任一方拉黑即为true）
+func (r *FriendshipRepository) IsBlocked(userID, otherUserID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Friendship{}).
+		Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+			userID, otherUserID, otherUserID, userID, model.FriendshipBlocked).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetBlockedIDs 获取用户拉黑的用户ID列表
+func (r *FriendshipRepository) GetBlockedIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&model.Friendship{}).
+		Where("user_id = ? AND status = ?", userID, model.FriendshipBlocked).
+		Order("created_at DESC").
+		Pluck("friend_id", &ids).Error
+	return ids, err
+}
+
+// GetBlockRelatedIDs 获取与用户存在拉黑关系的用户ID集合（用户拉黑的和拉黑用户的）
+func (r *FriendshipRepository) GetBlockRelatedIDs(userID uint) (map[uint]bool, error) {
+	var friendships []*model.Friendship
+	err := r.db.Where("(user_id = ? OR friend_id = ?) AND status = ?", userID, userID, model.FriendshipBlocked).
+		Find(&friendships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint]bool, len(friendships))
+	for _, f := range friendships {
+		if f.UserID == userID {
+			ids[f.FriendID] = true
+		} else {
+			ids[f.UserID] = true
+		}
+	}
+	return ids, nil
+}
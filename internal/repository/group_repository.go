@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"errors"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// GroupRepository 群组数据仓储
+type GroupRepository struct {
+	db *gorm.DB
+}
+
+// NewGroupRepository 创建GroupRepository实例
+func NewGroupRepository(db *gorm.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// Create 创建群组，并在同一事务中写入群主及初始成员
+func (r *GroupRepository) Create(group *model.Group, memberIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+
+		members := []*model.GroupMember{{GroupID: group.ID, UserID: group.OwnerID, Role: model.GroupRoleOwner}}
+		for _, id := range memberIDs {
+			if id == group.OwnerID {
+				continue
+			}
+			members = append(members, &model.GroupMember{GroupID: group.ID, UserID: id, Role: model.GroupRoleMember})
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+// GetByID 根据ID获取群组
+func (r *GroupRepository) GetByID(id uint) (*model.Group, error) {
+	var group model.Group
+	err := r.db.First(&group, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("group not found")
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetUserGroups 获取用户加入的所有群组
+func (r *GroupRepository) GetUserGroups(userID uint) ([]*model.Group, error) {
+	var groups []*model.Group
+	err := r.db.Where("id IN (?)", r.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("id ASC").
+		Find(&groups).Error
+	return groups, err
+}
+
+// GetMember 获取群成员信息
+func (r *GroupRepository) GetMember(groupID, userID uint) (*model.GroupMember, error) {
+	var member model.GroupMember
+	err := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("not a group member")
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetMembers 获取群成员列表
+func (r *GroupRepository) GetMembers(groupID uint) ([]*model.GroupMember, error) {
+	var members []*model.GroupMember
+	err := r.db.Where("group_id = ?", groupID).
+		Order("id ASC").
+		Find(&members).Error
+	return members, err
+}
+
+// GetMemberIDs 获取群成员ID列表（用于消息扇出）
+func (r *GroupRepository) GetMemberIDs(groupID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&model.GroupMember{}).
+		Where("group_id = ?", groupID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// AddMembers 批量添加群成员（已在群内的用户会被跳过）
+func (r *GroupRepository) AddMembers(groupID uint, userIDs []uint) ([]uint, error) {
+	var existing []uint
+	if err := r.db.Model(&model.GroupMember{}).
+		Where("group_id = ? AND user_id IN ?", groupID, userIDs).
+		Pluck("user_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	exists := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		exists[id] = true
+	}
+
+	var added []uint
+	var members []*model.GroupMember
+	for _, id := range userIDs {
+		if exists[id] {
+			continue
+		}
+		exists[id] = true
+		added = append(added, id)
+		members = append(members, &model.GroupMember{GroupID: groupID, UserID: id, Role: model.GroupRoleMember})
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	if err := r.db.Create(&members).Error; err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// RemoveMember 移除群成员
+func (r *GroupRepository) RemoveMember(groupID, userID uint) error {
+	return r.db.Where("group_id = ? AND user_id = ?", groupID, userID).
+		Delete(&model.GroupMember{}).Error
+}
+
+// UpdateMemberRole 更新群成员角色
+func (r *GroupRepository) UpdateMemberRole(groupID, userID uint, role string) error {
+	return r.db.Model(&model.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Update("role", role).Error
+}
+
+// TransferOwner 转让群主：原群主降为普通成员，新群主升为owner
+func (r *GroupRepository) TransferOwner(groupID, oldOwnerID, newOwnerID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Group{}).
+			Where("id = ?", groupID).
+			Update("owner_id", newOwnerID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, oldOwnerID).
+			Update("role", model.GroupRoleMember).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, newOwnerID).
+			Update("role", model.GroupRoleOwner).Error
+	})
+}
@@ -2,16 +2,22 @@ package repository
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"im-system/internal/model"
+	"im-system/pkg/redis"
 
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 )
 
 // MessageRepository 消息数据仓储
 type MessageRepository struct {
 	db *gorm.DB
+	// staleSeqKeys 曾因Redis不可用而由数据库分配序号的会话（序号key -> struct{}），
+	// Redis恢复后先以数据库最大序号校正计数再使用
+	staleSeqKeys sync.Map
 }
 
 // NewMessageRepository 创建MessageRepository实例
@@ -19,9 +25,161 @@ func NewMessageRepository(db *gorm.DB) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
-// Create 创建消息
+// 会话序号相关常量
+const (
+	messageConvSeqIndex = "idx_message_conv_seq" // (conv_key, seq) 唯一索引
+	maxSeqRetries       = 3                      // 序号冲突时的最大重试次数
+	mysqlErrDupEntry    = 1062                   // MySQL 唯一键冲突错误码
+)
+
+// Create 创建消息，并分配会话内序号
+// 序号已被占用时（Redis计数落后于数据库），以数据库为准校正计数后重新分配
 func (r *MessageRepository) Create(message *model.Message) error {
-	return r.db.Create(message).Error
+	message.ConvKey = message.ConversationKey()
+	for attempt := 0; ; attempt++ {
+		seq, err := r.nextSeq(message)
+		if err != nil {
+			return err
+		}
+		message.Seq = seq
+		err = r.db.Create(message).Error
+		if err == nil || !isDuplicateEntry(err) || attempt >= maxSeqRetries {
+			return err
+		}
+		r.staleSeqKeys.Store(redis.SeqKey(message.ConvKey), struct{}{})
+	}
+}
+
+// nextSeq 获取消息所在会话的下一个序号
+// 优先使用Redis INCR；Redis不可用时退化为数据库当前最大序号+1（并发冲突由唯一索引拒绝后重试），
+// 并记录该会话，Redis恢复后先把计数抬高到数据库最大序号，避免重复分配
+func (r *MessageRepository) nextSeq(message *model.Message) (uint64, error) {
+	key := redis.SeqKey(message.ConvKey)
+	maxSeq := func() (uint64, error) { return r.getMaxSeq(message.ConvKey) }
+
+	if _, stale := r.staleSeqKeys.Load(key); stale {
+		if current, err := maxSeq(); err == nil && redis.SyncSeq(key, current) == nil {
+			r.staleSeqKeys.Delete(key)
+		}
+	}
+	if seq, err := redis.NextSeq(key, maxSeq); err == nil {
+		return seq, nil
+	}
+
+	r.staleSeqKeys.Store(key, struct{}{})
+	current, err := maxSeq()
+	if err != nil {
+		return 0, err
+	}
+	return current + 1, nil
+}
+
+// getMaxSeq 获取会话在数据库中的最大序号（包含已删除的消息，避免序号复用）
+func (r *MessageRepository) getMaxSeq(convKey string) (uint64, error) {
+	var maxSeq uint64
+	err := r.db.Unscoped().Model(&model.Message{}).
+		Select("COALESCE(MAX(seq), 0)").
+		Where("conv_key = ?", convKey).
+		Scan(&maxSeq).Error
+	return maxSeq, err
+}
+
+// MigrateSeq 补齐历史消息的会话标识与序号，并创建 (conv_key, seq) 唯一索引（已存在时跳过）
+// 序号功能上线前的消息 seq 为0，与此前因并发或Redis回退产生的重复序号一起，
+// 按消息ID顺序追加在会话当前最大序号之后（已分配的序号保持不变，客户端按 after_seq 同步时可以取到），
+// 并把Redis中的会话计数抬高到新的最大序号
+func (r *MessageRepository) MigrateSeq() error {
+	if r.db.Migrator().HasIndex(&model.Message{}, messageConvSeqIndex) {
+		return nil
+	}
+
+	err := r.db.Exec(`UPDATE message SET conv_key = CASE
+		WHEN group_id IS NULL THEN CONCAT('private:', LEAST(sender_id, receiver_id), ':', GREATEST(sender_id, receiver_id))
+		ELSE CONCAT('group:', group_id) END
+		WHERE conv_key = ''`).Error
+	if err != nil {
+		return err
+	}
+
+	// 需要重新分配序号的消息：seq 为0，或与同会话中ID更小的消息序号重复
+	var rows []struct {
+		ID      uint
+		ConvKey string
+	}
+	err = r.db.Raw(`SELECT id, conv_key FROM message WHERE seq = 0
+		UNION
+		SELECT m.id, m.conv_key FROM message m
+		JOIN message d ON d.conv_key = m.conv_key AND d.seq = m.seq AND d.id < m.id
+		WHERE m.seq > 0
+		ORDER BY id`).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	byConv := make(map[string][]uint)
+	var convKeys []string
+	for _, row := range rows {
+		if _, ok := byConv[row.ConvKey]; !ok {
+			convKeys = append(convKeys, row.ConvKey)
+		}
+		byConv[row.ConvKey] = append(byConv[row.ConvKey], row.ID)
+	}
+
+	for _, convKey := range convKeys {
+		ids := byConv[convKey]
+		var current uint64
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Model(&model.Message{}).
+				Select("COALESCE(MAX(seq), 0)").
+				Where("conv_key = ?", convKey).
+				Scan(&current).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				current++
+				if err := tx.Unscoped().Model(&model.Message{}).
+					Where("id = ?", id).
+					UpdateColumn("seq", current).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		_ = redis.SyncSeq(redis.SeqKey(convKey), current)
+	}
+
+	return r.db.Exec("CREATE UNIQUE INDEX " + messageConvSeqIndex + " ON message (conv_key, seq)").Error
+}
+
+// isDuplicateEntry 判断是否为唯一键冲突
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupEntry
+}
+
+// GetPrivateMessagesAfterSeq 获取私聊会话中序号大于 afterSeq 的消息（按序号升序）
+func (r *MessageRepository) GetPrivateMessagesAfterSeq(userID, otherUserID uint, afterSeq uint64, limit int) ([]*model.Message, error) {
+	var messages []*model.Message
+	err := r.db.Where(
+		"((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND group_id IS NULL AND seq > ?",
+		userID, otherUserID, otherUserID, userID, afterSeq,
+	).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetGroupMessagesAfterSeq 获取群聊会话中序号大于 afterSeq、且在 since（入群时间）之后发送的消息（按序号升序）
+func (r *MessageRepository) GetGroupMessagesAfterSeq(groupID uint, since time.Time, afterSeq uint64, limit int) ([]*model.Message, error) {
+	var messages []*model.Message
+	err := r.db.Where("group_id = ? AND seq > ? AND created_at >= ?", groupID, afterSeq, since).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
 }
 
 // GetByID 根据ID获取消息
@@ -37,16 +195,57 @@ func (r *MessageRepository) GetByID(id uint) (*model.Message, error) {
 	return &message, nil
 }
 
-// GetPrivateMessages 获取两个用户之间的私聊消息
-func (r *MessageRepository) GetPrivateMessages(senderID, receiverID uint, limit, offset int) ([]*model.Message, error) {
+// GetByIDs 批量获取消息
+func (r *MessageRepository) GetByIDs(ids []uint) ([]*model.Message, error) {
+	var messages []*model.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := r.db.Where("id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+// GetPrivateMessagesBefore 获取两个用户之间ID小于 beforeID 的私聊消息（按ID降序，beforeID为0时从最新一条开始）
+// 基于主键的游标分页，不受翻页过程中新消息插入的影响
+func (r *MessageRepository) GetPrivateMessagesBefore(userID, otherUserID, beforeID uint, limit int) ([]*model.Message, error) {
+	var messages []*model.Message
+
+	query := r.db.Where(
+		"(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
+		userID, otherUserID, otherUserID, userID,
+	).
+		Where("group_id IS NULL") // 确保是私聊消息
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	err := query.Order("id DESC").
+		Limit(limit).
+		Find(&messages).Error
+
+	return messages, err
+}
+
+// GetPrivateMessagesAfter 获取两个用户之间ID大于 afterID 的私聊消息（按ID升序，取紧接 afterID 之后的一段）
+func (r *MessageRepository) GetPrivateMessagesAfter(userID, otherUserID, afterID uint, limit int) ([]*model.Message, error) {
 	var messages []*model.Message
 
-	// 查询发送者和接收者之间的消息（双向）
 	err := r.db.Where(
 		"(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
-		senderID, receiverID, receiverID, senderID,
+		userID, otherUserID, otherUserID, userID,
 	).
-		Where("group_id IS NULL"). // 确保是私聊消息
+		Where("group_id IS NULL AND id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+
+	return messages, err
+}
+
+// GetGroupMessages 获取群聊中在 since（入群时间）之后发送的消息
+func (r *MessageRepository) GetGroupMessages(groupID uint, since time.Time, limit, offset int) ([]*model.Message, error) {
+	var messages []*model.Message
+
+	err := r.db.Where("group_id = ? AND created_at >= ?", groupID, since).
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -66,18 +265,126 @@ func (r *MessageRepository) GetUnreadMessages(userID uint) ([]*model.Message, er
 	return messages, err
 }
 
+// readUpdates 标记已读时更新的字段：状态同时更新为 read（已撤回的消息保持 recalled）
+func readUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"is_read": true,
+		"status":  gorm.Expr("IF(status = ?, status, ?)", "recalled", "read"),
+	}
+}
+
 // MarkAsRead 标记消息为已读
 func (r *MessageRepository) MarkAsRead(messageID uint) error {
 	return r.db.Model(&model.Message{}).
 		Where("id = ?", messageID).
-		Update("is_read", true).Error
+		Updates(readUpdates()).Error
 }
 
-// MarkConversationAsRead 标记整个对话为已读
-func (r *MessageRepository) MarkConversationAsRead(userID, otherUserID uint) error {
+// MarkAsDelivered 标记消息为已投递（仅从 sent 状态更新，不覆盖更靠后的状态）
+func (r *MessageRepository) MarkAsDelivered(messageID uint) error {
 	return r.db.Model(&model.Message{}).
-		Where("receiver_id = ? AND sender_id = ? AND is_read = ?", userID, otherUserID, false).
-		Update("is_read", true).Error
+		Where("id = ? AND status = ?", messageID, "sent").
+		Update("status", "delivered").Error
+}
+
+// Recall 撤回消息：清空内容并标记为 recalled，保留记录作为占位；编辑历史一并删除
+func (r *MessageRepository) Recall(messageID uint) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Message{}).
+			Where("id = ? AND status <> ?", messageID, "recalled").
+			Updates(map[string]interface{}{
+				"content":     "",
+				"payload":     nil,
+				"status":      "recalled",
+				"recalled_at": &now,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Where("message_id = ?", messageID).Delete(&model.MessageRevision{}).Error
+	})
+}
+
+// Edit 编辑消息：保存当前内容为修订记录，再更新为新内容
+func (r *MessageRepository) Edit(message *model.Message, content string, editedAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		revision := &model.MessageRevision{
+			MessageID: message.ID,
+			Content:   message.Content,
+			CreatedAt: editedAt,
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Message{}).
+			Where("id = ?", message.ID).
+			Updates(map[string]interface{}{
+				"content":   content,
+				"edited_at": &editedAt,
+			}).Error
+	})
+}
+
+// GetRevisions 获取消息的修订记录（按编辑时间升序）
+func (r *MessageRepository) GetRevisions(messageID uint) ([]*model.MessageRevision, error) {
+	var revisions []*model.MessageRevision
+	err := r.db.Where("message_id = ?", messageID).
+		Order("id ASC").
+		Find(&revisions).Error
+	return revisions, err
+}
+
+// ReadRange 一次批量已读标记的范围
+type ReadRange struct {
+	Count  int64  // 本次标记为已读的消息数
+	MaxID  uint   // 其中最大的消息ID
+	MaxSeq uint64 // 其中最大的会话序号
+}
+
+// MarkConversationAsRead 将对方发给自己的未读私聊消息标记为已读
+// upToID / upToSeq 大于0时只标记不超过该消息ID / 序号的消息；没有需要标记的消息时返回 nil
+func (r *MessageRepository) MarkConversationAsRead(userID, otherUserID, upToID uint, upToSeq uint64) (*ReadRange, error) {
+	var result *ReadRange
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := func() *gorm.DB {
+			q := tx.Model(&model.Message{}).
+				Where("receiver_id = ? AND sender_id = ? AND group_id IS NULL AND is_read = ?", userID, otherUserID, false)
+			if upToID > 0 {
+				q = q.Where("id <= ?", upToID)
+			}
+			if upToSeq > 0 {
+				q = q.Where("seq <= ?", upToSeq)
+			}
+			return q
+		}
+
+		var rng ReadRange
+		if err := query().
+			Select("COUNT(*) AS count, COALESCE(MAX(id), 0) AS max_id, COALESCE(MAX(seq), 0) AS max_seq").
+			Scan(&rng).Error; err != nil {
+			return err
+		}
+		if rng.Count == 0 {
+			return nil
+		}
+		// 以统计时的最大ID为上限，避免把统计之后新到达的消息一并标记
+		if err := query().Where("id <= ?", rng.MaxID).Updates(readUpdates()).Error; err != nil {
+			return err
+		}
+		result = &rng
+		return nil
+	})
+	return result, err
+}
+
+// GetUnreadSenderIDs 获取给用户发送过未读私聊消息的用户ID
+func (r *MessageRepository) GetUnreadSenderIDs(userID uint) ([]uint, error) {
+	var senderIDs []uint
+	err := r.db.Model(&model.Message{}).
+		Where("receiver_id = ? AND group_id IS NULL AND is_read = ?", userID, false).
+		Distinct("sender_id").
+		Pluck("sender_id", &senderIDs).Error
+	return senderIDs, err
 }
 
 // GetUnreadCount 获取用户未读消息数量
@@ -98,6 +405,28 @@ func (r *MessageRepository) GetConversationUnreadCount(userID, otherUserID uint)
 	return count, err
 }
 
+// GetUnreadCountsBySender 按发送者统计用户的未读私聊消息数量
+func (r *MessageRepository) GetUnreadCountsBySender(userID uint) (map[uint]int64, error) {
+	var rows []struct {
+		SenderID uint
+		Count    int64
+	}
+	err := r.db.Model(&model.Message{}).
+		Select("sender_id, COUNT(*) AS count").
+		Where("receiver_id = ? AND group_id IS NULL AND is_read = ?", userID, false).
+		Group("sender_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SenderID] = row.Count
+	}
+	return counts, nil
+}
+
 // DeleteMessage 删除消息（软删除）
 func (r *MessageRepository) DeleteMessage(messageID, userID uint) error {
 	// 只能删除自己发送的消息
@@ -118,3 +447,14 @@ func (r *MessageRepository) GetRecentConversations(userID uint, limit int) ([]*m
 
 	return messages, err
 }
+
+// HasPrivateConversation 判断两个用户之间是否有过私聊消息
+func (r *MessageRepository) HasPrivateConversation(userID, otherUserID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Message{}).
+		Where("group_id IS NULL AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+			userID, otherUserID, otherUserID, userID).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
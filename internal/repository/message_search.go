@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// MessageSearchQuery 消息搜索条件
+type MessageSearchQuery struct {
+	UserID   uint       // 搜索者，只返回其发送或接收的消息
+	Terms    []string   // 关键词，消息需包含全部关键词
+	PeerID   uint       // 只搜索与该用户的私聊，0 表示不限
+	From     *time.Time // 发送时间下限（含）
+	To       *time.Time // 发送时间上限（不含）
+	BeforeID uint       // 游标：只返回ID小于该值的消息，0 表示从最新开始
+	Limit    int
+}
+
+// SearchIndex 消息全文检索
+// Index/Remove 在消息写入、编辑、撤回、删除后调用，供需要单独维护索引的检索引擎使用
+type SearchIndex interface {
+	// Search 按ID降序返回匹配的消息（已撤回、已删除的消息除外）
+	Search(query *MessageSearchQuery) ([]*model.Message, error)
+	// Index 新增或更新消息的索引
+	Index(message *model.Message) error
+	// Remove 删除消息的索引
+	Remove(messageID uint) error
+}
+
+// messageFulltextIndex 消息内容全文索引名
+const messageFulltextIndex = "idx_message_content_ft"
+
+// MySQLSearchIndex 基于 MySQL FULLTEXT 索引的消息检索
+// 使用 ngram 分词（默认2字），中文无需额外分词；索引由 InnoDB 随数据自动维护
+type MySQLSearchIndex struct {
+	db *gorm.DB
+}
+
+// NewMySQLSearchIndex 创建MySQLSearchIndex实例
+func NewMySQLSearchIndex(db *gorm.DB) *MySQLSearchIndex {
+	return &MySQLSearchIndex{db: db}
+}
+
+// Migrate 创建消息内容全文索引（已存在时跳过）
+func (idx *MySQLSearchIndex) Migrate() error {
+	if idx.db.Migrator().HasIndex(&model.Message{}, messageFulltextIndex) {
+		return nil
+	}
+	return idx.db.Exec("CREATE FULLTEXT INDEX " + messageFulltextIndex + " ON message (content) WITH PARSER ngram").Error
+}
+
+// Search 搜索消息
+// 关键词以布尔模式的短语匹配（+"关键词"），其余条件见 searchScope
+func (idx *MySQLSearchIndex) Search(query *MessageSearchQuery) ([]*model.Message, error) {
+	terms := make([]string, 0, len(query.Terms))
+	for _, term := range query.Terms {
+		// 双引号会破坏短语语法，其他布尔运算符在引号内不生效
+		if term = strings.ReplaceAll(term, `"`, " "); strings.TrimSpace(term) != "" {
+			terms = append(terms, `+"`+term+`"`)
+		}
+	}
+
+	db := idx.db.Model(&model.Message{}).
+		Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", strings.Join(terms, " ")).
+		Scopes(searchScope(idx.db, query))
+
+	var messages []*model.Message
+	err := db.Order("id DESC").Limit(query.Limit).Find(&messages).Error
+	return messages, err
+}
+
+// searchScope 关键词以外的搜索条件：可见范围、时间范围与游标，与具体检索引擎无关
+// 私聊为发送者或接收者，群聊为发送者或当前群成员（只含入群之后的消息）
+func searchScope(db *gorm.DB, query *MessageSearchQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("status <> ?", "recalled")
+		if query.PeerID > 0 {
+			tx = tx.Where("group_id IS NULL AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+				query.UserID, query.PeerID, query.PeerID, query.UserID)
+		} else {
+			tx = tx.Where(
+				db.Where("sender_id = ?", query.UserID).
+					Or("group_id IS NULL AND receiver_id = ?", query.UserID).
+					Or("EXISTS (?)", db.Model(&model.GroupMember{}).
+						Select("1").
+						Where("group_member.group_id = message.group_id AND group_member.user_id = ? AND group_member.created_at <= message.created_at", query.UserID)),
+			)
+		}
+		if query.From != nil {
+			tx = tx.Where("created_at >= ?", *query.From)
+		}
+		if query.To != nil {
+			tx = tx.Where("created_at < ?", *query.To)
+		}
+		if query.BeforeID > 0 {
+			tx = tx.Where("id < ?", query.BeforeID)
+		}
+		return tx
+	}
+}
+
+// Index MySQL 全文索引随数据自动维护，无需处理
+func (idx *MySQLSearchIndex) Index(message *model.Message) error {
+	return nil
+}
+
+// Remove MySQL 全文索引随数据自动维护，无需处理
+func (idx *MySQLSearchIndex) Remove(messageID uint) error {
+	return nil
+}
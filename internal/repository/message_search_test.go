@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"im-system/internal/model"
+)
+
+// newTestDB 创建 sqlite 测试数据库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.Message{}, &model.GroupMember{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSearchScope(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+	group := func(id uint) *uint { return &id }
+
+	// 用户1 在第10小时加入群100，用户2 一开始就在群中
+	members := []model.GroupMember{
+		{GroupID: 100, UserID: 1, CreatedAt: at(10)},
+		{GroupID: 100, UserID: 2, CreatedAt: at(0)},
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatal(err)
+	}
+	messages := []model.Message{
+		{ID: 1, SenderID: 2, GroupID: group(100), SessionType: 2, Content: "入群前", CreatedAt: at(5)},
+		{ID: 2, SenderID: 2, GroupID: group(100), SessionType: 2, Content: "入群时", CreatedAt: at(10)},
+		{ID: 3, SenderID: 2, GroupID: group(100), SessionType: 2, Content: "入群后", CreatedAt: at(11)},
+		{ID: 4, SenderID: 3, GroupID: group(200), SessionType: 2, Content: "其他群", CreatedAt: at(11)},
+		{ID: 5, SenderID: 2, ReceiverID: 1, Content: "私聊", CreatedAt: at(1)},
+		{ID: 6, SenderID: 1, ReceiverID: 3, Content: "私聊", CreatedAt: at(2)},
+		{ID: 7, SenderID: 2, ReceiverID: 3, Content: "他人私聊", CreatedAt: at(3)},
+		{ID: 8, SenderID: 2, ReceiverID: 1, Content: "已撤回", Status: "recalled", CreatedAt: at(4)},
+	}
+	for i := range messages {
+		messages[i].ConvKey = messages[i].ConversationKey()
+		messages[i].Seq = uint64(messages[i].ID)
+	}
+	if err := db.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := at(2), at(11)
+	tests := []struct {
+		name  string
+		query MessageSearchQuery
+		want  []uint
+	}{
+		{name: "all conversations", query: MessageSearchQuery{UserID: 1}, want: []uint{6, 5, 3, 2}},
+		{name: "member since start", query: MessageSearchQuery{UserID: 2}, want: []uint{7, 5, 3, 2, 1}},
+		{name: "private with peer", query: MessageSearchQuery{UserID: 1, PeerID: 2}, want: []uint{5}},
+		{name: "date range", query: MessageSearchQuery{UserID: 1, From: &from, To: &to}, want: []uint{6, 2}},
+		{name: "before cursor", query: MessageSearchQuery{UserID: 1, BeforeID: 3}, want: []uint{2}},
+		{name: "not a member", query: MessageSearchQuery{UserID: 4}, want: []uint{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []uint
+			err := db.Model(&model.Message{}).
+				Scopes(searchScope(db, &tt.query)).
+				Order("id DESC").
+				Pluck("id", &ids).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("ids = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("ids = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -28,6 +28,18 @@ func (r *UserRepository) GetByID(id uint) (*model.User, error) {
 	return &u, nil
 }
 
+// GetByIDs 批量获取用户
+func (r *UserRepository) GetByIDs(ids []uint) ([]*model.User, error) {
+	var users []*model.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := r.orm.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *UserRepository) GetByUsernameOrEmail(identifier string) (*model.User, error) {
 	var u model.User
 	if err := r.orm.Where("username = ? OR email = ?", identifier, identifier).First(&u).Error; err != nil {
@@ -36,6 +48,22 @@ func (r *UserRepository) GetByUsernameOrEmail(identifier string) (*model.User, e
 	return &u, nil
 }
 
+// GetByEmail 根据邮箱获取用户
+func (r *UserRepository) GetByEmail(email string) (*model.User, error) {
+	var u model.User
+	if err := r.orm.Where("email = ?", email).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UpdatePassword 更新密码哈希
+func (r *UserRepository) UpdatePassword(userID uint, passwordHash string) error {
+	return r.orm.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("password_hash", passwordHash).Error
+}
+
 // UpdateStatus 更新用户在线状态与最近在线时间
 func (r *UserRepository) UpdateStatus(userID uint, status string) error {
 	return r.orm.Model(&model.User{}).
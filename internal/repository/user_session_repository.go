@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"im-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// UserSessionRepository 登录会话数据仓储
+type UserSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewUserSessionRepository 创建UserSessionRepository实例
+func NewUserSessionRepository(db *gorm.DB) *UserSessionRepository {
+	return &UserSessionRepository{db: db}
+}
+
+// Create 创建登录会话
+func (r *UserSessionRepository) Create(session *model.UserSession) error {
+	return r.db.Create(session).Error
+}
+
+// GetByID 获取登录会话，不存在时返回 nil
+func (r *UserSessionRepository) GetByID(id string) (*model.UserSession, error) {
+	var session model.UserSession
+	if err := r.db.Where("id = ?", id).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActive 获取用户未吊销且未过期的登录会话（按最近活跃时间倒序）
+func (r *UserSessionRepository) ListActive(userID uint) ([]*model.UserSession, error) {
+	var sessions []*model.UserSession
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// UpdateToken 刷新令牌后更新会话的当前访问令牌、过期时间与最近活跃信息
+func (r *UserSessionRepository) UpdateToken(id, tokenID, ip, userAgent string, expiresAt time.Time) error {
+	return r.db.Model(&model.UserSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"jti":          tokenID,
+			"ip":           ip,
+			"user_agent":   userAgent,
+			"last_seen_at": time.Now(),
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+// Touch 更新会话的最近活跃时间
+func (r *UserSessionRepository) Touch(id string) error {
+	return r.db.Model(&model.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("last_seen_at", time.Now()).Error
+}
+
+// Revoke 吊销登录会话（已吊销的保持原记录）
+func (r *UserSessionRepository) Revoke(id, reason string) error {
+	return r.db.Model(&model.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"revoked_at":    time.Now(),
+			"revoke_reason": reason,
+		}).Error
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// recordAudit 写入审计日志（同时输出到应用日志），写入失败不影响业务流程
+func recordAudit(repo *repository.AuditLogRepository, entry *model.AuditLog) {
+	logger.Warn("安全审计",
+		zap.String("action", entry.Action),
+		zap.Uint("user_id", entry.UserID),
+		zap.Uint("actor_id", entry.ActorID),
+		zap.String("ip", entry.IP),
+		zap.String("detail", entry.Detail),
+	)
+	if err := repo.Create(entry); err != nil {
+		logger.Error("写入审计日志失败", zap.String("action", entry.Action), zap.Error(err))
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"im-system/internal/model"
+	"im-system/pkg/jwt"
+	"im-system/pkg/logger"
+	"im-system/pkg/redis"
+	"im-system/pkg/websocket"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidRefreshToken 刷新令牌无效、已过期或所属会话已被吊销
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// TokenPair 登录/刷新后签发的令牌
+// AccessToken 为短期有效的 JWT；RefreshToken 为不透明令牌，每次刷新时轮换，旧令牌立即失效
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	ExpiresIn        int64     // 访问令牌有效期（秒）
+	TokenID          string    // 访问令牌的 jti
+	RefreshExpiresAt time.Time // 刷新令牌过期时间
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌（轮换：旧的刷新令牌失效）
+// 已轮换的刷新令牌再次被使用时视为泄露，吊销整个登录会话
+// client 为发起刷新的客户端，用于更新登录会话的最近活跃信息
+func (s *UserService) RefreshToken(refreshToken string, client *ClientInfo) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, reused, err := redis.UseRefreshToken(jwt.HashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if reused {
+		logger.Warn("刷新令牌被重复使用，吊销登录会话",
+			zap.Uint("user_id", token.UserID),
+			zap.String("session_id", token.SessionID),
+		)
+		s.revokeSession(token.UserID, token.SessionID, SessionRevokeReused)
+		return nil, ErrInvalidRefreshToken
+	}
+	if revoked, err := redis.IsRevoked("", token.SessionID); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetByID(token.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	tokens, err := s.issueTokens(user, token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	client = client.normalize()
+	_ = s.sessionRepo.UpdateToken(token.SessionID, tokens.TokenID, client.IP, client.UserAgent, tokens.RefreshExpiresAt)
+	return tokens, nil
+}
+
+// issueTokens 为登录会话签发访问令牌与刷新令牌
+func (s *UserService) issueTokens(user *model.User, sessionID string) (*TokenPair, error) {
+	accessToken, tokenID, err := s.jwtService.GenerateToken(
+		// 使用用户ID作为 subject
+		fmt.Sprintf("%d", user.ID),
+		sessionID,
+		map[string]interface{}{"username": user.Username},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := jwt.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().Add(s.jwtService.RefreshExpireAfter())
+	err = redis.SaveRefreshToken(hash, &redis.RefreshToken{
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
+		ExpiresAt: refreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(s.jwtService.ExpireAfter().Seconds()),
+		TokenID:          tokenID,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// revokeSession 吊销登录会话：该会话的访问令牌与刷新令牌全部失效，并断开使用该会话的WebSocket连接
+func (s *UserService) revokeSession(userID uint, sessionID, reason string) {
+	if sessionID == "" {
+		return
+	}
+	_ = s.sessionRepo.Revoke(sessionID, reason)
+	// 吊销记录需要保留到该会话签发的所有令牌过期
+	ttl := s.jwtService.RefreshExpireAfter()
+	if expire := s.jwtService.ExpireAfter(); expire > ttl {
+		ttl = expire
+	}
+	if err := redis.RevokeSession(sessionID, ttl); err != nil {
+		logger.Error("吊销登录会话失败", zap.String("session_id", sessionID), zap.Error(err))
+	}
+	websocket.GetManager().CloseSession(userID, sessionID, reason)
+}
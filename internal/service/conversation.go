@@ -0,0 +1,281 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/redis"
+)
+
+// 会话名称最大长度（字符）
+const conversationTitleMaxLen = 64
+
+// ErrConversationNotFound 会话不存在或已从会话列表删除
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationSettings 会话个人设置，字段为 nil 表示不修改
+type ConversationSettings struct {
+	Pinned   *bool   `json:"pinned"`
+	Muted    *bool   `json:"muted"`
+	Archived *bool   `json:"archived"`
+	Title    *string `json:"title"`
+}
+
+// GetConversationList 获取对话列表（带缓存）
+// 置顶的会话在前，其余按最后一条消息时间倒序；已归档的会话与拉黑用户的会话不展示
+func (s *MessageService) GetConversationList(userID uint, limit int) ([]redis.CachedConversation, error) {
+	if limit <= 0 || limit > redis.MaxCachedConversations {
+		limit = redis.MaxCachedConversations
+	}
+
+	// 与拉黑用户的对话不展示
+	hidden, err := s.friendshipRepo.GetBlockRelatedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 尝试从缓存获取，未命中时从会话表获取并缓存
+	conversations, err := redis.GetCachedConversations(userID)
+	if err != nil || len(conversations) == 0 {
+		entries, err := s.conversationRepo.ListByUser(userID, false, redis.MaxCachedConversations)
+		if err != nil {
+			return nil, err
+		}
+		conversations = s.buildConversations(entries)
+		cached := append([]redis.CachedConversation(nil), conversations...)
+		go func() {
+			_ = redis.CacheConversations(userID, cached)
+		}()
+	}
+
+	visible := conversations[:0]
+	for _, conv := range conversations {
+		if !hidden[conv.UserID] {
+			visible = append(visible, conv)
+		}
+	}
+	if len(visible) > limit {
+		visible = visible[:limit]
+	}
+	s.fillUnreadCounts(userID, visible)
+	return visible, nil
+}
+
+// GetArchivedConversations 获取已归档的对话列表（按最后一条消息时间倒序）
+func (s *MessageService) GetArchivedConversations(userID uint, limit int) ([]redis.CachedConversation, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	hidden, err := s.friendshipRepo.GetBlockRelatedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.conversationRepo.ListByUser(userID, true, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := s.buildConversations(entries)
+	visible := conversations[:0]
+	for _, conv := range conversations {
+		if !hidden[conv.UserID] {
+			visible = append(visible, conv)
+		}
+	}
+	s.fillUnreadCounts(userID, visible)
+	return visible, nil
+}
+
+// OpenConversation 打开与指定用户的私聊会话（尚无消息时创建，已删除时恢复，已归档时取消归档）
+func (s *MessageService) OpenConversation(userID uint, peerIDStr string) (*redis.CachedConversation, error) {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByID(peerID); err != nil {
+		return nil, errors.New("user not found")
+	}
+	if blocked, err := s.friendshipRepo.IsBlocked(userID, peerID); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, ErrBlocked
+	}
+
+	// 只创建自己的成员记录，对方在收到第一条消息前看不到该会话
+	conv, err := s.conversationRepo.OpenPrivate(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.conversationRepo.UpdateMember(conv.ID, userID, map[string]interface{}{"archived": false}); err != nil {
+		return nil, err
+	}
+	_ = redis.ClearConversationCache(userID)
+	return s.GetConversation(userID, peerIDStr)
+}
+
+// GetConversation 获取与指定用户的私聊会话及个人设置
+func (s *MessageService) GetConversation(userID uint, peerIDStr string) (*redis.CachedConversation, error) {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.getPrivateConversation(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := s.buildConversations([]*repository.ConversationEntry{entry})
+	s.fillUnreadCounts(userID, conversations)
+	return &conversations[0], nil
+}
+
+// UpdateConversationSettings 修改会话的置顶、免打扰、归档与自定义名称
+func (s *MessageService) UpdateConversationSettings(userID uint, peerIDStr string, settings *ConversationSettings) (*redis.CachedConversation, error) {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.getPrivateConversation(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if settings.Pinned != nil && *settings.Pinned != entry.Pinned {
+		updates["pinned"] = *settings.Pinned
+		if *settings.Pinned {
+			updates["pinned_at"] = time.Now()
+		} else {
+			updates["pinned_at"] = nil
+		}
+	}
+	if settings.Muted != nil {
+		updates["muted"] = *settings.Muted
+	}
+	if settings.Archived != nil {
+		updates["archived"] = *settings.Archived
+	}
+	if settings.Title != nil {
+		title := strings.TrimSpace(*settings.Title)
+		if utf8.RuneCountInString(title) > conversationTitleMaxLen {
+			return nil, errors.New("title too long")
+		}
+		updates["title"] = title
+	}
+
+	if len(updates) > 0 {
+		if err := s.conversationRepo.UpdateMember(entry.ConversationID, userID, updates); err != nil {
+			return nil, err
+		}
+		_ = redis.ClearConversationCache(userID)
+	}
+	return s.GetConversation(userID, peerIDStr)
+}
+
+// DeleteConversation 从会话列表中删除与指定用户的会话（消息不删除，收到新消息时重新出现；草稿一并删除）
+func (s *MessageService) DeleteConversation(userID uint, peerIDStr string) error {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return err
+	}
+	entry, err := s.getPrivateConversation(userID, peerID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.conversationRepo.DeleteMember(entry.ConversationID, userID); err != nil {
+		return err
+	}
+	_ = redis.DeleteDraft(userID, redis.PrivateDraftField(peerID))
+	_ = redis.ClearConversationCache(userID)
+	return nil
+}
+
+// getPrivateConversation 获取用户与指定用户的私聊会话
+func (s *MessageService) getPrivateConversation(userID, peerID uint) (*repository.ConversationEntry, error) {
+	entry, err := s.conversationRepo.GetPrivate(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, ErrConversationNotFound
+	}
+	return entry, nil
+}
+
+// parsePeerID 解析私聊对方用户ID
+func (s *MessageService) parsePeerID(userID uint, peerIDStr string) (uint, error) {
+	peerID, err := strconv.ParseUint(peerIDStr, 10, 32)
+	if err != nil || peerID == 0 {
+		return 0, errors.New("invalid user ID")
+	}
+	if uint(peerID) == userID {
+		return 0, errors.New("cannot open a conversation with yourself")
+	}
+	return uint(peerID), nil
+}
+
+// buildConversations 将会话记录转换为对话列表项（补充对方用户名与最后一条消息内容，未读数另行设置）
+func (s *MessageService) buildConversations(entries []*repository.ConversationEntry) []redis.CachedConversation {
+	peerIDs := make([]uint, 0, len(entries))
+	messageIDs := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		peerIDs = append(peerIDs, e.PeerID)
+		if e.LastMessageID > 0 {
+			messageIDs = append(messageIDs, e.LastMessageID)
+		}
+	}
+
+	usernames := make(map[uint]string, len(peerIDs))
+	if users, err := s.userRepo.GetByIDs(peerIDs); err == nil {
+		for _, u := range users {
+			usernames[u.ID] = u.Username
+		}
+	}
+	lastMessages := make(map[uint]*model.Message, len(messageIDs))
+	if messages, err := s.messageRepo.GetByIDs(messageIDs); err == nil {
+		for _, m := range messages {
+			lastMessages[m.ID] = m
+		}
+	}
+
+	conversations := make([]redis.CachedConversation, 0, len(entries))
+	for _, e := range entries {
+		conv := redis.CachedConversation{
+			UserID:        e.PeerID,
+			Username:      usernames[e.PeerID],
+			Title:         e.Title,
+			Pinned:        e.Pinned,
+			Muted:         e.Muted,
+			Archived:      e.Archived,
+			LastReadMsgID: e.LastReadMsgID,
+			LastReadSeq:   e.LastReadSeq,
+		}
+		if e.LastMessageAt != nil {
+			conv.LastTime = *e.LastMessageAt
+		}
+		if e.Draft != "" {
+			conv.Draft = e.Draft
+			conv.DraftUpdatedAt = e.DraftUpdatedAt
+		}
+		if m := lastMessages[e.LastMessageID]; m != nil {
+			conv.LastMessage = m.Content
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations
+}
+
+// fillUnreadCounts 按会话设置对话列表的未读数（缓存的对话列表中不保存未读数）
+func (s *MessageService) fillUnreadCounts(userID uint, conversations []redis.CachedConversation) {
+	counts, _ := s.getUnreadCounts(userID)
+	for i := range conversations {
+		conversations[i].UnreadCount = counts[redis.PrivateUnreadField(conversations[i].UserID)]
+	}
+}
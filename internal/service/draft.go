@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"im-system/pkg/redis"
+	"im-system/pkg/websocket"
+)
+
+// 草稿最大长度（字符）
+const draftMaxLen = 5000
+
+// SaveDraft 保存与指定用户私聊的草稿（HTTP接口，同步到用户的所有在线连接）
+func (s *MessageService) SaveDraft(userID uint, peerIDStr, content string) (*redis.Draft, error) {
+	return s.SaveDraftFromConn(userID, "", peerIDStr, content)
+}
+
+// SaveDraftFromConn 保存与指定用户私聊的草稿，content 为空时清空草稿
+// 草稿写入数据库并缓存到 Redis，然后向用户除 connID 外的在线连接推送 draft_updated
+func (s *MessageService) SaveDraftFromConn(userID uint, connID, peerIDStr, content string) (*redis.Draft, error) {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(content) > draftMaxLen {
+		return nil, errors.New("draft too long")
+	}
+
+	entry, err := s.conversationRepo.GetPrivate(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		// 尚无会话时清空草稿无需处理；保存草稿时创建会话（只创建自己的成员记录，对方看不到该会话）
+		if content == "" {
+			return &redis.Draft{UpdatedAt: time.Now()}, nil
+		}
+		if _, err := s.userRepo.GetByID(peerID); err != nil {
+			return nil, errors.New("user not found")
+		}
+		if blocked, err := s.friendshipRepo.IsBlocked(userID, peerID); err != nil {
+			return nil, err
+		} else if blocked {
+			return nil, ErrBlocked
+		}
+		if _, err := s.conversationRepo.OpenPrivate(userID, peerID); err != nil {
+			return nil, err
+		}
+	}
+
+	draft := &redis.Draft{Content: content, UpdatedAt: time.Now()}
+	if err := s.conversationRepo.SetPrivateDraft(userID, peerID, draft.Content, draft.UpdatedAt); err != nil {
+		return nil, err
+	}
+	_ = redis.SetDraft(userID, redis.PrivateDraftField(peerID), draft)
+	_ = redis.ClearConversationCache(userID)
+
+	// 同步到用户的其他设备
+	eventBytes, _ := json.Marshal(map[string]interface{}{
+		"type":       "draft_updated",
+		"user_id":    peerID,
+		"content":    draft.Content,
+		"updated_at": draft.UpdatedAt.Unix(),
+	})
+	websocket.GetManager().SendToUserExcept(userID, connID, eventBytes)
+
+	return draft, nil
+}
+
+// GetDraft 获取与指定用户私聊的草稿（优先读取 Redis，未缓存时从数据库读取并缓存）
+func (s *MessageService) GetDraft(userID uint, peerIDStr string) (*redis.Draft, error) {
+	peerID, err := s.parsePeerID(userID, peerIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	field := redis.PrivateDraftField(peerID)
+	if draft, err := redis.GetDraft(userID, field); err == nil && draft != nil {
+		return draft, nil
+	}
+
+	entry, err := s.conversationRepo.GetPrivate(userID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	draft := &redis.Draft{}
+	if entry != nil && entry.DraftUpdatedAt != nil {
+		draft.Content = entry.Draft
+		draft.UpdatedAt = *entry.DraftUpdatedAt
+	}
+	_ = redis.SetDraft(userID, field, draft)
+	return draft, nil
+}
@@ -0,0 +1,524 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"im-system/config"
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/media"
+	"im-system/pkg/redis"
+	"im-system/pkg/storage"
+)
+
+// FileURLPrefix 附件下载地址前缀，完整地址为 FileURLPrefix + 附件ID
+const FileURLPrefix = "/api/v1/files/"
+
+var (
+	// ErrFileNotFound 附件不存在或无权访问（不区分两者，避免通过内容哈希探测文件是否存在）
+	ErrFileNotFound = errors.New("file not found")
+	// ErrChecksumMismatch 合并后的内容与创建上传时声明的 sha256 不一致
+	ErrChecksumMismatch = errors.New("sha256 mismatch")
+)
+
+var fileIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// FileInfo 附件信息
+type FileInfo struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Size         int64           `json:"size"`
+	Mime         string          `json:"mime"`
+	URL          string          `json:"url"`
+	Deduplicated bool            `json:"deduplicated"`           // 相同内容已存在，未重复存储
+	MediaStatus  string          `json:"media_status,omitempty"` // 图片处理状态：pending/processing/ready/failed
+	Width        int             `json:"width,omitempty"`        // 图片宽高，处理完成后返回
+	Height       int             `json:"height,omitempty"`
+	Thumbnails   []ThumbnailInfo `json:"thumbnails,omitempty"`
+}
+
+// ThumbnailInfo 缩略图信息
+type ThumbnailInfo struct {
+	Size   int    `json:"size"` // 规格（长边像素）
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// Download 待下载的内容
+type Download struct {
+	Reader io.ReadSeekCloser
+	Name   string
+	Mime   string
+	ETag   string
+	Final  bool // 内容不会再变化，可长期缓存
+}
+
+// UploadStatus 分片上传进度
+type UploadStatus struct {
+	UploadID    string `json:"upload_id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ChunkSize   int64  `json:"chunk_size"`
+	TotalChunks int    `json:"total_chunks"`
+	Received    []int  `json:"received"` // 已上传的分片序号（从0开始）
+}
+
+// FileService 附件服务
+type FileService struct {
+	fileRepo *repository.FileRepository
+	backend  storage.Backend
+	media    *MediaWorker
+	cfg      config.StorageConfig
+}
+
+// NewFileService 创建FileService实例
+func NewFileService(fileRepo *repository.FileRepository, backend storage.Backend, mediaWorker *MediaWorker, cfg config.StorageConfig) *FileService {
+	return &FileService{
+		fileRepo: fileRepo,
+		backend:  backend,
+		media:    mediaWorker,
+		cfg:      cfg,
+	}
+}
+
+// Upload 上传文件（整体上传）
+func (s *FileService) Upload(userID uint, name string, r io.Reader) (*FileInfo, error) {
+	if name == "" {
+		return nil, errors.New("file name is required")
+	}
+	return s.store(userID, name, r)
+}
+
+// InitUpload 创建分片上传会话，checksum 为可选的内容 sha256（十六进制），合并分片时校验
+func (s *FileService) InitUpload(userID uint, name string, size int64, checksum string) (*UploadStatus, error) {
+	if name == "" {
+		return nil, errors.New("file name is required")
+	}
+	if size <= 0 {
+		return nil, errors.New("invalid file size")
+	}
+	checksum = strings.ToLower(checksum)
+	if checksum != "" && !fileIDPattern.MatchString(checksum) {
+		return nil, errors.New("invalid sha256")
+	}
+	if size > s.cfg.MaxFileSize {
+		return nil, fmt.Errorf("file too large, max %d bytes", s.cfg.MaxFileSize)
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	session := &redis.UploadSession{
+		ID:          id,
+		UserID:      userID,
+		Name:        name,
+		Size:        size,
+		ChunkSize:   s.cfg.ChunkSize,
+		TotalChunks: int((size + s.cfg.ChunkSize - 1) / s.cfg.ChunkSize),
+		SHA256:      checksum,
+		CreatedAt:   time.Now(),
+	}
+	if err := redis.SaveUploadSession(session); err != nil {
+		return nil, err
+	}
+	return uploadStatus(session, []int{}), nil
+}
+
+// GetUploadStatus 获取分片上传进度，用于断点续传
+func (s *FileService) GetUploadStatus(userID uint, uploadID string) (*UploadStatus, error) {
+	session, err := s.getUploadSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	received, err := redis.GetUploadedChunks(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return uploadStatus(session, received), nil
+}
+
+// UploadChunk 上传单个分片，重复上传同一分片时覆盖
+// 除最后一片外，每片大小必须等于会话的 chunk_size
+func (s *FileService) UploadChunk(userID uint, uploadID string, index int, r io.Reader) error {
+	session, err := s.getUploadSession(userID, uploadID)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= session.TotalChunks {
+		return errors.New("invalid chunk index")
+	}
+
+	expected := session.ChunkSize
+	if index == session.TotalChunks-1 {
+		expected = session.Size - session.ChunkSize*int64(session.TotalChunks-1)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, expected+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != expected {
+		return fmt.Errorf("chunk %d must be %d bytes", index, expected)
+	}
+
+	if err := s.backend.Put(chunkKey(uploadID, index), bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return redis.AddUploadedChunk(uploadID, index)
+}
+
+// CompleteUpload 合并所有分片，生成附件
+func (s *FileService) CompleteUpload(userID uint, uploadID string) (*FileInfo, error) {
+	session, err := s.getUploadSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	received, err := redis.GetUploadedChunks(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(received) != session.TotalChunks {
+		return nil, fmt.Errorf("upload incomplete: %d of %d chunks received", len(received), session.TotalChunks)
+	}
+
+	keys := make([]string, session.TotalChunks)
+	for i := range keys {
+		keys[i] = chunkKey(uploadID, i)
+	}
+	// 校验声明的哈希（按上传的原始内容计算，图片清除位置信息前），不一致时保留分片，客户端可重传出错的分片
+	if session.SHA256 != "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, &chunkReader{backend: s.backend, keys: keys}); err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != session.SHA256 {
+			return nil, ErrChecksumMismatch
+		}
+	}
+	info, err := s.store(userID, session.Name, &chunkReader{backend: s.backend, keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	s.removeChunks(uploadID, session.TotalChunks)
+	return info, nil
+}
+
+// AbortUpload 取消分片上传，删除已上传的分片
+func (s *FileService) AbortUpload(userID uint, uploadID string) error {
+	session, err := s.getUploadSession(userID, uploadID)
+	if err != nil {
+		return err
+	}
+	s.removeChunks(uploadID, session.TotalChunks)
+	return nil
+}
+
+// Open 打开附件用于下载
+func (s *FileService) Open(userID uint, fileID string) (*Download, error) {
+	file, upload, err := s.authorize(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.backend.Open(fileKey(fileID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Download{Reader: reader, Name: upload.Name, Mime: file.Mime, ETag: fileID, Final: true}, nil
+}
+
+// OpenThumbnail 打开图片缩略图
+// 返回规格不小于 size 的最小缩略图（size 为0时返回最小的缩略图）；没有合适的缩略图时返回原图：
+// 原图长边不大于所需规格，或图片尚未处理完成。后者的内容之后会变化，不可长期缓存
+func (s *FileService) OpenThumbnail(userID uint, fileID string, size int) (*Download, error) {
+	file, upload, err := s.authorize(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !media.Supported(file.Mime) {
+		return nil, errors.New("file is not an image")
+	}
+
+	thumbnails, err := s.fileRepo.GetThumbnails(fileID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range thumbnails {
+		if t.Size < size {
+			continue
+		}
+		reader, err := s.backend.Open(thumbnailKey(fileID, t.Size))
+		if err != nil {
+			break
+		}
+		return &Download{
+			Reader: reader,
+			Name:   upload.Name,
+			Mime:   t.Mime,
+			ETag:   fmt.Sprintf("%s-%d", fileID, t.Size),
+			Final:  true,
+		}, nil
+	}
+
+	download, err := s.Open(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	download.Final = file.MediaStatus == model.MediaStatusReady || file.MediaStatus == model.MediaStatusFailed
+	return download, nil
+}
+
+// GetInfo 获取附件信息（含图片尺寸与缩略图）
+func (s *FileService) GetInfo(userID uint, fileID string) (*FileInfo, error) {
+	file, upload, err := s.authorize(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileInfo(file, upload.Name, false), nil
+}
+
+// authorize 校验附件访问权限，返回附件及用于确定文件名的上传记录
+// 上传者本人，或引用该附件的消息所在会话的参与者可以访问
+func (s *FileService) authorize(userID uint, fileID string) (*model.File, *model.FileUpload, error) {
+	if !fileIDPattern.MatchString(fileID) {
+		return nil, nil, ErrFileNotFound
+	}
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, nil, ErrFileNotFound
+	}
+
+	upload, err := s.fileRepo.GetUpload(fileID, userID)
+	if err != nil {
+		referenced, err := s.fileRepo.IsReferencedFor(fileID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !referenced {
+			return nil, nil, ErrFileNotFound
+		}
+		if upload, err = s.fileRepo.GetFirstUpload(fileID); err != nil {
+			return nil, nil, ErrFileNotFound
+		}
+	}
+	return file, upload, nil
+}
+
+// store 计算内容哈希并写入存储，相同内容只存储一份
+// 内容先写入临时文件并检查大小上限；图片在计算哈希前清除元数据中的位置信息，
+// 保证存储与下载的内容都不含位置，且哈希与存储内容一致
+func (s *FileService) store(userID uint, name string, r io.Reader) (*FileInfo, error) {
+	tmp, err := os.CreateTemp("", "im-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(r, s.cfg.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if size > s.cfg.MaxFileSize {
+		return nil, fmt.Errorf("file too large, max %d bytes", s.cfg.MaxFileSize)
+	}
+
+	mimeType := detectMime(tmp, name)
+	if media.Supported(mimeType) {
+		if _, err := media.StripLocation(tmp, size, mimeType); err != nil {
+			return nil, errors.New("invalid image file")
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(tmp, 0, size)); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(hash.Sum(nil))
+
+	file, err := s.fileRepo.GetByID(id)
+	deduplicated := err == nil
+	if !deduplicated {
+		file = &model.File{ID: id, Size: size, Mime: mimeType}
+		if media.Supported(mimeType) {
+			file.MediaStatus = model.MediaStatusPending
+		}
+	}
+
+	// 记录存在但对象丢失时重新写入
+	exists, err := s.backend.Exists(fileKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := s.backend.Put(fileKey(id), tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if !deduplicated {
+		if err := s.fileRepo.Create(file); err != nil {
+			return nil, err
+		}
+		if file.MediaStatus == model.MediaStatusPending {
+			s.media.Enqueue(id)
+		}
+	}
+	if err := s.fileRepo.AddUpload(&model.FileUpload{FileID: id, UserID: userID, Name: name}); err != nil {
+		return nil, err
+	}
+	return s.fileInfo(file, name, deduplicated), nil
+}
+
+// getUploadSession 获取当前用户的分片上传会话
+func (s *FileService) getUploadSession(userID uint, uploadID string) (*redis.UploadSession, error) {
+	session, err := redis.GetUploadSession(uploadID)
+	if err != nil || session.UserID != userID {
+		return nil, errors.New("upload not found")
+	}
+	return session, nil
+}
+
+// removeChunks 删除分片及上传会话
+func (s *FileService) removeChunks(uploadID string, totalChunks int) {
+	for i := 0; i < totalChunks; i++ {
+		_ = s.backend.Delete(chunkKey(uploadID, i))
+	}
+	_ = redis.DeleteUploadSession(uploadID)
+}
+
+// chunkReader 按顺序读取所有分片
+type chunkReader struct {
+	backend storage.Backend
+	keys    []string
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			reader, err := c.backend.Open(c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current = reader
+			c.keys = c.keys[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// detectMime 根据文件内容识别MIME类型，无法识别时按扩展名判断
+func detectMime(f *os.File, name string) string {
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	detected := http.DetectContentType(head[:n])
+	if detected == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(name)); byExt != "" {
+			return byExt
+		}
+	}
+	return detected
+}
+
+// fileKey 附件在存储中的key，按哈希前缀分目录
+func fileKey(id string) string {
+	return "files/" + id[:2] + "/" + id[2:4] + "/" + id
+}
+
+// chunkKey 分片在存储中的key
+func chunkKey(uploadID string, index int) string {
+	return fmt.Sprintf("uploads/%s/%d", uploadID, index)
+}
+
+// newUploadID 生成分片上传会话ID
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// fileInfo 组装附件信息，图片处理完成时附带缩略图列表
+func (s *FileService) fileInfo(file *model.File, name string, deduplicated bool) *FileInfo {
+	info := &FileInfo{
+		ID:           file.ID,
+		Name:         name,
+		Size:         file.Size,
+		Mime:         file.Mime,
+		URL:          FileURLPrefix + file.ID,
+		Deduplicated: deduplicated,
+		MediaStatus:  file.MediaStatus,
+		Width:        file.Width,
+		Height:       file.Height,
+	}
+	if file.MediaStatus != model.MediaStatusReady {
+		return info
+	}
+	thumbnails, err := s.fileRepo.GetThumbnails(file.ID)
+	if err != nil {
+		return info
+	}
+	for _, t := range thumbnails {
+		info.Thumbnails = append(info.Thumbnails, ThumbnailInfo{
+			Size:   t.Size,
+			Width:  t.Width,
+			Height: t.Height,
+			URL:    fmt.Sprintf("%s?size=%d", thumbnailURL(file.ID), t.Size),
+		})
+	}
+	return info
+}
+
+// thumbnailURL 缩略图下载地址，可通过 size 参数指定规格
+func thumbnailURL(fileID string) string {
+	return FileURLPrefix + fileID + "/thumbnail"
+}
+
+func uploadStatus(session *redis.UploadSession, received []int) *UploadStatus {
+	return &UploadStatus{
+		UploadID:    session.ID,
+		Name:        session.Name,
+		Size:        session.Size,
+		ChunkSize:   session.ChunkSize,
+		TotalChunks: session.TotalChunks,
+		Received:    received,
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"im-system/config"
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/redis"
+	"im-system/pkg/storage"
+)
+
+// newTestFileService 使用 sqlite、miniredis 和临时目录构造附件服务，分片大小为4字节
+func newTestFileService(t *testing.T) (*FileService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.File{}, &model.FileThumbnail{}, &model.FileUpload{}, &model.Message{}, &model.GroupMember{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	if err := redis.InitRedis(config.RedisConfig{Host: mr.Host(), Port: port}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = redis.Close() })
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.StorageConfig{MaxFileSize: 1 << 20, ChunkSize: 4}
+	return NewFileService(repository.NewFileRepository(db), backend, nil, cfg), db
+}
+
+// readFile 以 userID 身份下载附件并返回内容
+func readFile(t *testing.T, s *FileService, userID uint, fileID string) []byte {
+	t.Helper()
+	d, err := s.Open(userID, fileID)
+	if err != nil {
+		t.Fatalf("open %s as user %d: %v", fileID, userID, err)
+	}
+	defer d.Reader.Close()
+	data, err := io.ReadAll(d.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChunkedUploadOutOfOrderAndDuplicate(t *testing.T) {
+	s, _ := newTestFileService(t)
+	content := []byte("hello, chunked world")
+
+	status, err := s.InitUpload(1, "a.txt", int64(len(content)), sha256Hex(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TotalChunks != 5 {
+		t.Fatalf("total chunks = %d, want 5", status.TotalChunks)
+	}
+
+	// 倒序上传，且第2片先传错误内容再重传（覆盖）
+	chunk := func(i int) []byte { return content[i*4 : min((i+1)*4, len(content))] }
+	for _, i := range []int{4, 3, 2, 1, 0} {
+		data := chunk(i)
+		if i == 2 {
+			if err := s.UploadChunk(1, status.UploadID, i, bytes.NewReader([]byte("XXXX"))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.UploadChunk(1, status.UploadID, i, bytes.NewReader(data)); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+
+	progress, err := s.GetUploadStatus(1, status.UploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress.Received) != 5 {
+		t.Fatalf("received = %v, want 5 chunks", progress.Received)
+	}
+
+	info, err := s.CompleteUpload(1, status.UploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != sha256Hex(content) || info.Size != int64(len(content)) {
+		t.Fatalf("info = %+v", info)
+	}
+	if got := readFile(t, s, 1, info.ID); !bytes.Equal(got, content) {
+		t.Fatalf("content = %q, want %q", got, content)
+	}
+}
+
+func TestChunkedUploadRejectsBadChunks(t *testing.T) {
+	s, _ := newTestFileService(t)
+	status, err := s.InitUpload(1, "a.txt", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UploadChunk(1, status.UploadID, 3, bytes.NewReader([]byte("abcd"))); err == nil {
+		t.Fatal("chunk index out of range accepted")
+	}
+	if err := s.UploadChunk(1, status.UploadID, 0, bytes.NewReader([]byte("abc"))); err == nil {
+		t.Fatal("short chunk accepted")
+	}
+	if err := s.UploadChunk(1, status.UploadID, 2, bytes.NewReader([]byte("abcd"))); err == nil {
+		t.Fatal("oversized last chunk accepted")
+	}
+	if err := s.UploadChunk(2, status.UploadID, 0, bytes.NewReader([]byte("abcd"))); err == nil {
+		t.Fatal("chunk accepted from another user")
+	}
+
+	if err := s.UploadChunk(1, status.UploadID, 0, bytes.NewReader([]byte("abcd"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteUpload(1, status.UploadID); err == nil {
+		t.Fatal("incomplete upload completed")
+	}
+}
+
+func TestChunkedUploadChecksumMismatch(t *testing.T) {
+	s, db := newTestFileService(t)
+	content := []byte("12345678")
+
+	if _, err := s.InitUpload(1, "a.txt", 8, "not-a-hash"); err == nil {
+		t.Fatal("invalid sha256 accepted")
+	}
+
+	status, err := s.InitUpload(1, "a.txt", 8, sha256Hex([]byte("87654321")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.UploadChunk(1, status.UploadID, i, bytes.NewReader(content[i*4:(i+1)*4])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.CompleteUpload(1, status.UploadID); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("complete err = %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	var count int64
+	db.Model(&model.File{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d files stored after checksum mismatch", count)
+	}
+	// 分片保留，会话仍可查询进度
+	progress, err := s.GetUploadStatus(1, status.UploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress.Received) != 2 {
+		t.Fatalf("received = %v, want chunks kept", progress.Received)
+	}
+}
+
+func TestUploadDeduplicatesIdenticalContent(t *testing.T) {
+	s, db := newTestFileService(t)
+	content := []byte("same content")
+
+	first, err := s.Upload(1, "a.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Deduplicated {
+		t.Fatal("first upload marked as deduplicated")
+	}
+	second, err := s.Upload(2, "b.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Deduplicated || second.ID != first.ID {
+		t.Fatalf("second = %+v, want deduplicated %s", second, first.ID)
+	}
+
+	var files, uploads int64
+	db.Model(&model.File{}).Count(&files)
+	db.Model(&model.FileUpload{}).Count(&uploads)
+	if files != 1 || uploads != 2 {
+		t.Fatalf("files = %d, uploads = %d, want 1 and 2", files, uploads)
+	}
+
+	// 各自按自己上传时的文件名下载
+	d, err := s.Open(2, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Reader.Close()
+	if d.Name != "b.txt" {
+		t.Fatalf("name = %q, want b.txt", d.Name)
+	}
+}
+
+func TestOpenRequiresConversationParticipant(t *testing.T) {
+	s, db := newTestFileService(t)
+	content := []byte("private attachment")
+
+	info, err := s.Upload(1, "a.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID := uint(10)
+	messages := []*model.Message{
+		{SenderID: 1, ReceiverID: 2, ConvKey: "private:1:2", Seq: 1, Content: "[文件]", MsgType: model.MsgTypeFile, FileID: info.ID, Status: "sent"},
+		{SenderID: 1, SessionType: 2, GroupID: &groupID, ConvKey: "group:10", Seq: 1, Content: "[文件]", MsgType: model.MsgTypeFile, FileID: info.ID, Status: "sent"},
+	}
+	if err := db.Create(messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.GroupMember{GroupID: groupID, UserID: 4}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 私聊接收者、群成员可以下载
+	for _, userID := range []uint{2, 4} {
+		if got := readFile(t, s, userID, info.ID); !bytes.Equal(got, content) {
+			t.Fatalf("user %d content = %q", userID, got)
+		}
+	}
+	// 不在会话中的用户与不存在的附件返回相同错误
+	if _, err := s.Open(3, info.ID); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("non-participant err = %v, want %v", err, ErrFileNotFound)
+	}
+	if _, err := s.Open(3, sha256Hex([]byte("missing"))); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("missing file err = %v, want %v", err, ErrFileNotFound)
+	}
+
+	// 消息撤回后接收者失去下载权限
+	if err := db.Model(&model.Message{}).Where("receiver_id = ?", 2).Update("status", "recalled").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(2, info.ID); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("recalled err = %v, want %v", err, ErrFileNotFound)
+	}
+}
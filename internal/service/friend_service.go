@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/websocket"
+)
+
+// ErrBlocked 双方存在拉黑关系
+var ErrBlocked = errors.New("user is blocked")
+
+// FriendService 好友服务
+type FriendService struct {
+	friendshipRepo *repository.FriendshipRepository
+	userRepo       *repository.UserRepository
+}
+
+// NewFriendService 创建FriendService实例
+func NewFriendService(friendshipRepo *repository.FriendshipRepository, userRepo *repository.UserRepository) *FriendService {
+	return &FriendService{
+		friendshipRepo: friendshipRepo,
+		userRepo:       userRepo,
+	}
+}
+
+// SendRequest 发送好友请求，并实时推送给对方
+func (s *FriendService) SendRequest(userID uint, toUserIDStr string) (*model.Friendship, error) {
+	toUserID, err := strconv.ParseUint(toUserIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+	if uint(toUserID) == userID {
+		return nil, errors.New("cannot add yourself as a friend")
+	}
+
+	// 检查对方是否存在
+	if _, err := s.userRepo.GetByID(uint(toUserID)); err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// 存在拉黑关系时不允许发送请求
+	blocked, err := s.friendshipRepo.IsBlocked(userID, uint(toUserID))
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	// 检查是否已有请求或已是好友
+	existing, err := s.friendshipRepo.GetFriendship(userID, uint(toUserID))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Status == model.FriendshipAccepted {
+			return nil, errors.New("already friends")
+		}
+		return nil, errors.New("friend request already exists")
+	}
+
+	friendship := &model.Friendship{
+		UserID:   userID,
+		FriendID: uint(toUserID),
+		Status:   model.FriendshipPending,
+	}
+	if err := s.friendshipRepo.Create(friendship); err != nil {
+		return nil, err
+	}
+
+	// WebSocket推送
+	pushFriendEvent(friendship.FriendID, "friend_request", userID, friendship)
+
+	return friendship, nil
+}
+
+// AcceptRequest 接受好友请求（仅接收方可操作），并通知发起方
+func (s *FriendService) AcceptRequest(userID uint, requestIDStr string) (*model.Friendship, error) {
+	friendship, err := s.getPendingRequest(requestIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if friendship.FriendID != userID {
+		return nil, errors.New("permission denied")
+	}
+
+	if err := s.friendshipRepo.UpdateStatus(friendship.ID, model.FriendshipAccepted); err != nil {
+		return nil, err
+	}
+	friendship.Status = model.FriendshipAccepted
+
+	// WebSocket推送
+	pushFriendEvent(friendship.UserID, "friend_accepted", userID, friendship)
+
+	return friendship, nil
+}
+
+// RejectRequest 拒绝好友请求（仅接收方可操作）
+func (s *FriendService) RejectRequest(userID uint, requestIDStr string) error {
+	friendship, err := s.getPendingRequest(requestIDStr)
+	if err != nil {
+		return err
+	}
+	if friendship.FriendID != userID {
+		return errors.New("permission denied")
+	}
+
+	return s.friendshipRepo.Delete(friendship.ID)
+}
+
+// CancelRequest 撤回好友请求（仅发起方可操作）
+func (s *FriendService) CancelRequest(userID uint, requestIDStr string) error {
+	friendship, err := s.getPendingRequest(requestIDStr)
+	if err != nil {
+		return err
+	}
+	if friendship.UserID != userID {
+		return errors.New("permission denied")
+	}
+
+	return s.friendshipRepo.Delete(friendship.ID)
+}
+
+// GetReceivedRequests 获取收到的待处理好友请求
+func (s *FriendService) GetReceivedRequests(userID uint) ([]*model.Friendship, error) {
+	return s.friendshipRepo.GetReceivedRequests(userID)
+}
+
+// GetSentRequests 获取发出的待处理好友请求
+func (s *FriendService) GetSentRequests(userID uint) ([]*model.Friendship, error) {
+	return s.friendshipRepo.GetSentRequests(userID)
+}
+
+// GetFriends 获取好友列表
+func (s *FriendService) GetFriends(userID uint) ([]*model.User, error) {
+	ids, err := s.friendshipRepo.GetFriendIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetByIDs(ids)
+}
+
+// RemoveFriend 删除好友（双向解除）
+func (s *FriendService) RemoveFriend(userID uint, friendIDStr string) error {
+	friendID, err := strconv.ParseUint(friendIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	friendship, err := s.friendshipRepo.GetFriendship(userID, uint(friendID))
+	if err != nil {
+		return err
+	}
+	if friendship == nil || friendship.Status != model.FriendshipAccepted {
+		return errors.New("not friends")
+	}
+
+	return s.friendshipRepo.Delete(friendship.ID)
+}
+
+// BlockUser 拉黑用户，同时解除已有的好友请求或好友关系
+func (s *FriendService) BlockUser(userID uint, targetIDStr string) error {
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	if uint(targetID) == userID {
+		return errors.New("cannot block yourself")
+	}
+
+	if _, err := s.userRepo.GetByID(uint(targetID)); err != nil {
+		return errors.New("user not found")
+	}
+
+	existing, err := s.friendshipRepo.GetBlock(userID, uint(targetID))
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errors.New("user already blocked")
+	}
+
+	return s.friendshipRepo.Block(userID, uint(targetID))
+}
+
+// UnblockUser 取消拉黑
+func (s *FriendService) UnblockUser(userID uint, targetIDStr string) error {
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+
+	existing, err := s.friendshipRepo.GetBlock(userID, uint(targetID))
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return errors.New("user is not blocked")
+	}
+
+	return s.friendshipRepo.Delete(existing.ID)
+}
+
+// GetBlockedUsers 获取黑名单
+func (s *FriendService) GetBlockedUsers(userID uint) ([]*model.User, error) {
+	ids, err := s.friendshipRepo.GetBlockedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetByIDs(ids)
+}
+
+// IsBlocked 判断两个用户之间是否存在拉黑关系
+func (s *FriendService) IsBlocked(userID, otherUserID uint) (bool, error) {
+	return s.friendshipRepo.IsBlocked(userID, otherUserID)
+}
+
+// GetBlockRelatedIDs 获取与用户存在拉黑关系的用户ID集合（用于隐藏在线状态等）
+func (s *FriendService) GetBlockRelatedIDs(userID uint) (map[uint]bool, error) {
+	return s.friendshipRepo.GetBlockRelatedIDs(userID)
+}
+
+// getPendingRequest 根据ID获取待处理的好友请求
+func (s *FriendService) getPendingRequest(requestIDStr string) (*model.Friendship, error) {
+	requestID, err := strconv.ParseUint(requestIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid request ID")
+	}
+
+	friendship, err := s.friendshipRepo.GetByID(uint(requestID))
+	if err != nil {
+		return nil, err
+	}
+	if friendship.Status != model.FriendshipPending {
+		return nil, errors.New("friend request is not pending")
+	}
+
+	return friendship, nil
+}
+
+// pushFriendEvent 推送好友相关事件（对方离线时不入离线队列，上线后可通过接口查询）
+func pushFriendEvent(toUserID uint, eventType string, fromUserID uint, friendship *model.Friendship) {
+	data := map[string]interface{}{
+		"type":       eventType,
+		"from":       fromUserID,
+		"request_id": friendship.ID,
+		"timestamp":  time.Now().Unix(),
+	}
+	msgBytes, _ := json.Marshal(data)
+	websocket.GetManager().SendToUser(toUserID, msgBytes)
+}
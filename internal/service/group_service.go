@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"im-system/internal/model"
+	"im-system/internal/repository"
+)
+
+// GroupService 群组服务
+type GroupService struct {
+	groupRepo *repository.GroupRepository
+	userRepo  *repository.UserRepository
+}
+
+// NewGroupService 创建GroupService实例
+func NewGroupService(groupRepo *repository.GroupRepository, userRepo *repository.UserRepository) *GroupService {
+	return &GroupService{
+		groupRepo: groupRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// CreateGroup 创建群组，创建者自动成为群主
+func (s *GroupService) CreateGroup(ownerID uint, name string, memberIDs []uint) (*model.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("group name is required")
+	}
+
+	// 初始成员去重并排除群主自己（群主由仓库层单独写入）
+	memberIDs = uniqueMemberIDs(memberIDs, ownerID)
+
+	// 检查初始成员是否存在
+	for _, id := range memberIDs {
+		if _, err := s.userRepo.GetByID(id); err != nil {
+			return nil, errors.New("member not found")
+		}
+	}
+
+	group := &model.Group{
+		Name:    name,
+		OwnerID: ownerID,
+	}
+	if err := s.groupRepo.Create(group, memberIDs); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// uniqueMemberIDs 去除重复、为0以及等于 excludeID 的用户ID，保持原有顺序
+func uniqueMemberIDs(ids []uint, excludeID uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || id == excludeID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// GetUserGroups 获取用户加入的群组列表
+func (s *GroupService) GetUserGroups(userID uint) ([]*model.Group, error) {
+	return s.groupRepo.GetUserGroups(userID)
+}
+
+// GetMembers 获取群成员列表（仅群成员可查看）
+func (s *GroupService) GetMembers(userID uint, groupIDStr string) ([]*model.GroupMember, error) {
+	group, _, err := s.checkMember(groupIDStr, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupRepo.GetMembers(group.ID)
+}
+
+// InviteMembers 邀请用户入群（群成员均可邀请），返回实际新加入的用户ID
+func (s *GroupService) InviteMembers(operatorID uint, groupIDStr string, userIDs []uint) ([]uint, error) {
+	group, _, err := s.checkMember(groupIDStr, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userIDs) == 0 {
+		return nil, errors.New("user_ids is required")
+	}
+	for _, id := range userIDs {
+		if _, err := s.userRepo.GetByID(id); err != nil {
+			return nil, errors.New("user not found")
+		}
+	}
+
+	return s.groupRepo.AddMembers(group.ID, userIDs)
+}
+
+// KickMember 移除群成员
+// 群主可移除管理员和普通成员，管理员只能移除普通成员
+func (s *GroupService) KickMember(operatorID uint, groupIDStr, targetIDStr string) error {
+	group, operator, err := s.checkMember(groupIDStr, operatorID)
+	if err != nil {
+		return err
+	}
+
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	if uint(targetID) == operatorID {
+		return errors.New("cannot kick yourself, use leave instead")
+	}
+
+	target, err := s.groupRepo.GetMember(group.ID, uint(targetID))
+	if err != nil {
+		return errors.New("target is not a group member")
+	}
+
+	if !canManage(operator.Role, target.Role) {
+		return errors.New("permission denied")
+	}
+
+	return s.groupRepo.RemoveMember(group.ID, uint(targetID))
+}
+
+// LeaveGroup 退出群组（群主需先转让群主）
+func (s *GroupService) LeaveGroup(userID uint, groupIDStr string) error {
+	group, member, err := s.checkMember(groupIDStr, userID)
+	if err != nil {
+		return err
+	}
+
+	if member.Role == model.GroupRoleOwner {
+		return errors.New("owner cannot leave the group, transfer ownership first")
+	}
+
+	return s.groupRepo.RemoveMember(group.ID, userID)
+}
+
+// TransferOwnership 转让群主（仅群主可操作）
+func (s *GroupService) TransferOwnership(operatorID uint, groupIDStr, newOwnerIDStr string) error {
+	group, operator, err := s.checkMember(groupIDStr, operatorID)
+	if err != nil {
+		return err
+	}
+	if operator.Role != model.GroupRoleOwner {
+		return errors.New("permission denied")
+	}
+
+	newOwnerID, err := strconv.ParseUint(newOwnerIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	if uint(newOwnerID) == operatorID {
+		return errors.New("you are already the owner")
+	}
+	if _, err := s.groupRepo.GetMember(group.ID, uint(newOwnerID)); err != nil {
+		return errors.New("new owner must be a group member")
+	}
+
+	return s.groupRepo.TransferOwner(group.ID, operatorID, uint(newOwnerID))
+}
+
+// SetMemberRole 设置成员角色（仅群主可操作，只能在admin/member之间切换）
+func (s *GroupService) SetMemberRole(operatorID uint, groupIDStr, targetIDStr, role string) error {
+	group, operator, err := s.checkMember(groupIDStr, operatorID)
+	if err != nil {
+		return err
+	}
+	if operator.Role != model.GroupRoleOwner {
+		return errors.New("permission denied")
+	}
+
+	if role != model.GroupRoleAdmin && role != model.GroupRoleMember {
+		return errors.New("invalid role")
+	}
+
+	targetID, err := strconv.ParseUint(targetIDStr, 10, 32)
+	if err != nil {
+		return errors.New("invalid user ID")
+	}
+	if uint(targetID) == operatorID {
+		return errors.New("cannot change your own role")
+	}
+	if _, err := s.groupRepo.GetMember(group.ID, uint(targetID)); err != nil {
+		return errors.New("target is not a group member")
+	}
+
+	return s.groupRepo.UpdateMemberRole(group.ID, uint(targetID), role)
+}
+
+// checkMember 校验群组存在且用户为群成员，返回群组和成员信息
+func (s *GroupService) checkMember(groupIDStr string, userID uint) (*model.Group, *model.GroupMember, error) {
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		return nil, nil, errors.New("invalid group ID")
+	}
+
+	group, err := s.groupRepo.GetByID(uint(groupID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	member, err := s.groupRepo.GetMember(group.ID, userID)
+	if err != nil {
+		return nil, nil, errors.New("permission denied")
+	}
+
+	return group, member, nil
+}
+
+// canManage 判断操作者角色是否可以管理目标角色
+func canManage(operatorRole, targetRole string) bool {
+	switch operatorRole {
+	case model.GroupRoleOwner:
+		return targetRole != model.GroupRoleOwner
+	case model.GroupRoleAdmin:
+		return targetRole == model.GroupRoleMember
+	default:
+		return false
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"im-system/config"
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/logger"
+	"im-system/pkg/redis"
+
+	"go.uber.org/zap"
+)
+
+// 未配置时的登录限制
+const (
+	defaultMaxAccountFailures = 10
+	defaultMaxIPFailures      = 100
+	defaultFailureWindow      = 15 * time.Minute
+	defaultBackoffAfter       = 3
+	defaultBackoffBase        = time.Second
+	defaultBackoffMax         = time.Minute
+	defaultLockoutDuration    = 15 * time.Minute
+)
+
+var (
+	// ErrInvalidCredentials 账号或密码错误（不区分账号是否存在）
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+	// ErrLoginLocked 账号或来源IP因登录失败过多被临时锁定
+	ErrLoginLocked = errors.New("too many failed login attempts, login temporarily locked")
+	// ErrLoginThrottled 连续登录失败，需等待退避时间后再试
+	ErrLoginThrottled = errors.New("too many failed login attempts, please retry later")
+)
+
+// LoginBlockedError 登录被限制，RetryAfter 为需要等待的时间
+type LoginBlockedError struct {
+	Err        error // ErrLoginLocked 或 ErrLoginThrottled
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%s (retry after %ds)", e.Err.Error(), e.RetrySeconds())
+}
+
+func (e *LoginBlockedError) Unwrap() error { return e.Err }
+
+// RetrySeconds 需要等待的秒数（向上取整）
+func (e *LoginBlockedError) RetrySeconds() int64 {
+	return int64((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// LoginGuard 登录防暴力破解：按账号与来源IP统计失败次数（Redis），账号连续失败后指数退避，超过阈值临时锁定
+type LoginGuard struct {
+	cfg       config.AuthConfig
+	auditRepo *repository.AuditLogRepository
+}
+
+// NewLoginGuard 创建LoginGuard实例，未配置的阈值使用默认值
+func NewLoginGuard(cfg config.AuthConfig, auditRepo *repository.AuditLogRepository) *LoginGuard {
+	if cfg.MaxAccountFailures <= 0 {
+		cfg.MaxAccountFailures = defaultMaxAccountFailures
+	}
+	if cfg.MaxIPFailures <= 0 {
+		cfg.MaxIPFailures = defaultMaxIPFailures
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = defaultFailureWindow
+	}
+	if cfg.BackoffAfter <= 0 {
+		cfg.BackoffAfter = defaultBackoffAfter
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = defaultBackoffBase
+	}
+	if cfg.BackoffMax <= 0 {
+		cfg.BackoffMax = defaultBackoffMax
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = defaultLockoutDuration
+	}
+	return &LoginGuard{cfg: cfg, auditRepo: auditRepo}
+}
+
+// CheckIP 检查来源IP是否被锁定
+func (g *LoginGuard) CheckIP(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	return g.check(redis.LoginSubjectIP(ip))
+}
+
+// CheckAccount 检查账号是否被锁定或处于退避中
+func (g *LoginGuard) CheckAccount(userID uint) error {
+	return g.check(redis.LoginSubjectUser(userID))
+}
+
+// check 查询登录限制，Redis 不可用时不限制登录
+func (g *LoginGuard) check(subject string) error {
+	locked, retryAfter, err := redis.GetLoginBlock(subject)
+	if err != nil {
+		logger.Warn("查询登录限制失败", zap.String("subject", subject), zap.Error(err))
+		return nil
+	}
+	if locked {
+		return &LoginBlockedError{Err: ErrLoginLocked, RetryAfter: retryAfter}
+	}
+	if retryAfter > 0 {
+		return &LoginBlockedError{Err: ErrLoginThrottled, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail 记录一次登录失败（userID 为0表示账号不存在），返回本次失败触发的锁定（未触发时为nil）
+func (g *LoginGuard) Fail(userID uint, ip string) error {
+	var blocked error
+	if ip != "" {
+		subject := redis.LoginSubjectIP(ip)
+		if n, err := redis.IncrLoginFailures(subject, g.cfg.FailureWindow); err == nil && n >= int64(g.cfg.MaxIPFailures) {
+			g.lock(subject, model.AuditLoginIPLocked, 0, ip, n)
+			blocked = &LoginBlockedError{Err: ErrLoginLocked, RetryAfter: g.cfg.LockoutDuration}
+		}
+	}
+	if userID == 0 {
+		return blocked
+	}
+
+	subject := redis.LoginSubjectUser(userID)
+	n, err := redis.IncrLoginFailures(subject, g.cfg.FailureWindow)
+	if err != nil {
+		return blocked
+	}
+	if n >= int64(g.cfg.MaxAccountFailures) {
+		g.lock(subject, model.AuditLoginLocked, userID, ip, n)
+		return &LoginBlockedError{Err: ErrLoginLocked, RetryAfter: g.cfg.LockoutDuration}
+	}
+	if n >= int64(g.cfg.BackoffAfter) {
+		_ = redis.SetLoginBackoff(subject, g.backoff(n))
+	}
+	return blocked
+}
+
+// Succeed 登录成功后清空账号的失败计数（来源IP的计数保留，避免用一个有效账号重置IP计数）
+func (g *LoginGuard) Succeed(userID uint) {
+	_ = redis.ClearLoginFailures(redis.LoginSubjectUser(userID))
+}
+
+// Clear 解除账号锁定并清空失败计数，不记录审计日志（重置密码后调用）
+func (g *LoginGuard) Clear(userID uint) {
+	_ = redis.UnlockLogin(redis.LoginSubjectUser(userID))
+}
+
+// Unlock 解除账号锁定并清空失败计数，actorID 为执行解锁的管理员
+func (g *LoginGuard) Unlock(userID, actorID uint) error {
+	if err := redis.UnlockLogin(redis.LoginSubjectUser(userID)); err != nil {
+		return err
+	}
+	g.audit(&model.AuditLog{Action: model.AuditLoginUnlocked, UserID: userID, ActorID: actorID})
+	return nil
+}
+
+// backoff 第 n 次连续失败后的退避时间：BackoffBase*2^(n-BackoffAfter)，不超过 BackoffMax
+func (g *LoginGuard) backoff(n int64) time.Duration {
+	d := g.cfg.BackoffBase
+	for i := int64(g.cfg.BackoffAfter); i < n && d < g.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > g.cfg.BackoffMax {
+		d = g.cfg.BackoffMax
+	}
+	return d
+}
+
+// lock 锁定账号或IP并写入审计日志
+func (g *LoginGuard) lock(subject, action string, userID uint, ip string, failures int64) {
+	if err := redis.LockLogin(subject, g.cfg.LockoutDuration); err != nil {
+		logger.Error("锁定登录失败", zap.String("subject", subject), zap.Error(err))
+	}
+	g.audit(&model.AuditLog{
+		Action: action,
+		UserID: userID,
+		IP:     ip,
+		Detail: fmt.Sprintf("%d failed attempts, locked for %s", failures, g.cfg.LockoutDuration),
+	})
+}
+
+// audit 写入审计日志
+func (g *LoginGuard) audit(entry *model.AuditLog) {
+	recordAudit(g.auditRepo, entry)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"im-system/config"
+	"im-system/internal/model"
+	"im-system/internal/repository"
+	"im-system/pkg/logger"
+	"im-system/pkg/media"
+	"im-system/pkg/storage"
+
+	"go.uber.org/zap"
+)
+
+// 图片处理相关常量
+const (
+	mediaQueueSize     = 256              // 待处理队列长度，队列满时由定时扫描补偿
+	mediaSweepInterval = time.Minute      // 扫描待处理图片的间隔
+	mediaStaleTimeout  = 10 * time.Minute // 处理中超过该时间视为处理节点已退出，允许重新处理
+)
+
+// MediaWorker 图片后台处理
+// 上传图片后入队，由后台协程提取尺寸、生成缩略图并写入附件记录；
+// 入队失败或服务重启时未处理完的图片由定时扫描重新入队，多实例部署时通过状态抢占避免重复处理
+type MediaWorker struct {
+	fileRepo *repository.FileRepository
+	backend  storage.Backend
+	cfg      config.MediaConfig
+	queue    chan string
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewMediaWorker 创建MediaWorker实例
+func NewMediaWorker(fileRepo *repository.FileRepository, backend storage.Backend, cfg config.MediaConfig) *MediaWorker {
+	return &MediaWorker{
+		fileRepo: fileRepo,
+		backend:  backend,
+		cfg:      cfg,
+		queue:    make(chan string, mediaQueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 启动后台处理协程
+func (w *MediaWorker) Start() {
+	workers := max(w.cfg.Workers, 1)
+	for i := 0; i < workers; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+	w.wg.Add(1)
+	go w.sweep()
+}
+
+// Stop 停止后台处理，等待正在处理的图片完成
+func (w *MediaWorker) Stop() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+// Enqueue 提交待处理的图片，队列已满时忽略（由定时扫描补偿）
+func (w *MediaWorker) Enqueue(fileID string) {
+	select {
+	case w.queue <- fileID:
+	default:
+	}
+}
+
+func (w *MediaWorker) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case id := <-w.queue:
+			w.process(id)
+		}
+	}
+}
+
+// sweep 启动时及之后定时扫描待处理的图片
+func (w *MediaWorker) sweep() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(mediaSweepInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := w.fileRepo.ListMediaPending(media.SupportedTypes, time.Now().Add(-mediaStaleTimeout), mediaQueueSize)
+		if err != nil {
+			logger.Warn("扫描待处理图片失败", zap.Error(err))
+		}
+		for _, id := range ids {
+			w.Enqueue(id)
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process 处理单张图片
+// 图片无法解码或超出像素上限时标记为失败；存储或数据库错误时保持处理中状态，超时后重新处理
+func (w *MediaWorker) process(id string) {
+	claimed, err := w.fileRepo.ClaimMedia(id, media.SupportedTypes, time.Now().Add(-mediaStaleTimeout))
+	if err != nil || !claimed {
+		return
+	}
+	file, err := w.fileRepo.GetByID(id)
+	if err != nil {
+		return
+	}
+
+	tmp, err := w.fetch(id)
+	if err != nil {
+		logger.Warn("读取待处理图片失败", zap.String("file_id", id), zap.Error(err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// 启用缩略图前上传的图片不清除位置信息：附件按内容寻址，改写内容会使ID与内容不一致，
+	// 缩略图重新编码，不含原图元数据
+	result, err := media.Process(tmp, file.Size, file.Mime, media.Options{
+		Sizes:       w.cfg.ThumbnailSizes,
+		JPEGQuality: w.cfg.JPEGQuality,
+		MaxPixels:   w.cfg.MaxPixels,
+	})
+	if err != nil {
+		logger.Warn("图片处理失败", zap.String("file_id", id), zap.Error(err))
+		_ = w.fileRepo.SetMediaStatus(id, model.MediaStatusFailed)
+		return
+	}
+
+	thumbnails := make([]model.FileThumbnail, 0, len(result.Thumbnails))
+	for _, t := range result.Thumbnails {
+		if err := w.backend.Put(thumbnailKey(id, t.Size), bytes.NewReader(t.Data)); err != nil {
+			logger.Warn("保存缩略图失败", zap.String("file_id", id), zap.Error(err))
+			return
+		}
+		thumbnails = append(thumbnails, model.FileThumbnail{
+			FileID: id,
+			Size:   t.Size,
+			Width:  t.Width,
+			Height: t.Height,
+			Mime:   t.Mime,
+			Bytes:  int64(len(t.Data)),
+		})
+	}
+	if err := w.fileRepo.SaveMediaResult(id, result.Width, result.Height, thumbnails); err != nil {
+		logger.Warn("保存图片处理结果失败", zap.String("file_id", id), zap.Error(err))
+	}
+}
+
+// fetch 将图片复制到临时文件，便于随机读取
+func (w *MediaWorker) fetch(id string) (*os.File, error) {
+	reader, err := w.backend.Open(fileKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "im-media-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// thumbnailKey 缩略图在存储中的key
+func thumbnailKey(id string, size int) string {
+	return fmt.Sprintf("thumbs/%s/%s/%s_%d", id[:2], id[2:4], id, size)
+}
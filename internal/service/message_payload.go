@@ -0,0 +1,215 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"im-system/internal/model"
+)
+
+// ImagePayload 图片消息
+// 图片、文件、语音消息可以用 file_id 引用已上传的附件，服务端据此填充 url 等字段
+// 引用已上传的图片时，服务端同时填充缩略图地址，图片已处理完成时宽高以服务端提取的为准
+type ImagePayload struct {
+	FileID       string `json:"file_id,omitempty"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// FilePayload 文件消息
+type FilePayload struct {
+	FileID string `json:"file_id,omitempty"`
+	URL    string `json:"url"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Mime   string `json:"mime"`
+}
+
+// VoicePayload 语音消息，Duration 单位为秒
+type VoicePayload struct {
+	FileID   string `json:"file_id,omitempty"`
+	URL      string `json:"url"`
+	Duration int    `json:"duration"`
+}
+
+// LocationPayload 位置消息
+type LocationPayload struct {
+	Lat     *float64 `json:"lat"`
+	Lng     *float64 `json:"lng"`
+	Name    string   `json:"name,omitempty"`
+	Address string   `json:"address,omitempty"`
+}
+
+// CardPayload 链接/卡片消息
+type CardPayload struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// 语音消息最大时长（秒）
+const maxVoiceDuration = 300
+
+// messageBody 校验后的消息内容
+type messageBody struct {
+	MsgType string
+	Content string          // 文本内容，非文本消息为说明文字或摘要
+	Payload json.RawMessage // 规范化后的结构化内容，文本消息为nil
+	FileID  string          // 引用的附件ID
+}
+
+// fileLookup 获取发送者上传过的附件及上传时的文件名，附件不存在或不属于发送者时返回错误
+type fileLookup func(fileID string) (*model.File, string, error)
+
+// buildMessageBody 校验消息类型与结构化内容
+// 文本消息不带 payload；其他类型的 content 为可选说明，为空时使用 "[图片]" 等摘要，便于会话列表与离线消息展示
+func buildMessageBody(msgType, content string, payload json.RawMessage, lookup fileLookup) (*messageBody, error) {
+	if msgType == "" {
+		msgType = model.MsgTypeText
+	}
+
+	var body interface{}
+	var summary string
+	var fileID string
+	switch msgType {
+	case model.MsgTypeText:
+		if strings.TrimSpace(content) == "" {
+			return nil, errors.New("content is required")
+		}
+		return &messageBody{MsgType: msgType, Content: content}, nil
+	case model.MsgTypeImage:
+		var p ImagePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.FileID != "" {
+			file, _, err := lookup(p.FileID)
+			if err != nil {
+				return nil, err
+			}
+			p.URL, p.ThumbnailURL, fileID = FileURLPrefix+file.ID, thumbnailURL(file.ID), file.ID
+			if file.MediaStatus == model.MediaStatusReady {
+				p.Width, p.Height = file.Width, file.Height
+			}
+		}
+		if p.URL == "" {
+			return nil, errors.New("image url is required")
+		}
+		if p.FileID == "" && (!isHTTPURL(p.URL) || (p.ThumbnailURL != "" && !isHTTPURL(p.ThumbnailURL))) {
+			return nil, errors.New("image url must be http(s) when file_id is not given")
+		}
+		if p.Width < 0 || p.Height < 0 {
+			return nil, errors.New("invalid image size")
+		}
+		body, summary = p, "[图片]"
+	case model.MsgTypeFile:
+		var p FilePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.FileID != "" {
+			// 大小与类型以服务端记录为准，文件名默认使用上传时的名称
+			file, name, err := lookup(p.FileID)
+			if err != nil {
+				return nil, err
+			}
+			p.URL, p.Size, p.Mime, fileID = FileURLPrefix+file.ID, file.Size, file.Mime, file.ID
+			if p.Name == "" {
+				p.Name = name
+			}
+		}
+		if p.URL == "" || p.Name == "" || p.Mime == "" {
+			return nil, errors.New("file url, name and mime are required")
+		}
+		if p.FileID == "" && !isHTTPURL(p.URL) {
+			return nil, errors.New("file url must be http(s) when file_id is not given")
+		}
+		if p.Size <= 0 {
+			return nil, errors.New("invalid file size")
+		}
+		body, summary = p, "[文件] "+p.Name
+	case model.MsgTypeVoice:
+		var p VoicePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.FileID != "" {
+			if _, _, err := lookup(p.FileID); err != nil {
+				return nil, err
+			}
+			p.URL, fileID = FileURLPrefix+p.FileID, p.FileID
+		}
+		if p.URL == "" {
+			return nil, errors.New("voice url is required")
+		}
+		if p.FileID == "" && !isHTTPURL(p.URL) {
+			return nil, errors.New("voice url must be http(s) when file_id is not given")
+		}
+		if p.Duration <= 0 || p.Duration > maxVoiceDuration {
+			return nil, fmt.Errorf("voice duration must be between 1 and %d seconds", maxVoiceDuration)
+		}
+		body, summary = p, "[语音]"
+	case model.MsgTypeLocation:
+		var p LocationPayload
+		if err := decodePayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.Lat == nil || p.Lng == nil {
+			return nil, errors.New("location lat and lng are required")
+		}
+		if *p.Lat < -90 || *p.Lat > 90 || *p.Lng < -180 || *p.Lng > 180 {
+			return nil, errors.New("invalid location coordinates")
+		}
+		body, summary = p, strings.TrimSpace("[位置] "+p.Name)
+	case model.MsgTypeCard:
+		var p CardPayload
+		if err := decodePayload(payload, &p); err != nil {
+			return nil, err
+		}
+		if p.URL == "" || p.Title == "" {
+			return nil, errors.New("card url and title are required")
+		}
+		if !isHTTPURL(p.URL) || (p.Image != "" && !isHTTPURL(p.Image)) {
+			return nil, errors.New("card url and image must be http(s)")
+		}
+		body, summary = p, "[链接] "+p.Title
+	default:
+		return nil, errors.New("unsupported message type")
+	}
+
+	// 重新序列化，丢弃未定义的字段
+	normalized, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(content) == "" {
+		content = summary
+	}
+	return &messageBody{MsgType: msgType, Content: content, Payload: normalized, FileID: fileID}, nil
+}
+
+// decodePayload 解析结构化消息内容
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 || string(payload) == "null" {
+		return errors.New("payload is required")
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return errors.New("invalid payload")
+	}
+	return nil
+}
+
+// isHTTPURL 是否为带主机名的 http(s) 绝对地址（拒绝 javascript:、data: 等会被客户端直接渲染的地址）
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildMessageBodyRejectsUnsafeURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType string
+		payload string
+		wantErr bool
+	}{
+		{"card https", "card", `{"url":"https://example.com/a","title":"t","image":"http://example.com/i.png"}`, false},
+		{"card javascript", "card", `{"url":"javascript:alert(1)","title":"t"}`, true},
+		{"card scheme case", "card", `{"url":"JavaScript:alert(1)","title":"t"}`, true},
+		{"card data image", "card", `{"url":"https://example.com","title":"t","image":"data:image/png;base64,AAAA"}`, true},
+		{"card relative", "card", `{"url":"/path","title":"t"}`, true},
+		{"image external https", "image", `{"url":"https://cdn.example.com/a.jpg","width":1,"height":1}`, false},
+		{"image data url", "image", `{"url":"data:image/png;base64,AAAA"}`, true},
+		{"image javascript thumbnail", "image", `{"url":"https://cdn.example.com/a.jpg","thumbnail_url":"javascript:x"}`, true},
+		{"file ftp", "file", `{"url":"ftp://example.com/a.zip","name":"a.zip","mime":"application/zip","size":1}`, true},
+		{"file https", "file", `{"url":"https://example.com/a.zip","name":"a.zip","mime":"application/zip","size":1}`, false},
+		{"voice javascript", "voice", `{"url":"javascript:x","duration":3}`, true},
+		{"voice https", "voice", `{"url":"https://example.com/a.m4a","duration":3}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildMessageBody(tt.msgType, "", json.RawMessage(tt.payload), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMessageBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"im-system/internal/model"
+	"im-system/internal/repository"
+)
+
+// 搜索相关常量
+const (
+	searchMaxQueryLen   = 100 // 搜索词最大长度（字符）
+	searchMaxTerms      = 10  // 最多关键词数
+	searchMinTermLen    = 2   // 关键词最小长度，与 ngram 分词长度一致
+	searchSnippetRadius = 30  // 摘要中首个匹配前后保留的字符数
+)
+
+// SearchResult 消息搜索结果
+type SearchResult struct {
+	Message *model.Message `json:"message"`
+	Snippet string         `json:"snippet"` // 已做HTML转义，匹配的关键词以 <em></em> 标出
+}
+
+// SearchPage 消息搜索结果分页
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor *uint          `json:"next_cursor"` // 下一页的 before_id，没有更多结果时为 null
+}
+
+// SearchMessages 在当前用户发送或接收的消息中搜索
+// 关键词按空白分隔，需全部匹配；with 为空时搜索所有私聊与所在群组，否则只搜索与该用户的私聊
+func (s *MessageService) SearchMessages(userID uint, q, withStr string, from, to *time.Time, beforeID uint, limit int) (*SearchPage, error) {
+	if utf8.RuneCountInString(q) > searchMaxQueryLen {
+		return nil, errors.New("query too long")
+	}
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return nil, errors.New("query must contain a keyword of at least 2 characters")
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, errors.New("invalid date range")
+	}
+
+	query := &repository.MessageSearchQuery{
+		UserID:   userID,
+		Terms:    terms,
+		From:     from,
+		To:       to,
+		BeforeID: beforeID,
+		Limit:    limit + 1, // 多取一条用于判断是否还有下一页
+	}
+	if withStr != "" {
+		peerID, err := strconv.ParseUint(withStr, 10, 32)
+		if err != nil {
+			return nil, errors.New("invalid user ID")
+		}
+		query.PeerID = uint(peerID)
+	}
+
+	messages, err := s.searchIndex.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: make([]SearchResult, 0, len(messages))}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		next := messages[limit-1].ID
+		page.NextCursor = &next
+	}
+	for _, m := range messages {
+		page.Results = append(page.Results, SearchResult{Message: m, Snippet: highlight(m.Content, terms)})
+	}
+	return page, nil
+}
+
+// searchTerms 拆分关键词，忽略过短与重复的关键词
+func searchTerms(q string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.Fields(q) {
+		key := strings.ToLower(term)
+		if utf8.RuneCountInString(term) < searchMinTermLen || seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, term)
+		if len(terms) == searchMaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// highlight 截取首个匹配附近的内容作为摘要，匹配的关键词（不区分大小写）以 <em></em> 标出
+func highlight(content string, terms []string) string {
+	text := []rune(content)
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 标记所有匹配的位置
+	marked := make([]bool, len(text))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i, r := range t {
+			t[i] = unicode.ToLower(r)
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != string(t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, min(len(text), 2*searchSnippetRadius)
+	if first >= 0 {
+		start = max(0, first-searchSnippetRadius)
+		end = min(len(text), first+searchSnippetRadius)
+		// 匹配的关键词跨过截断位置时延长到关键词结尾
+		for end < len(text) && marked[end] {
+			end++
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(text[i:j]))
+		if marked[i] {
+			b.WriteString("<em>" + segment + "</em>")
+		} else {
+			b.WriteString(segment)
+		}
+		i = j
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		{name: "whitespace and duplicates", q: "  Hello\t世界 a HELLO hello\n", want: []string{"Hello", "世界"}},
+		{name: "single cjk characters", q: "你 好", want: nil},
+		{name: "cjk phrase", q: "今天天气", want: []string{"今天天气"}},
+		{name: "special characters", q: `"ab" c++ <x> 50%`, want: []string{`"ab"`, "c++", "<x>", "50%"}},
+		{name: "too many terms", q: "aa bb cc dd ee ff gg hh ii jj kk", want: []string{"aa", "bb", "cc", "dd", "ee", "ff", "gg", "hh", "ii", "jj"}},
+		{name: "empty", q: "   ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTerms(tt.q); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("searchTerms(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	x := func(n int) string { return strings.Repeat("x", n) }
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{
+			name:    "cjk",
+			content: "今天天气很好，我们去公园吧",
+			terms:   []string{"天气", "公园"},
+			want:    "今天<em>天气</em>很好，我们去<em>公园</em>吧",
+		},
+		{
+			name:    "mixed case",
+			content: "Hello WORLD hello",
+			terms:   []string{"hello"},
+			want:    "<em>Hello</em> WORLD <em>hello</em>",
+		},
+		{
+			name:    "non-ascii case folding",
+			content: "ÄBC äbc",
+			terms:   []string{"äB"},
+			want:    "<em>ÄB</em>C <em>äb</em>c",
+		},
+		{
+			name:    "html escaped",
+			content: `a<b> & "q"`,
+			terms:   []string{"<b>", `"q"`},
+			want:    `a<em>&lt;b&gt;</em> &amp; <em>&#34;q&#34;</em>`,
+		},
+		{
+			name:    "overlapping terms merge",
+			content: "abcd",
+			terms:   []string{"ab", "bc"},
+			want:    "<em>abc</em>d",
+		},
+		{
+			name:    "snippet around first match",
+			content: x(40) + "关键" + strings.Repeat("y", 40),
+			terms:   []string{"关键"},
+			want:    "…" + x(30) + "<em>关键</em>" + strings.Repeat("y", 28) + "…",
+		},
+		{
+			name:    "match across snippet end",
+			content: "ab" + x(27) + "keyword" + "zzz",
+			terms:   []string{"ab", "keyword"},
+			want:    "<em>ab</em>" + x(27) + "<em>keyword</em>…",
+		},
+		{
+			name:    "no match",
+			content: x(70),
+			terms:   []string{"yy"},
+			want:    x(60) + "…",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.content, tt.terms); got != tt.want {
+				t.Fatalf("highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
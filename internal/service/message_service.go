@@ -3,8 +3,10 @@ package service
 import (
 	"errors"
 	"strconv"
+	"time"
 
 	"encoding/json"
+	"im-system/config"
 	"im-system/internal/model"
 	"im-system/internal/repository"
 	"im-system/pkg/redis"
@@ -13,20 +15,45 @@ import (
 
 // MessageService 消息服务
 type MessageService struct {
-	messageRepo *repository.MessageRepository
-	userRepo    *repository.UserRepository
+	messageRepo      *repository.MessageRepository
+	userRepo         *repository.UserRepository
+	groupRepo        *repository.GroupRepository
+	friendshipRepo   *repository.FriendshipRepository
+	fileRepo         *repository.FileRepository
+	conversationRepo *repository.ConversationRepository
+	searchIndex      repository.SearchIndex
+	cfg              config.MessageConfig
 }
 
 // NewMessageService 创建MessageService实例
-func NewMessageService(messageRepo *repository.MessageRepository, userRepo *repository.UserRepository) *MessageService {
+func NewMessageService(messageRepo *repository.MessageRepository, userRepo *repository.UserRepository, groupRepo *repository.GroupRepository, friendshipRepo *repository.FriendshipRepository, fileRepo *repository.FileRepository, conversationRepo *repository.ConversationRepository, searchIndex repository.SearchIndex, cfg config.MessageConfig) *MessageService {
 	return &MessageService{
-		messageRepo: messageRepo,
-		userRepo:    userRepo,
+		messageRepo:      messageRepo,
+		userRepo:         userRepo,
+		groupRepo:        groupRepo,
+		friendshipRepo:   friendshipRepo,
+		fileRepo:         fileRepo,
+		conversationRepo: conversationRepo,
+		searchIndex:      searchIndex,
+		cfg:              cfg,
 	}
 }
 
 // SendMessage 发送私聊消息
-func (s *MessageService) SendMessage(senderID uint, receiverIDStr, content string) (*model.Message, error) {
+// msgType 为空时按文本消息处理，非文本消息的 payload 按类型校验
+func (s *MessageService) SendMessage(senderID uint, receiverIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error) {
+	return s.SendMessageFromConn(senderID, "", receiverIDStr, msgType, content, payload)
+}
+
+// SendMessageFromConn 从指定WebSocket连接发送私聊消息，消息会同步到发送者的其他设备
+// connID 为空表示通过HTTP发送，同步到发送者的所有设备
+func (s *MessageService) SendMessageFromConn(senderID uint, connID, receiverIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error) {
+	// 校验消息类型与内容
+	body, err := buildMessageBody(msgType, content, payload, s.uploadLookup(senderID))
+	if err != nil {
+		return nil, err
+	}
+
 	// 验证接收者ID
 	receiverID, err := strconv.ParseUint(receiverIDStr, 10, 32)
 	if err != nil {
@@ -44,12 +71,23 @@ func (s *MessageService) SendMessage(senderID uint, receiverIDStr, content strin
 		return nil, errors.New("cannot send message to yourself")
 	}
 
+	// 任一方拉黑对方时拒绝发送
+	blocked, err := s.friendshipRepo.IsBlocked(senderID, uint(receiverID))
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
 	// 创建消息
 	message := &model.Message{
 		SenderID:    senderID,
 		ReceiverID:  uint(receiverID),
-		Content:     content,
-		MsgType:     "text", // 默认文本消息
+		Content:     body.Content,
+		MsgType:     body.MsgType,
+		Payload:     body.Payload,
+		FileID:      body.FileID,
 		IsRead:      false,
 		SessionType: 1,      // 单聊
 		Status:      "sent", // 已发送
@@ -59,39 +97,214 @@ func (s *MessageService) SendMessage(senderID uint, receiverIDStr, content strin
 	if err := s.messageRepo.Create(message); err != nil {
 		return nil, err
 	}
+	_ = s.searchIndex.Index(message)
 
 	// 添加到缓存
 	_ = redis.AddMessageToCache(senderID, uint(receiverID), message)
 
-	// 增加接收者未读消息计数
-	_ = redis.IncrementUnreadCount(uint(receiverID))
+	// 增加接收者与发送者会话的未读消息计数
+	_ = redis.IncrementUnreadCount(uint(receiverID), redis.PrivateUnreadField(senderID))
 
-	// 更新对话缓存
-	receiver, _ := s.userRepo.GetByID(uint(receiverID))
-	if receiver != nil {
-		// 获取Redis中的未读消息数
-		unreadCount, _ := redis.GetUnreadCount(uint(receiverID))
-		_ = redis.UpdateConversationCache(senderID, uint(receiverID), receiver.Username, content, unreadCount)
-		_ = redis.UpdateConversationCache(uint(receiverID), senderID, "", content, 0) // 发送者不需要未读数
-	}
+	// 更新会话的最后一条消息，并清除双方的对话列表缓存
+	_ = s.conversationRepo.TouchPrivate(message)
+	_ = redis.ClearConversationCache(senderID)
+	_ = redis.ClearConversationCache(uint(receiverID))
 
 	// WebSocket推送
 	msgData := map[string]interface{}{
 		"type":      "chat",
 		"from":      senderID,
 		"to":        uint(receiverID),
-		"content":   content,
+		"content":   body.Content,
+		"msg_type":  body.MsgType,
 		"msg_id":    message.ID,
+		"seq":       message.Seq,
 		"timestamp": message.CreatedAt.Unix(),
 	}
+	if body.Payload != nil {
+		msgData["payload"] = body.Payload
+	}
 	msgBytes, _ := json.Marshal(msgData)
 	websocket.GetManager().SendToUser(uint(receiverID), msgBytes)
+	websocket.GetManager().SendToUserExcept(senderID, connID, msgBytes)
+
+	return message, nil
+}
+
+// SendGroupMessage 发送群聊消息
+func (s *MessageService) SendGroupMessage(senderID uint, groupIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error) {
+	return s.SendGroupMessageFromConn(senderID, "", groupIDStr, msgType, content, payload)
+}
+
+// SendGroupMessageFromConn 从指定WebSocket连接发送群聊消息
+// 消息只落库一行，再扇出给所有群成员：在线成员直接推送，离线成员写入离线队列
+// 发送者自己的其他设备同样会收到同步
+func (s *MessageService) SendGroupMessageFromConn(senderID uint, connID, groupIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error) {
+	// 校验消息类型与内容
+	body, err := buildMessageBody(msgType, content, payload, s.uploadLookup(senderID))
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证群ID
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid group ID")
+	}
+
+	// 检查群组是否存在
+	if _, err := s.groupRepo.GetByID(uint(groupID)); err != nil {
+		return nil, err
+	}
+
+	// 只有群成员才能发言
+	if _, err := s.groupRepo.GetMember(uint(groupID), senderID); err != nil {
+		return nil, errors.New("not a group member")
+	}
+
+	gid := uint(groupID)
+	message := &model.Message{
+		SenderID:    senderID,
+		GroupID:     &gid,
+		Content:     body.Content,
+		MsgType:     body.MsgType,
+		Payload:     body.Payload,
+		FileID:      body.FileID,
+		IsRead:      false,
+		SessionType: 2,      // 群聊
+		Status:      "sent", // 已发送
+	}
+
+	// 保存消息
+	if err := s.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+	_ = s.searchIndex.Index(message)
+
+	// 获取群成员并扇出
+	memberIDs, err := s.groupRepo.GetMemberIDs(gid)
+	if err != nil {
+		return message, nil // 消息已落库，扇出失败不影响发送结果
+	}
+
+	msgData := map[string]interface{}{
+		"type":      "group_chat",
+		"from":      senderID,
+		"group_id":  gid,
+		"content":   body.Content,
+		"msg_type":  body.MsgType,
+		"msg_id":    message.ID,
+		"seq":       message.Seq,
+		"timestamp": message.CreatedAt.Unix(),
+	}
+	if body.Payload != nil {
+		msgData["payload"] = body.Payload
+	}
+	msgBytes, _ := json.Marshal(msgData)
+
+	// 与发送者存在拉黑关系的成员不推送
+	hidden, _ := s.friendshipRepo.GetBlockRelatedIDs(senderID)
+
+	manager := websocket.GetManager()
+	for _, memberID := range memberIDs {
+		if memberID == senderID || hidden[memberID] {
+			continue
+		}
+		manager.SendToUser(memberID, msgBytes)
+	}
+	manager.SendToUserExcept(senderID, connID, msgBytes)
 
 	return message, nil
 }
 
-// GetPrivateMessages 获取私聊消息历史
-func (s *MessageService) GetPrivateMessages(userID uint, otherUserIDStr string, page, pageSize int) ([]*model.Message, error) {
+// GetGroupMessages 获取群聊消息历史（仅群成员可查看，只包含入群之后的消息，与消息搜索一致）
+func (s *MessageService) GetGroupMessages(userID uint, groupIDStr string, page, pageSize int) ([]*model.Message, error) {
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid group ID")
+	}
+
+	member, err := s.groupRepo.GetMember(uint(groupID), userID)
+	if err != nil {
+		return nil, errors.New("permission denied")
+	}
+
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.messageRepo.GetGroupMessages(uint(groupID), member.CreatedAt, pageSize, offset)
+}
+
+// SyncPrivateMessages 获取私聊会话中序号大于 afterSeq 的消息，用于断线重连后补齐缺失消息
+// 多取一条用于判断是否还有更多
+func (s *MessageService) SyncPrivateMessages(userID uint, otherUserIDStr string, afterSeq uint64, limit int) ([]*model.Message, bool, error) {
+	otherUserID, err := strconv.ParseUint(otherUserIDStr, 10, 32)
+	if err != nil {
+		return nil, false, errors.New("invalid user ID")
+	}
+	if _, err := s.userRepo.GetByID(uint(otherUserID)); err != nil {
+		return nil, false, errors.New("user not found")
+	}
+
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	messages, err := s.messageRepo.GetPrivateMessagesAfterSeq(userID, uint(otherUserID), afterSeq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+// SyncGroupMessages 获取群聊会话中序号大于 afterSeq 的消息（仅群成员可查看，只包含入群之后的消息）
+func (s *MessageService) SyncGroupMessages(userID uint, groupIDStr string, afterSeq uint64, limit int) ([]*model.Message, bool, error) {
+	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+	if err != nil {
+		return nil, false, errors.New("invalid group ID")
+	}
+	member, err := s.groupRepo.GetMember(uint(groupID), userID)
+	if err != nil {
+		return nil, false, errors.New("permission denied")
+	}
+
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	messages, err := s.messageRepo.GetGroupMessagesAfterSeq(uint(groupID), member.CreatedAt, afterSeq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+// MessagePage 消息游标分页结果（消息按ID降序）
+// NextCursor: 继续加载更早的消息时作为 before_id，没有更早的消息时为nil
+// PrevCursor: 加载更新的消息时作为 after_id（本页最新一条消息的ID）
+type MessagePage struct {
+	Messages   []*model.Message `json:"messages"`
+	NextCursor *uint            `json:"next_cursor"`
+	PrevCursor *uint            `json:"prev_cursor"`
+}
+
+// GetPrivateMessages 获取私聊消息历史（游标分页）
+// beforeID > 0 时加载该消息之前的更早消息，afterID > 0 时加载该消息之后的更新消息，都为0时加载最新一页
+// 缓存覆盖所请求的窗口时直接从缓存返回
+func (s *MessageService) GetPrivateMessages(userID uint, otherUserIDStr string, beforeID, afterID uint, limit int) (*MessagePage, error) {
 	// 验证对方用户ID
 	otherUserID, err := strconv.ParseUint(otherUserIDStr, 10, 32)
 	if err != nil {
@@ -104,50 +317,137 @@ func (s *MessageService) GetPrivateMessages(userID uint, otherUserIDStr string,
 		return nil, errors.New("user not found")
 	}
 
-	// 计算分页参数
-	offset := (page - 1) * pageSize
-	if offset < 0 {
-		offset = 0
+	if beforeID > 0 && afterID > 0 {
+		return nil, errors.New("before_id and after_id cannot be used together")
 	}
-	if pageSize <= 0 || pageSize > 100 {
-		pageSize = 20 // 默认每页20条
+	if limit <= 0 || limit > 100 {
+		limit = 20 // 默认每页20条
 	}
 
-	var messages []*model.Message
+	// 优先从缓存截取，缓存未覆盖时从数据库获取
+	messages, hasOlder, ok := s.cachedPrivateWindow(userID, uint(otherUserID), beforeID, afterID, limit)
+	if !ok {
+		messages, hasOlder, err = s.loadPrivateWindow(userID, uint(otherUserID), beforeID, afterID, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// 如果是第一页且请求数量在缓存范围内，尝试从缓存获取
-	if page == 1 && pageSize <= redis.MaxCachedMessages {
-		cachedMessages, cacheErr := redis.GetCachedPrivateMessages(userID, uint(otherUserID))
-		if cacheErr == nil && len(cachedMessages) > 0 {
-			// 缓存命中，直接返回缓存数据
-			if len(cachedMessages) >= pageSize {
-				messages = cachedMessages[:pageSize]
-			} else {
-				messages = cachedMessages
-			}
-		} else {
-			// 缓存未命中，从数据库获取并缓存
-			messages, err = s.messageRepo.GetPrivateMessages(userID, uint(otherUserID), pageSize, offset)
-			if err != nil {
-				return nil, err
-			}
-			// 异步缓存消息
-			go func() {
-				_ = redis.CachePrivateMessages(userID, uint(otherUserID), messages)
-			}()
+	// 标记消息为已读，并向对方推送一条批量已读回执
+	go s.MarkConversationAsRead(userID, uint(otherUserID), 0, 0)
+
+	page := &MessagePage{Messages: messages}
+	if len(messages) > 0 {
+		newest := messages[0].ID
+		page.PrevCursor = &newest
+		if hasOlder {
+			oldest := messages[len(messages)-1].ID
+			page.NextCursor = &oldest
 		}
-	} else {
-		// 超出缓存范围或非第一页，直接从数据库获取
-		messages, err = s.messageRepo.GetPrivateMessages(userID, uint(otherUserID), pageSize, offset)
+	} else if afterID > 0 {
+		// 暂无更新的消息，客户端下次仍从同一位置继续
+		page.PrevCursor = &afterID
+	}
+	return page, nil
+}
+
+// cachedPrivateWindow 尝试从缓存中截取游标窗口，返回消息（按ID降序）、是否还有更早的消息，以及缓存是否覆盖该窗口
+// 缓存保存的是会话最新的一段连续消息（按ID降序），条数不足 MaxCachedMessages 时即为完整会话
+func (s *MessageService) cachedPrivateWindow(userID, otherUserID, beforeID, afterID uint, limit int) ([]*model.Message, bool, bool) {
+	cached, err := redis.GetCachedPrivateMessages(userID, otherUserID)
+	if err != nil || len(cached) == 0 || !cacheUpToDate(cached) {
+		return nil, false, false
+	}
+	complete := len(cached) < redis.MaxCachedMessages
+
+	if afterID > 0 {
+		// afterID 早于缓存中最早的消息时，两者之间可能还有未缓存的消息
+		if !complete && afterID < cached[len(cached)-1].ID {
+			return nil, false, false
+		}
+		end := 0
+		for end < len(cached) && cached[end].ID > afterID {
+			end++
+		}
+		// 取紧接 afterID 之后的 limit 条
+		start := end - limit
+		if start < 0 {
+			start = 0
+		}
+		return cached[start:end], true, true
+	}
+
+	start := 0
+	for beforeID > 0 && start < len(cached) && cached[start].ID >= beforeID {
+		start++
+	}
+	window := cached[start:]
+	if len(window) > limit {
+		return window[:limit], true, true
+	}
+	if complete {
+		return window, false, true
+	}
+	return nil, false, false
+}
+
+// cacheUpToDate 检查缓存的消息序号：须随ID严格递减，且最新一条即会话当前已分配的最大序号
+// （否则有消息尚未或未能写入缓存）。中间的序号空缺来自已删除的消息，由数据库整段回填时保留；
+// 回填之后追加的消息由 AddMessageToCache 保证连续
+func cacheUpToDate(cached []*model.Message) bool {
+	latest, err := redis.CurrentSeq(redis.SeqKey(cached[0].ConversationKey()))
+	if err != nil || cached[0].Seq != latest {
+		return false
+	}
+	for i := 1; i < len(cached); i++ {
+		if cached[i].Seq >= cached[i-1].Seq {
+			return false
+		}
+	}
+	return true
+}
+
+// loadPrivateWindow 从数据库获取游标窗口，返回消息（按ID降序）及是否还有更早的消息
+// 加载最新一页时顺带回填缓存
+func (s *MessageService) loadPrivateWindow(userID, otherUserID, beforeID, afterID uint, limit int) ([]*model.Message, bool, error) {
+	if afterID > 0 {
+		messages, err := s.messageRepo.GetPrivateMessagesAfter(userID, otherUserID, afterID, limit)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
+		// 统一为按ID降序返回
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+		return messages, true, nil
 	}
 
-	// 标记消息为已读
-	go s.messageRepo.MarkConversationAsRead(userID, uint(otherUserID))
+	// 多取一条用于判断是否还有更早的消息；最新一页按缓存容量获取，便于整段写入缓存
+	fetch := limit + 1
+	if beforeID == 0 && fetch < redis.MaxCachedMessages {
+		fetch = redis.MaxCachedMessages
+	}
+	messages, err := s.messageRepo.GetPrivateMessagesBefore(userID, otherUserID, beforeID, fetch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if beforeID == 0 {
+		toCache := messages
+		if len(toCache) > redis.MaxCachedMessages {
+			toCache = toCache[:redis.MaxCachedMessages]
+		}
+		// 异步缓存消息
+		go func() {
+			_ = redis.CachePrivateMessages(userID, otherUserID, toCache)
+		}()
+	}
 
-	return messages, nil
+	hasOlder := len(messages) > limit
+	if hasOlder {
+		messages = messages[:limit]
+	}
+	return messages, hasOlder, nil
 }
 
 // GetUnreadMessages 获取未读消息
@@ -168,8 +468,8 @@ func (s *MessageService) MarkAsRead(messageIDStr string, userID uint) error {
 		return errors.New("message not found")
 	}
 
-	// 只能标记发给自己的消息为已读
-	if message.ReceiverID != userID {
+	// 只能标记发给自己的私聊消息为已读
+	if message.GroupID != nil || message.ReceiverID != userID {
 		return errors.New("permission denied")
 	}
 
@@ -184,30 +484,69 @@ func (s *MessageService) MarkAsRead(messageIDStr string, userID uint) error {
 		return err
 	}
 
-	// 减少Redis中的未读消息计数
-	_ = redis.DecrementUnreadCount(userID)
+	// 减少Redis中该会话的未读消息计数
+	_ = redis.DecrementUnreadCount(userID, redis.PrivateUnreadField(message.SenderID))
+	_ = redis.UpdateCachedMessage(message.SenderID, userID, readMessage(message))
+
+	// 推进会话的已读位置
+	_ = s.conversationRepo.UpdatePrivateLastRead(userID, message.SenderID, message.ID, message.Seq)
+	_ = redis.ClearConversationCache(userID)
 
+	// 已撤回的消息不再通知发送者
+	if message.Status != "recalled" {
+		s.pushReadReceipt(userID, message.SenderID, map[string]interface{}{
+			"msg_ids": []uint{message.ID},
+			"seq":     message.Seq,
+		})
+	}
 	return nil
 }
 
-// GetUnreadCount 获取未读消息数量（优先从Redis获取）
-func (s *MessageService) GetUnreadCount(userID uint) (int64, error) {
-	// 优先从Redis获取
-	count, err := redis.GetUnreadCount(userID)
-	if err == nil {
-		return count, nil
+// readMessage 返回标记为已读后的消息副本，用于更新缓存（与数据库的已读更新一致，已撤回的消息状态不变）
+func readMessage(message *model.Message) *model.Message {
+	read := *message
+	read.IsRead = true
+	if read.Status != "recalled" {
+		read.Status = "read"
 	}
+	return &read
+}
 
-	// Redis获取失败，从数据库获取并同步到Redis
-	dbCount, err := s.messageRepo.GetUnreadCount(userID)
+// GetUnreadCount 获取未读消息数量（各会话未读数之和）
+func (s *MessageService) GetUnreadCount(userID uint) (int64, error) {
+	counts, err := s.getUnreadCounts(userID)
 	if err != nil {
 		return 0, err
 	}
 
-	// 同步到Redis
-	_ = redis.SetUnreadCount(userID, dbCount)
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
 
-	return dbCount, nil
+// getUnreadCounts 获取用户各会话的未读数（优先从Redis获取，未初始化或Redis不可用时从数据库重建）
+func (s *MessageService) getUnreadCounts(userID uint) (map[string]int64, error) {
+	if counts, ok, err := redis.GetUnreadCounts(userID); err == nil && ok {
+		return counts, nil
+	}
+	return s.RebuildUnreadCounts(userID)
+}
+
+// RebuildUnreadCounts 从数据库统计用户各会话的未读数并写入Redis
+func (s *MessageService) RebuildUnreadCounts(userID uint) (map[string]int64, error) {
+	bySender, err := s.messageRepo.GetUnreadCountsBySender(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(bySender))
+	for senderID, count := range bySender {
+		counts[redis.PrivateUnreadField(senderID)] = count
+	}
+	_ = redis.SetUnreadCounts(userID, counts)
+	return counts, nil
 }
 
 // DeleteMessage 删除消息
@@ -228,139 +567,321 @@ func (s *MessageService) DeleteMessage(messageIDStr string, userID uint) error {
 		return errors.New("permission denied")
 	}
 
-	return s.messageRepo.DeleteMessage(uint(messageID), userID)
+	if err := s.messageRepo.DeleteMessage(uint(messageID), userID); err != nil {
+		return err
+	}
+	_ = s.searchIndex.Remove(message.ID)
+
+	// 清除私聊消息缓存，避免从缓存中返回已删除的消息
+	if message.GroupID == nil {
+		_ = redis.ClearMessageCache(message.SenderID, message.ReceiverID)
+	}
+	return nil
 }
 
-// GetRecentConversations 获取最近对话
-func (s *MessageService) GetRecentConversations(userID uint, limit int) ([]*model.Message, error) {
-	if limit <= 0 || limit > 50 {
-		limit = 20 // 默认20条
+// RecallMessage 撤回消息（仅发送者，且在撤回时间窗口内）
+// 消息内容替换为占位记录，同时清理缓存与离线队列，并向会话各方推送 recall 事件
+func (s *MessageService) RecallMessage(messageIDStr string, userID uint) (*model.Message, error) {
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid message ID")
 	}
 
-	return s.messageRepo.GetRecentConversations(userID, limit)
-}
+	message, err := s.messageRepo.GetByID(uint(messageID))
+	if err != nil {
+		return nil, errors.New("message not found")
+	}
 
-// GetConversationList 获取对话列表（带缓存）
-func (s *MessageService) GetConversationList(userID uint, limit int) ([]redis.CachedConversation, error) {
-	if limit <= 0 || limit > redis.MaxCachedConversations {
-		limit = redis.MaxCachedConversations
+	// 只能撤回自己发送的消息
+	if message.SenderID != userID {
+		return nil, errors.New("permission denied")
+	}
+	if message.Status == "recalled" {
+		return nil, errors.New("message already recalled")
+	}
+	if time.Since(message.CreatedAt) > s.cfg.RecallWindow {
+		return nil, errors.New("recall window has expired")
 	}
 
-	// 尝试从缓存获取
-	cachedConversations, err := redis.GetCachedConversations(userID)
-	if err == nil && len(cachedConversations) > 0 {
-		// 缓存命中，返回缓存数据
-		if len(cachedConversations) > limit {
-			return cachedConversations[:limit], nil
+	if err := s.messageRepo.Recall(message.ID); err != nil {
+		return nil, err
+	}
+	_ = s.searchIndex.Remove(message.ID)
+	recalledAt := time.Now()
+	message.Content = ""
+	message.Payload = nil
+	message.Status = "recalled"
+	message.RecalledAt = &recalledAt
+
+	if message.GroupID == nil {
+		// 清除缓存中的原消息内容
+		_ = redis.ClearMessageCache(message.SenderID, message.ReceiverID)
+		_ = redis.ClearConversationCache(message.SenderID)
+		_ = redis.ClearConversationCache(message.ReceiverID)
+
+		// 未读的消息撤回后不再计入未读数
+		if !message.IsRead {
+			if err := s.messageRepo.MarkAsRead(message.ID); err == nil {
+				_ = redis.DecrementUnreadCount(message.ReceiverID, redis.PrivateUnreadField(message.SenderID))
+			}
 		}
-		return cachedConversations, nil
 	}
 
-	// 缓存未命中，从数据库获取并构建对话列表
-	messages, err := s.messageRepo.GetRecentConversations(userID, limit*2) // 获取更多消息用于构建对话
+	// recall 事件以 target_msg_id 指向原消息，不带 msg_id，不需要投递确认（对它的确认不等于原消息已投递）
+	eventData := map[string]interface{}{
+		"type":          "recall",
+		"from":          userID,
+		"target_msg_id": message.ID,
+		"seq":           message.Seq,
+		"recalled_at":   recalledAt.Unix(),
+	}
+	if message.GroupID != nil {
+		eventData["group_id"] = *message.GroupID
+	} else {
+		eventData["to"] = message.ReceiverID
+	}
+	eventBytes, _ := json.Marshal(eventData)
+
+	// 原消息仍在接收方连接的未确认窗口中时替换为撤回后的占位内容，不再重传原内容
+	patch := &websocket.MessagePatch{
+		MsgID:  message.ID,
+		Status: "recalled",
+		Fields: map[string]interface{}{"recalled_at": recalledAt.Unix()},
+	}
+	manager := websocket.GetManager()
+	for _, receiverID := range s.messagePeers(message) {
+		// 尚未投递的离线消息直接移除
+		_ = redis.RemoveOfflineMessage(receiverID, message.ID)
+		manager.SendPatchToUser(receiverID, patch, eventBytes)
+	}
+	manager.SendToUserExcept(userID, "", eventBytes)
+
+	return message, nil
+}
+
+// EditMessage 编辑消息（仅发送者，且在编辑时间窗口内）
+// 编辑前的内容保存为修订记录，同步更新缓存与离线队列，并向会话各方推送 edit 事件
+func (s *MessageService) EditMessage(messageIDStr string, userID uint, content string) (*model.Message, error) {
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid message ID")
+	}
+
+	message, err := s.messageRepo.GetByID(uint(messageID))
 	if err != nil {
+		return nil, errors.New("message not found")
+	}
+
+	// 只能编辑自己发送的消息
+	if message.SenderID != userID {
+		return nil, errors.New("permission denied")
+	}
+	if message.Status == "recalled" {
+		return nil, errors.New("message has been recalled")
+	}
+	if message.MsgType != model.MsgTypeText {
+		return nil, errors.New("only text messages can be edited")
+	}
+	if time.Since(message.CreatedAt) > s.cfg.EditWindow {
+		return nil, errors.New("edit window has expired")
+	}
+	if content == message.Content {
+		return message, nil // 内容未变化，无需编辑
+	}
+
+	editedAt := time.Now()
+	if err := s.messageRepo.Edit(message, content, editedAt); err != nil {
 		return nil, err
 	}
+	message.Content = content
+	message.EditedAt = &editedAt
+	_ = s.searchIndex.Index(message)
 
-	// 构建对话列表
-	conversationMap := make(map[uint]*redis.CachedConversation)
-	for _, msg := range messages {
-		var otherUserID uint
-		if msg.SenderID == userID {
-			otherUserID = msg.ReceiverID
-		} else {
-			otherUserID = msg.SenderID
+	if message.GroupID == nil {
+		// 更新缓存中的消息内容
+		_ = redis.UpdateCachedMessage(message.SenderID, message.ReceiverID, message)
+		_ = redis.ClearConversationCache(message.SenderID)
+		_ = redis.ClearConversationCache(message.ReceiverID)
+	}
+
+	// edit 事件以 target_msg_id 指向原消息，不带 msg_id，不需要投递确认（对它的确认不等于原消息已投递）
+	eventData := map[string]interface{}{
+		"type":          "edit",
+		"from":          userID,
+		"target_msg_id": message.ID,
+		"seq":           message.Seq,
+		"content":       content,
+		"edited_at":     editedAt.Unix(),
+	}
+	if message.GroupID != nil {
+		eventData["group_id"] = *message.GroupID
+	} else {
+		eventData["to"] = message.ReceiverID
+	}
+	eventBytes, _ := json.Marshal(eventData)
+
+	// 原消息仍在接收方连接的未确认窗口中时原地更新为编辑后的内容，重传或放回离线队列时使用新内容
+	patch := &websocket.MessagePatch{
+		MsgID:   message.ID,
+		Content: content,
+		Fields:  map[string]interface{}{"edited_at": editedAt.Unix()},
+	}
+	manager := websocket.GetManager()
+	for _, receiverID := range s.messagePeers(message) {
+		// 尚未投递的离线消息直接更新为新内容
+		_ = redis.UpdateOfflineMessageContent(receiverID, message.ID, content)
+		manager.SendPatchToUser(receiverID, patch, eventBytes)
+	}
+	manager.SendToUserExcept(userID, "", eventBytes)
+
+	return message, nil
+}
+
+// GetMessageRevisions 获取消息的编辑历史（仅会话参与者可查看）
+func (s *MessageService) GetMessageRevisions(messageIDStr string, userID uint) ([]*model.MessageRevision, error) {
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid message ID")
+	}
+
+	message, err := s.messageRepo.GetByID(uint(messageID))
+	if err != nil {
+		return nil, errors.New("message not found")
+	}
+
+	if message.GroupID != nil {
+		if _, err := s.groupRepo.GetMember(*message.GroupID, userID); err != nil {
+			return nil, errors.New("permission denied")
 		}
+	} else if message.SenderID != userID && message.ReceiverID != userID {
+		return nil, errors.New("permission denied")
+	}
 
-		if conv, exists := conversationMap[otherUserID]; exists {
-			// 更新现有对话
-			if msg.CreatedAt.After(conv.LastTime) {
-				conv.LastMessage = msg.Content
-				conv.LastTime = msg.CreatedAt
-			}
-		} else {
-			// 创建新对话
-			otherUser, _ := s.userRepo.GetByID(otherUserID)
-			username := ""
-			if otherUser != nil {
-				username = otherUser.Username
-			}
+	return s.messageRepo.GetRevisions(message.ID)
+}
 
-			conversationMap[otherUserID] = &redis.CachedConversation{
-				UserID:      otherUserID,
-				Username:    username,
-				LastMessage: msg.Content,
-				LastTime:    msg.CreatedAt,
-				UnreadCount: 0, // 稍后统一设置
-			}
+// uploadLookup 返回按发送者查找已上传附件的函数，消息只能引用发送者自己上传过的附件
+func (s *MessageService) uploadLookup(senderID uint) fileLookup {
+	return func(fileID string) (*model.File, string, error) {
+		if !fileIDPattern.MatchString(fileID) {
+			return nil, "", ErrFileNotFound
+		}
+		upload, err := s.fileRepo.GetUpload(fileID, senderID)
+		if err != nil {
+			return nil, "", ErrFileNotFound
 		}
+		file, err := s.fileRepo.GetByID(fileID)
+		if err != nil {
+			return nil, "", ErrFileNotFound
+		}
+		return file, upload.Name, nil
 	}
+}
 
-	// 转换为切片并按时间排序
-	var conversations []redis.CachedConversation
-	for _, conv := range conversationMap {
-		conversations = append(conversations, *conv)
+// CanSignal 判断是否允许向对方发送正在输入等临时信号
+// 双方不存在拉黑关系，且已是好友或有过私聊消息
+func (s *MessageService) CanSignal(fromID, toID uint) bool {
+	if fromID == toID {
+		return false
+	}
+	if blocked, err := s.friendshipRepo.IsBlocked(fromID, toID); err != nil || blocked {
+		return false
 	}
+	if friendship, err := s.friendshipRepo.GetFriendship(fromID, toID); err == nil && friendship != nil && friendship.Status == model.FriendshipAccepted {
+		return true
+	}
+	ok, err := s.messageRepo.HasPrivateConversation(fromID, toID)
+	return err == nil && ok
+}
 
-	// 按最后消息时间排序
-	for i := 0; i < len(conversations)-1; i++ {
-		for j := i + 1; j < len(conversations); j++ {
-			if conversations[i].LastTime.Before(conversations[j].LastTime) {
-				conversations[i], conversations[j] = conversations[j], conversations[i]
-			}
+// messagePeers 获取消息发送者以外需要同步消息变更的用户：私聊为接收者，群聊为其他群成员
+func (s *MessageService) messagePeers(message *model.Message) []uint {
+	if message.GroupID == nil {
+		return []uint{message.ReceiverID}
+	}
+
+	memberIDs, err := s.groupRepo.GetMemberIDs(*message.GroupID)
+	if err != nil {
+		return nil
+	}
+	peers := make([]uint, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if memberID != message.SenderID {
+			peers = append(peers, memberID)
 		}
 	}
+	return peers
+}
 
-	// 限制数量
-	if len(conversations) > limit {
-		conversations = conversations[:limit]
+// GetRecentConversations 获取最近对话
+func (s *MessageService) GetRecentConversations(userID uint, limit int) ([]*model.Message, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20 // 默认20条
 	}
 
-	// 统一设置未读计数（从Redis获取）
-	for i := range conversations {
-		unreadCount, _ := redis.GetUnreadCount(userID)
-		conversations[i].UnreadCount = unreadCount
+	messages, err := s.messageRepo.GetRecentConversations(userID, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	// 异步缓存对话列表
-	go func() {
-		_ = redis.CacheConversations(userID, conversations)
-	}()
+	// 隐藏与拉黑用户的对话
+	hidden, err := s.friendshipRepo.GetBlockRelatedIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*model.Message, 0, len(messages))
+	for _, msg := range messages {
+		if hidden[msg.SenderID] || hidden[msg.ReceiverID] {
+			continue
+		}
+		filtered = append(filtered, msg)
+	}
 
-	return conversations, nil
+	return filtered, nil
 }
 
 // MarkConversationAsRead 标记整个对话为已读（批量操作）
-func (s *MessageService) MarkConversationAsRead(userID, otherUserID uint) error {
+// upToID / upToSeq 大于0时只标记到该消息ID / 序号为止；标记后向对方推送一条 "已读到此处" 的回执，而不是逐条推送
+func (s *MessageService) MarkConversationAsRead(userID, otherUserID, upToID uint, upToSeq uint64) (*repository.ReadRange, error) {
 	// 标记数据库中的消息为已读
-	err := s.messageRepo.MarkConversationAsRead(userID, otherUserID)
-	if err != nil {
-		return err
+	rng, err := s.messageRepo.MarkConversationAsRead(userID, otherUserID, upToID, upToSeq)
+	if err != nil || rng == nil {
+		return rng, err
 	}
 
-	// 获取该对话的未读消息数量
-	unreadCount, err := s.messageRepo.GetUnreadCount(userID)
+	// 只标记到指定位置时该会话可能仍有未读，以数据库中的剩余数量更新Redis中该会话的未读计数
+	unreadCount, err := s.messageRepo.GetConversationUnreadCount(userID, otherUserID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	_ = redis.SetConversationUnreadCount(userID, redis.PrivateUnreadField(otherUserID), unreadCount)
+	_ = redis.MarkCachedMessagesRead(otherUserID, userID, userID, rng.MaxID)
 
-	// 更新Redis中的未读计数
-	_ = redis.SetUnreadCount(userID, unreadCount)
+	// 推进会话的已读位置
+	_ = s.conversationRepo.UpdatePrivateLastRead(userID, otherUserID, rng.MaxID, rng.MaxSeq)
+	_ = redis.ClearConversationCache(userID)
 
-	return nil
+	s.pushReadReceipt(userID, otherUserID, map[string]interface{}{
+		"up_to_msg_id": rng.MaxID,
+		"up_to_seq":    rng.MaxSeq,
+		"count":        rng.Count,
+	})
+	return rng, nil
 }
 
-// MarkAllAsRead 标记所有消息为已读
+// MarkAllAsRead 标记所有消息为已读，每个对话向对方推送一条批量已读回执
 func (s *MessageService) MarkAllAsRead(userID uint) error {
-	// 获取当前未读消息
-	unreadMessages, err := s.messageRepo.GetUnreadMessages(userID)
+	// 获取有未读消息的对话
+	senderIDs, err := s.messageRepo.GetUnreadSenderIDs(userID)
 	if err != nil {
 		return err
 	}
 
-	// 批量标记为已读
-	for _, msg := range unreadMessages {
-		_ = s.messageRepo.MarkAsRead(msg.ID)
+	// 按对话批量标记为已读
+	for _, senderID := range senderIDs {
+		if _, err := s.MarkConversationAsRead(userID, senderID, 0, 0); err != nil {
+			return err
+		}
 	}
 
 	// 重置Redis未读计数
@@ -368,3 +889,22 @@ func (s *MessageService) MarkAllAsRead(userID uint) error {
 
 	return nil
 }
+
+// pushReadReceipt 向消息发送者推送已读回执（存在拉黑关系时不推送）
+// 回执只推送给在线连接，不进入离线队列；离线的发送者可从消息的 status / is_read 获取已读状态
+func (s *MessageService) pushReadReceipt(readerID, senderID uint, fields map[string]interface{}) {
+	if blocked, err := s.friendshipRepo.IsBlocked(readerID, senderID); err != nil || blocked {
+		return
+	}
+	receipt := map[string]interface{}{
+		"type":    "read_receipt",
+		"from":    readerID,
+		"read_at": time.Now().Unix(),
+	}
+	for k, v := range fields {
+		receipt[k] = v
+	}
+	if b, err := json.Marshal(receipt); err == nil {
+		websocket.GetManager().SendToUser(senderID, b)
+	}
+}
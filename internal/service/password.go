@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"im-system/config"
+	"im-system/internal/model"
+	"im-system/pkg/logger"
+	"im-system/pkg/mail"
+	"im-system/pkg/password"
+	"im-system/pkg/redis"
+
+	"go.uber.org/zap"
+)
+
+// 未配置时的重置密码参数
+const (
+	defaultResetTokenTTL = 30 * time.Minute
+	defaultResetCooldown = time.Minute
+)
+
+var (
+	// ErrWeakPassword 密码不满足强度策略（错误信息中包含具体原因）
+	ErrWeakPassword = errors.New("weak password")
+	// ErrWrongPassword 原密码错误
+	ErrWrongPassword = errors.New("old password is incorrect")
+	// ErrSamePassword 新密码与原密码相同
+	ErrSamePassword = errors.New("new password must be different from the old password")
+	// ErrInvalidResetToken 重置密码令牌无效、已过期或已使用
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+// newPasswordPolicy 根据配置创建密码强度策略
+func newPasswordPolicy(cfg config.PasswordConfig) password.Policy {
+	return password.Policy{
+		MinLength:     cfg.MinLength,
+		MinClasses:    cfg.MinClasses,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+	}
+}
+
+// validatePassword 按密码策略校验密码，不满足时返回包装了 ErrWeakPassword 的错误
+func (s *UserService) validatePassword(plain, username string) error {
+	if err := s.passwordPolicy.Validate(plain, username); err != nil {
+		return fmt.Errorf("%w: %v", ErrWeakPassword, err)
+	}
+	return nil
+}
+
+// ChangePassword 修改密码（需要原密码），成功后吊销除 currentSessionID 外的所有登录会话
+// 原密码错误按登录失败计数，达到阈值后同样退避或锁定
+func (s *UserService) ChangePassword(userID uint, currentSessionID, oldPassword, newPassword string, client *ClientInfo) error {
+	u, err := s.repo.GetByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	ip := client.normalize().IP
+	if err := s.loginGuard.CheckAccount(u.ID); err != nil {
+		return err
+	}
+	if !password.Verify(oldPassword, u.PasswordHash) {
+		if err := s.loginGuard.Fail(u.ID, ip); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+	s.loginGuard.Succeed(u.ID)
+
+	if err := s.validatePassword(newPassword, u.Username); err != nil {
+		return err
+	}
+	if password.Verify(newPassword, u.PasswordHash) {
+		return ErrSamePassword
+	}
+	if err := s.setPassword(u.ID, newPassword); err != nil {
+		return err
+	}
+
+	s.revokeOtherSessions(u.ID, currentSessionID, SessionRevokePasswordChanged)
+	recordAudit(s.auditRepo, &model.AuditLog{Action: model.AuditPasswordChanged, UserID: u.ID, ActorID: u.ID, IP: ip})
+	return nil
+}
+
+// RequestPasswordReset 向邮箱发送重置密码令牌
+// 邮箱未注册、处于冷却时间内时同样返回成功，避免据此探测账号
+func (s *UserService) RequestPasswordReset(email string, client *ClientInfo) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+	u, err := s.repo.GetByEmail(email)
+	if err != nil {
+		return nil
+	}
+	ok, err := redis.AcquirePasswordResetCooldown(u.ID, s.resetCooldown())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	token, hash, err := password.NewResetToken()
+	if err != nil {
+		return err
+	}
+	ttl := s.resetTokenTTL()
+	if err := redis.SavePasswordResetToken(u.ID, hash, ttl); err != nil {
+		return err
+	}
+	if err := s.mailer.Send(s.resetMail(u, token, ttl)); err != nil {
+		// 不向调用方暴露发送结果
+		logger.Error("发送重置密码邮件失败", zap.Uint("user_id", u.ID), zap.Error(err))
+		return nil
+	}
+	recordAudit(s.auditRepo, &model.AuditLog{Action: model.AuditPasswordResetRequested, UserID: u.ID, IP: client.normalize().IP})
+	return nil
+}
+
+// ResetPassword 使用邮件中的令牌重置密码（令牌只能使用一次）
+// 成功后吊销该用户的所有登录会话，并解除登录锁定
+func (s *UserService) ResetPassword(token, newPassword string, client *ClientInfo) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	hash := password.HashResetToken(token)
+
+	// 先校验新密码再消耗令牌，密码不合规时令牌仍可使用
+	userID, err := redis.GetPasswordResetToken(hash)
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return ErrInvalidResetToken
+	}
+	u, err := s.repo.GetByID(userID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := s.validatePassword(newPassword, u.Username); err != nil {
+		return err
+	}
+	if used, err := redis.UsePasswordResetToken(hash); err != nil {
+		return err
+	} else if used != u.ID {
+		return ErrInvalidResetToken
+	}
+	if err := s.setPassword(u.ID, newPassword); err != nil {
+		return err
+	}
+
+	s.revokeOtherSessions(u.ID, "", SessionRevokePasswordChanged)
+	s.loginGuard.Clear(u.ID)
+	recordAudit(s.auditRepo, &model.AuditLog{Action: model.AuditPasswordReset, UserID: u.ID, IP: client.normalize().IP})
+	return nil
+}
+
+// setPassword 保存新密码的哈希，并使未使用的重置密码令牌失效
+func (s *UserService) setPassword(userID uint, plain string) error {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(userID, hash); err != nil {
+		return err
+	}
+	_ = redis.DeletePasswordResetToken(userID)
+	return nil
+}
+
+// resetMail 生成重置密码邮件
+func (s *UserService) resetMail(u *model.User, token string, ttl time.Duration) *mail.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s，你好：\n\n", u.Username)
+	body.WriteString("我们收到了重置你的账号密码的请求。")
+	if s.passwordCfg.ResetURL != "" {
+		fmt.Fprintf(&body, "请打开以下链接设置新密码：\n\n%s\n\n", strings.ReplaceAll(s.passwordCfg.ResetURL, "{token}", token))
+	} else {
+		fmt.Fprintf(&body, "请使用以下令牌设置新密码：\n\n%s\n\n", token)
+	}
+	fmt.Fprintf(&body, "该令牌 %d 分钟内有效，且只能使用一次。如果这不是你本人的操作，请忽略本邮件。\n", int(ttl.Minutes()))
+	return &mail.Message{
+		To:      u.Email,
+		Subject: "重置密码",
+		Body:    body.String(),
+	}
+}
+
+// resetTokenTTL 重置密码令牌有效期
+func (s *UserService) resetTokenTTL() time.Duration {
+	if s.passwordCfg.ResetTokenTTL > 0 {
+		return s.passwordCfg.ResetTokenTTL
+	}
+	return defaultResetTokenTTL
+}
+
+// resetCooldown 两次发送重置邮件的最短间隔
+func (s *UserService) resetCooldown() time.Duration {
+	if s.passwordCfg.ResetCooldown > 0 {
+		return s.passwordCfg.ResetCooldown
+	}
+	return defaultResetCooldown
+}
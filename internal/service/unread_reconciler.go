@@ -0,0 +1,79 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"im-system/pkg/logger"
+	"im-system/pkg/redis"
+
+	"go.uber.org/zap"
+)
+
+// UnreadReconciler 未读计数定时校正
+// Redis 中的会话未读数由发送、已读等操作增量维护，Redis 写入失败或并发重建时可能与数据库不一致；
+// 定时以数据库统计结果重建所有已初始化的未读计数（未初始化的在读取时按需重建）
+type UnreadReconciler struct {
+	messageSvc *MessageService
+	interval   time.Duration
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewUnreadReconciler 创建UnreadReconciler实例，interval 不大于0时不启动校正
+func NewUnreadReconciler(messageSvc *MessageService, interval time.Duration) *UnreadReconciler {
+	return &UnreadReconciler{
+		messageSvc: messageSvc,
+		interval:   interval,
+		done:       make(chan struct{}),
+	}
+}
+
+// Start 启动定时校正
+func (r *UnreadReconciler) Start() {
+	if r.interval <= 0 {
+		return
+	}
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop 停止定时校正，等待正在进行的校正完成
+func (r *UnreadReconciler) Stop() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *UnreadReconciler) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.Reconcile()
+		}
+	}
+}
+
+// Reconcile 重建所有已初始化用户的未读计数
+func (r *UnreadReconciler) Reconcile() {
+	userIDs, err := redis.ScanUnreadUserIDs()
+	if err != nil {
+		logger.Warn("扫描未读计数失败", zap.Error(err))
+		return
+	}
+
+	for _, userID := range userIDs {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		if _, err := r.messageSvc.RebuildUnreadCounts(userID); err != nil {
+			logger.Warn("重建未读计数失败", zap.Uint("user_id", userID), zap.Error(err))
+		}
+	}
+}
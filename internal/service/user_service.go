@@ -2,37 +2,59 @@ package service
 
 import (
 	"errors"
-	"fmt"
 	"strings"
 	"time"
 
+	"im-system/config"
 	"im-system/internal/model"
 	"im-system/internal/repository"
 	"im-system/pkg/jwt"
+	"im-system/pkg/mail"
 	"im-system/pkg/password"
 	"im-system/pkg/redis"
 )
 
+// dummyPasswordHash 账号不存在时用于校验的哈希（与 password.Hash 相同的 cost），使耗时与密码错误一致
+const dummyPasswordHash = "$2a$10$XeqFGzAyQS59WLhMiXPxOeuBmW6XTfCm3gkobsvZGeOXo4unGkagS"
+
 type UserService struct {
-	repo       *repository.UserRepository
-	jwtService *jwt.JWTService
+	repo           *repository.UserRepository
+	sessionRepo    *repository.UserSessionRepository
+	auditRepo      *repository.AuditLogRepository
+	jwtService     *jwt.JWTService
+	loginGuard     *LoginGuard
+	mailer         mail.Mailer
+	passwordCfg    config.PasswordConfig
+	passwordPolicy password.Policy
 }
 
-func NewUserService(repo *repository.UserRepository, jwtService *jwt.JWTService) *UserService {
-	return &UserService{repo: repo, jwtService: jwtService}
+func NewUserService(repo *repository.UserRepository, sessionRepo *repository.UserSessionRepository, auditRepo *repository.AuditLogRepository, jwtService *jwt.JWTService, loginGuard *LoginGuard, mailer mail.Mailer, passwordCfg config.PasswordConfig) *UserService {
+	return &UserService{
+		repo:           repo,
+		sessionRepo:    sessionRepo,
+		auditRepo:      auditRepo,
+		jwtService:     jwtService,
+		loginGuard:     loginGuard,
+		mailer:         mailer,
+		passwordCfg:    passwordCfg,
+		passwordPolicy: newPasswordPolicy(passwordCfg),
+	}
 }
 
-// Register 注册
-func (s *UserService) Register(username, email, plainPassword string) (*model.User, string, error) {
+// Register 注册（注册成功即登录，签发令牌）
+func (s *UserService) Register(username, email, plainPassword string, client *ClientInfo) (*model.User, *TokenPair, error) {
 	username = strings.TrimSpace(username)
 	email = strings.TrimSpace(email)
 	if username == "" || plainPassword == "" {
-		return nil, "", errors.New("username and password are required")
+		return nil, nil, errors.New("username and password are required")
+	}
+	if err := s.validatePassword(plainPassword, username); err != nil {
+		return nil, nil, err
 	}
 	// 密码哈希
 	hash, err := password.Hash(plainPassword)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	user := &model.User{
 		Username:     username,
@@ -42,52 +64,78 @@ func (s *UserService) Register(username, email, plainPassword string) (*model.Us
 		LastSeen:     time.Now(),
 	}
 	if err := s.repo.Create(user); err != nil {
-		return nil, "", err
-	}
-	// 默认签发 token
-	token, err := s.jwtService.GenerateToken(
-		// 使用用户ID作为 subject
-		// 转成字符串
-		fmt.Sprintf("%d", user.ID),
-		map[string]interface{}{"username": user.Username},
-	)
+		return nil, nil, err
+	}
+	// 默认签发 token，开启新的登录会话
+	tokens, err := s.startSession(user, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	return user, token, nil
+	return user, tokens, nil
 }
 
-// Login 登录
-func (s *UserService) Login(identifier, plainPassword string) (*model.User, string, error) {
+// Login 登录，每次登录开启新的登录会话
+// 登录失败按账号与来源IP计数，超过阈值后返回 *LoginBlockedError（退避或临时锁定）
+func (s *UserService) Login(identifier, plainPassword string, client *ClientInfo) (*model.User, *TokenPair, error) {
 	identifier = strings.TrimSpace(identifier)
 	if identifier == "" || plainPassword == "" {
-		return nil, "", errors.New("identifier and password are required")
+		return nil, nil, errors.New("identifier and password are required")
+	}
+	ip := client.normalize().IP
+	if err := s.loginGuard.CheckIP(ip); err != nil {
+		return nil, nil, err
 	}
 	u, err := s.repo.GetByUsernameOrEmail(identifier)
 	if err != nil {
-		return nil, "", err
+		// 账号不存在与密码错误返回相同的错误，并同样执行一次哈希校验，避免通过错误或耗时探测账号
+		password.Verify(plainPassword, dummyPasswordHash)
+		if err := s.loginGuard.Fail(0, ip); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err := s.loginGuard.CheckAccount(u.ID); err != nil {
+		return nil, nil, err
 	}
 	if !password.Verify(plainPassword, u.PasswordHash) {
-		return nil, "", errors.New("invalid credentials")
+		if err := s.loginGuard.Fail(u.ID, ip); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
 	}
+	s.loginGuard.Succeed(u.ID)
 	// 登录成功：更新状态为 online，并刷新最近在线时间
 	_ = s.repo.UpdateStatus(u.ID, "online")
 
 	// 更新Redis在线状态
 	_ = redis.SetUserPresence(u.ID, u.Username, "online")
 
-	token, err := s.jwtService.GenerateToken(
-		fmt.Sprintf("%d", u.ID),
-		map[string]interface{}{"username": u.Username},
-	)
+	tokens, err := s.startSession(u, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	return u, token, nil
+	return u, tokens, nil
 }
 
-// Logout 登出：将状态置为 offline
-func (s *UserService) Logout(userID uint) error {
+// UnlockLogin 管理员解除账号的登录锁定
+func (s *UserService) UnlockLogin(adminID, userID uint) error {
+	if _, err := s.repo.GetByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+	return s.loginGuard.Unlock(userID, adminID)
+}
+
+// Logout 登出：吊销当前访问令牌及其登录会话（刷新令牌一并失效），断开该会话的WebSocket连接，并将状态置为 offline
+func (s *UserService) Logout(userID uint, claims *jwt.CustomClaims) error {
+	if claims != nil {
+		if claims.ID != "" {
+			if err := redis.RevokeToken(claims.ID, claims.RemainingTTL()); err != nil {
+				return err
+			}
+		}
+		s.revokeSession(userID, claims.SessionID, SessionRevokeLogout)
+	}
+
 	// 更新数据库状态
 	err := s.repo.UpdateStatus(userID, "offline")
 	if err != nil {
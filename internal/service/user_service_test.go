@@ -0,0 +1,18 @@
+package service
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 账号不存在时的哈希校验需与真实账号耗时一致：必须是有效的 bcrypt 哈希，且 cost 与 password.Hash 相同
+func TestDummyPasswordHashMatchesHashCost(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Fatalf("cost = %d, want %d", cost, bcrypt.DefaultCost)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"im-system/internal/model"
+	"im-system/pkg/jwt"
+	"im-system/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 登录会话吊销原因（同时作为WebSocket关闭原因发给客户端）
+const (
+	SessionRevokeLogout          = "logout"               // 用户登出
+	SessionRevokeKicked          = "kicked"               // 被用户在其他设备上踢下线
+	SessionRevokeReused          = "refresh_token_reused" // 刷新令牌被重复使用
+	SessionRevokePasswordChanged = "password_changed"     // 修改或重置了密码
+	sessionDeviceNameMax         = 64
+	sessionUserAgentMax          = 255
+)
+
+// ErrSessionNotFound 登录会话不存在、不属于当前用户或已失效
+var ErrSessionNotFound = errors.New("session not found")
+
+// ClientInfo 发起登录/刷新的客户端信息，记录到登录会话
+type ClientInfo struct {
+	DeviceName string
+	IP         string
+	UserAgent  string
+}
+
+// normalize 去除空白并截断到字段长度（nil 时返回空信息）
+func (c *ClientInfo) normalize() *ClientInfo {
+	if c == nil {
+		return &ClientInfo{}
+	}
+	return &ClientInfo{
+		DeviceName: truncateRunes(strings.TrimSpace(c.DeviceName), sessionDeviceNameMax),
+		IP:         c.IP,
+		UserAgent:  truncateRunes(c.UserAgent, sessionUserAgentMax),
+	}
+}
+
+// startSession 开启新的登录会话并签发令牌
+func (s *UserService) startSession(user *model.User, client *ClientInfo) (*TokenPair, error) {
+	sessionID := jwt.NewID()
+	tokens, err := s.issueTokens(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	client = client.normalize()
+	err = s.sessionRepo.Create(&model.UserSession{
+		ID:         sessionID,
+		UserID:     user.ID,
+		TokenID:    tokens.TokenID,
+		DeviceName: client.DeviceName,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  tokens.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// ListSessions 获取用户当前有效的登录会话（按最近活跃时间倒序）
+func (s *UserService) ListSessions(userID uint) ([]*model.UserSession, error) {
+	return s.sessionRepo.ListActive(userID)
+}
+
+// revokeOtherSessions 吊销用户除 keepSessionID 外的所有有效登录会话（keepSessionID 为空时全部吊销）
+func (s *UserService) revokeOtherSessions(userID uint, keepSessionID, reason string) {
+	sessions, err := s.sessionRepo.ListActive(userID)
+	if err != nil {
+		logger.Error("获取登录会话失败", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	for _, session := range sessions {
+		if session.ID != keepSessionID {
+			s.revokeSession(userID, session.ID, reason)
+		}
+	}
+}
+
+// KickSession 吊销用户的指定登录会话（踢下线），该会话的WebSocket连接收到 kicked 后断开
+func (s *UserService) KickSession(userID uint, sessionID string) error {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+	s.revokeSession(userID, sessionID, SessionRevokeKicked)
+	return nil
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -1,57 +1,184 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
 
 	"im-system/config"
+	"im-system/pkg/redis"
 
 	jwtv5 "github.com/golang-jwt/jwt/v5"
 )
 
 // JWTService 提供 JWT 生成与校验能力
-// 使用对称密钥 HS256
+// 默认使用对称密钥 HS256；配置 RS256 / EdDSA 时使用私钥签名，令牌头带 kid，
+// 按 kid 选择验证公钥（可同时保留多个公钥以便密钥轮换），公钥通过 JWKS 对外公布
 // 仅存放不可逆的用户标识（例如用户ID）在 Subject
 // 其他非敏感信息可放入 Data
+// 每个访问令牌带唯一的 jti，并记录所属的登录会话 sid，二者均可被吊销（吊销列表保存在 Redis）
 
 type JWTService struct {
-	secretKey   []byte        // 对称密钥
-	issuer      string        // 签发者
-	expireAfter time.Duration // 过期时间
+	secretKey    []byte                      // 对称密钥（HS256）
+	method       jwtv5.SigningMethod         // 签名算法
+	signKey      interface{}                 // 签名密钥（HS256 为 secretKey，非对称算法为私钥）
+	keyID        string                      // 签名密钥ID（kid），HS256 时为空
+	verifyKeys   map[string]*verificationKey // kid -> 验证公钥（非对称算法）
+	issuer       string                      // 签发者
+	expireAfter  time.Duration               // 访问令牌过期时间
+	refreshAfter time.Duration               // 刷新令牌过期时间
 }
 
 // CustomClaims 自定义声明载荷
 // Data 用于扩展非敏感业务字段
+// SessionID 登录会话ID，同一次登录轮换出的令牌共享
 
 type CustomClaims struct {
-	Data map[string]interface{} `json:"data,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	SessionID string                 `json:"sid,omitempty"`
 	jwtv5.RegisteredClaims
 }
 
-// NewJWTService 创建 JWT 服务
-func NewJWTService(cfg config.JWTConfig) *JWTService {
-	return &JWTService{
-		secretKey:   []byte(cfg.Secret),
-		issuer:      cfg.Issuer,
-		expireAfter: cfg.ExpireTime,
+// 未配置时的刷新令牌有效期
+const defaultRefreshExpire = 7 * 24 * time.Hour
+
+// ErrTokenRevoked 令牌或其所属会话已被吊销
+var ErrTokenRevoked = errors.New("token revoked")
+
+// NewJWTService 创建 JWT 服务，非对称算法时从 PEM 文件加载签名私钥与验证公钥
+func NewJWTService(cfg config.JWTConfig) (*JWTService, error) {
+	refreshAfter := cfg.RefreshExpireTime
+	if refreshAfter <= 0 {
+		refreshAfter = defaultRefreshExpire
+	}
+	s := &JWTService{
+		secretKey:    []byte(cfg.Secret),
+		issuer:       cfg.Issuer,
+		expireAfter:  cfg.ExpireTime,
+		refreshAfter: refreshAfter,
+	}
+
+	switch cfg.Algorithm {
+	case "", AlgHS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("jwt secret is required for HS256")
+		}
+		s.method = jwtv5.SigningMethodHS256
+		s.signKey = s.secretKey
+		return s, nil
+	case AlgRS256, AlgEdDSA:
+		if err := s.loadKeys(cfg); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", cfg.Algorithm)
+	}
+}
+
+// loadKeys 加载非对称签名私钥与验证公钥（签名私钥对应的公钥自动加入验证公钥）
+func (s *JWTService) loadKeys(cfg config.JWTConfig) error {
+	if cfg.SigningKeyFile == "" {
+		return fmt.Errorf("jwt signing key file is required for %s", cfg.Algorithm)
+	}
+	signer, err := loadPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+	method, err := methodForKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	if method.Alg() != cfg.Algorithm {
+		return fmt.Errorf("jwt signing key is not a %s key", cfg.Algorithm)
+	}
+
+	s.method = method
+	s.signKey = signer
+	s.verifyKeys = make(map[string]*verificationKey)
+	s.keyID, err = s.addVerificationKey(cfg.SigningKeyID, signer.Public())
+	if err != nil {
+		return err
+	}
+	for _, k := range cfg.VerificationKeys {
+		pub, err := loadPublicKey(k.File)
+		if err != nil {
+			return err
+		}
+		if _, err := s.addVerificationKey(k.ID, pub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addVerificationKey 添加验证公钥，id 为空时根据公钥生成，返回使用的 kid
+func (s *JWTService) addVerificationKey(id string, pub crypto.PublicKey) (string, error) {
+	method, err := methodForKey(pub)
+	if err != nil {
+		return "", err
 	}
+	if id == "" {
+		if id, err = keyThumbprint(pub); err != nil {
+			return "", err
+		}
+	}
+	if _, ok := s.verifyKeys[id]; ok {
+		return "", fmt.Errorf("duplicate jwt key id: %s", id)
+	}
+	s.verifyKeys[id] = &verificationKey{id: id, method: method, key: pub}
+	return id, nil
 }
 
-// GenerateToken 生成访问令牌
-// userID 作为 Subject 存入标准声明
+// JWKS 对外公布的验证公钥（HS256 时为空）
+func (s *JWTService) JWKS() []JWK {
+	keys := make([]JWK, 0, len(s.verifyKeys))
+	if k, ok := s.verifyKeys[s.keyID]; ok {
+		keys = append(keys, k.toJWK())
+	}
+	for id, k := range s.verifyKeys {
+		if id != s.keyID {
+			keys = append(keys, k.toJWK())
+		}
+	}
+	return keys
+}
+
+// Algorithm 签名算法
+func (s *JWTService) Algorithm() string {
+	return s.method.Alg()
+}
+
+// ExpireAfter 访问令牌有效期
+func (s *JWTService) ExpireAfter() time.Duration {
+	return s.expireAfter
+}
+
+// RefreshExpireAfter 刷新令牌有效期
+func (s *JWTService) RefreshExpireAfter() time.Duration {
+	return s.refreshAfter
+}
+
+// GenerateToken 生成访问令牌，返回令牌及其 jti
+// userID 作为 Subject 存入标准声明，sessionID 为所属的登录会话
 // extraData 将写入 Data 字段（仅存放非敏感信息）
-func (s *JWTService) GenerateToken(userID string, extraData map[string]interface{}) (string, error) {
+func (s *JWTService) GenerateToken(userID, sessionID string, extraData map[string]interface{}) (string, string, error) {
 	if userID == "" {
-		return "", errors.New("userID is required")
+		return "", "", errors.New("userID is required")
 	}
 
 	now := time.Now()
 	expiresAt := now.Add(s.expireAfter)
 
 	claims := &CustomClaims{
-		Data: extraData,
+		Data:      extraData,
+		SessionID: sessionID,
 		RegisteredClaims: jwtv5.RegisteredClaims{
+			ID:        NewID(),
 			Issuer:    s.issuer,
 			Subject:   userID,
 			IssuedAt:  jwtv5.NewNumericDate(now),
@@ -60,15 +187,18 @@ func (s *JWTService) GenerateToken(userID string, extraData map[string]interface
 		},
 	}
 
-	token := jwtv5.NewWithClaims(jwtv5.SigningMethodHS256, claims)
-	signed, err := token.SignedString(s.secretKey)
+	token := jwtv5.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	signed, err := token.SignedString(s.signKey)
 	if err != nil {
-		return "", fmt.Errorf("sign token failed: %w", err)
+		return "", "", fmt.Errorf("sign token failed: %w", err)
 	}
-	return signed, nil
+	return signed, claims.ID, nil
 }
 
-// ValidateToken 校验并解析令牌
+// ValidateToken 校验并解析令牌，并检查令牌及其会话是否已被吊销
 // 返回解析出的自定义声明（包含 Subject 和 Data）
 func (s *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
 	if tokenString == "" {
@@ -79,14 +209,8 @@ func (s *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
 	parsedToken, err := jwtv5.ParseWithClaims(
 		tokenString, // 令牌字符串
 		claims,      // 自定义声明
-		// 验证签名方法
-		func(token *jwtv5.Token) (interface{}, error) {
-			// 验证签名方法
-			if token.Method != jwtv5.SigningMethodHS256 {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return s.secretKey, nil
-		},
+		// 验证签名方法并选择验证密钥
+		s.verificationKey,
 		// 验证签发者
 		jwtv5.WithIssuer(s.issuer),
 	)
@@ -96,5 +220,65 @@ func (s *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
 	if !parsedToken.Valid {
 		return nil, errors.New("invalid token")
 	}
+	revoked, err := redis.IsRevoked(claims.ID, claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("check revocation failed: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
 	return claims, nil
 }
+
+// verificationKey 按令牌的签名算法与 kid 选择验证密钥
+func (s *JWTService) verificationKey(token *jwtv5.Token) (interface{}, error) {
+	if s.method == jwtv5.SigningMethodHS256 {
+		if token.Method != jwtv5.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.secretKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.verifyKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// RemainingTTL 令牌剩余有效期（用于设置吊销记录的过期时间）
+func (c *CustomClaims) RemainingTTL() time.Duration {
+	if c.ExpiresAt == nil {
+		return 0
+	}
+	return time.Until(c.ExpiresAt.Time)
+}
+
+// NewID 生成随机ID（用作 jti 与登录会话ID）
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewRefreshToken 生成不透明的刷新令牌，返回令牌及其哈希（服务端只保存哈希）
+func NewRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate refresh token failed: %w", err)
+	}
+	token = hex.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken 计算刷新令牌的哈希
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
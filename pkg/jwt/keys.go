@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	jwtv5 "github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256" // 对称密钥（默认）
+	AlgRS256 = "RS256" // RSA 私钥签名，公钥验证
+	AlgEdDSA = "EdDSA" // Ed25519 私钥签名，公钥验证
+)
+
+// verificationKey 非对称验证公钥
+type verificationKey struct {
+	id     string
+	method jwtv5.SigningMethod
+	key    crypto.PublicKey
+}
+
+// JWK JSON Web Key（仅公钥）
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA 模数
+	E   string `json:"e,omitempty"`   // RSA 指数
+	Crv string `json:"crv,omitempty"` // OKP 曲线
+	X   string `json:"x,omitempty"`   // OKP 公钥
+}
+
+// loadPrivateKey 从 PEM 文件加载签名私钥（RSA: PKCS#1 / PKCS#8，Ed25519: PKCS#8）
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s failed: %w", path, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key algorithm in %s", path)
+	}
+}
+
+// loadPublicKey 从 PEM 文件加载验证公钥（PKIX 公钥或 RSA PKCS#1 公钥；也可直接使用私钥文件）
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key %s failed: %w", path, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key %s failed: %w", path, err)
+		}
+		return key, nil
+	default:
+		signer, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+}
+
+// readPEM 读取 PEM 文件中的第一个块
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file failed: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// methodForKey 根据公钥类型确定签名算法
+func methodForKey(key crypto.PublicKey) (jwtv5.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwtv5.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwtv5.SigningMethodEdDSA, nil
+	default:
+		return nil, errors.New("unsupported public key algorithm")
+	}
+}
+
+// keyThumbprint 根据公钥生成默认的 kid（公钥 DER 的 SHA-256 前 8 字节）
+func keyThumbprint(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:8]), nil
+}
+
+// toJWK 将验证公钥转换为 JWK
+func (k *verificationKey) toJWK() JWK {
+	jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
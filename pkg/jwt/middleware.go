@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"strings"
 
 	"im-system/pkg/logger"
@@ -48,19 +49,17 @@ func (s *JWTService) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 验证token
-		logger.Info("开始验证JWT token",
-			zap.String("token_preview", tokenString[:20]+"..."),
-			zap.String("secret_key_preview", string(s.secretKey[:10])+"..."),
-		)
-
 		claims, err := s.ValidateToken(tokenString)
 		if err != nil {
 			logger.Error("JWT验证失败",
 				zap.Error(err),
-				zap.String("token_preview", tokenString[:20]+"..."),
-				zap.String("secret_key_preview", string(s.secretKey[:10])+"..."),
+				zap.String("algorithm", s.Algorithm()),
 			)
-			response.Unauthorized(c, "token无效或已过期")
+			if errors.Is(err, ErrTokenRevoked) {
+				response.Unauthorized(c, "token已失效，请重新登录")
+			} else {
+				response.Unauthorized(c, "token无效或已过期")
+			}
 			c.Abort()
 			return
 		}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"im-system/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// LogMailer 将邮件写入应用日志（本地开发用，不实际发送）
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer 创建LogMailer实例
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send 将邮件内容输出到日志
+func (m *LogMailer) Send(msg *Message) error {
+	from := msg.From
+	if from == "" {
+		from = m.from
+	}
+	logger.Info("发送邮件（log）",
+		zap.String("from", from),
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	return nil
+}
@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"fmt"
+
+	"im-system/config"
+)
+
+// Message 邮件
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string // 纯文本正文
+}
+
+// Mailer 邮件发送器
+// 目前提供用于本地开发的 log（写入应用日志）与 file（写入 .eml 文件）两种实现，接入真实邮件服务时实现该接口即可
+type Mailer interface {
+	// Send 发送邮件，From 为空时使用配置的发件人
+	Send(msg *Message) error
+}
+
+// NewMailer 根据配置创建邮件发送器
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return NewLogMailer(cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		return nil, fmt.Errorf("不支持的邮件驱动: %s", cfg.Driver)
+	}
+}
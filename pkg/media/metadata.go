@@ -0,0 +1,381 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// File 可原地读写的文件（*os.File 满足该接口）
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// 元数据块类型
+const (
+	blockExif = iota + 1 // EXIF（TIFF结构）
+	blockXMP             // XMP（XML文本）
+)
+
+// block 文件中的一段元数据
+type block struct {
+	kind   int
+	offset int64 // 元数据内容在文件中的偏移
+	length int64
+	crcOff int64 // PNG 块 CRC 的偏移，其他格式为 -1
+}
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	pngXMPKey    = []byte("XML:com.adobe.xmp\x00")
+)
+
+// 单个元数据块的读取上限，超过的按损坏处理
+const maxBlockSize = 16 << 20
+
+// StripLocation 原地清除图片元数据中的位置信息，文件长度不变
+// 清空 EXIF 中的 GPS 信息（其余 EXIF 字段如拍摄方向保留），XMP 可能包含位置，整段以空格覆盖
+// 支持 JPEG、PNG、WebP，返回是否有修改
+func StripLocation(f File, size int64, mime string) (bool, error) {
+	blocks, err := findBlocks(f, size, mime)
+	if err != nil {
+		return false, err
+	}
+
+	modified := false
+	for _, b := range blocks {
+		if b.length > maxBlockSize {
+			return false, errors.New("metadata block too large")
+		}
+		data := make([]byte, b.length)
+		if _, err := f.ReadAt(data, b.offset); err != nil {
+			return false, err
+		}
+
+		changed := false
+		switch b.kind {
+		case blockExif:
+			changed = scrubGPS(data)
+		case blockXMP:
+			changed = blankXMP(data)
+		}
+		if !changed {
+			continue
+		}
+
+		if _, err := f.WriteAt(data, b.offset); err != nil {
+			return false, err
+		}
+		if b.crcOff >= 0 {
+			if err := fixPNGCRC(f, b); err != nil {
+				return false, err
+			}
+		}
+		modified = true
+	}
+	return modified, nil
+}
+
+// Orientation 读取 EXIF 中的拍摄方向（1~8），没有时返回 1
+func Orientation(r io.ReaderAt, size int64, mime string) int {
+	blocks, err := findBlocks(r, size, mime)
+	if err != nil {
+		return 1
+	}
+	for _, b := range blocks {
+		if b.kind != blockExif || b.length > maxBlockSize {
+			continue
+		}
+		data := make([]byte, b.length)
+		if _, err := r.ReadAt(data, b.offset); err != nil {
+			return 1
+		}
+		if o := exifOrientation(data); o >= 1 && o <= 8 {
+			return o
+		}
+	}
+	return 1
+}
+
+// findBlocks 定位文件中的 EXIF 与 XMP 元数据
+func findBlocks(r io.ReaderAt, size int64, mime string) ([]block, error) {
+	switch mime {
+	case "image/jpeg":
+		return jpegBlocks(r, size)
+	case "image/png":
+		return pngBlocks(r, size)
+	case "image/webp":
+		return webpBlocks(r, size)
+	default:
+		return nil, nil
+	}
+}
+
+// jpegBlocks 遍历 JPEG 段，直到图像数据开始（SOS）
+func jpegBlocks(r io.ReaderAt, size int64) ([]block, error) {
+	var blocks []block
+	head := make([]byte, 4)
+	off := int64(2) // 跳过 SOI
+	for off+4 <= size {
+		if _, err := r.ReadAt(head, off); err != nil {
+			return nil, err
+		}
+		if head[0] != 0xFF {
+			return nil, errors.New("invalid jpeg segment")
+		}
+		marker := head[1]
+		if marker == 0xFF { // 填充字节
+			off++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // SOS / EOI
+			break
+		}
+		segLen := int64(binary.BigEndian.Uint16(head[2:]))
+		if segLen < 2 || off+2+segLen > size {
+			return nil, errors.New("invalid jpeg segment length")
+		}
+		if marker == 0xE1 { // APP1: EXIF 或 XMP
+			data := off + 4
+			n := segLen - 2
+			prefix := make([]byte, min(n, int64(len(xmpHeader))))
+			if _, err := r.ReadAt(prefix, data); err != nil {
+				return nil, err
+			}
+			switch {
+			case bytes.HasPrefix(prefix, exifHeader):
+				blocks = append(blocks, block{kind: blockExif, offset: data + 6, length: n - 6, crcOff: -1})
+			case bytes.Equal(prefix, xmpHeader):
+				hl := int64(len(xmpHeader))
+				blocks = append(blocks, block{kind: blockXMP, offset: data + hl, length: n - hl, crcOff: -1})
+			}
+		}
+		off += 2 + segLen
+	}
+	return blocks, nil
+}
+
+// pngBlocks 遍历 PNG 块，eXIf 为 EXIF，iTXt 中关键字为 XML:com.adobe.xmp 的为 XMP
+func pngBlocks(r io.ReaderAt, size int64) ([]block, error) {
+	sig := make([]byte, len(pngSignature))
+	if size < int64(len(sig)) {
+		return nil, errors.New("invalid png signature")
+	}
+	if _, err := r.ReadAt(sig, 0); err != nil || !bytes.Equal(sig, pngSignature) {
+		return nil, errors.New("invalid png signature")
+	}
+
+	var blocks []block
+	head := make([]byte, 8)
+	off := int64(len(pngSignature))
+	for off+12 <= size {
+		if _, err := r.ReadAt(head, off); err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint32(head[:4]))
+		typ := string(head[4:8])
+		if off+12+n > size {
+			return nil, errors.New("invalid png chunk length")
+		}
+		data := off + 8
+		switch typ {
+		case "eXIf":
+			blocks = append(blocks, block{kind: blockExif, offset: data, length: n, crcOff: data + n})
+		case "iTXt":
+			key := make([]byte, min(n, int64(len(pngXMPKey))))
+			if _, err := r.ReadAt(key, data); err != nil {
+				return nil, err
+			}
+			if bytes.Equal(key, pngXMPKey) {
+				// 关键字后依次为压缩标志、压缩方法、语言标签与翻译关键字（均以\0结尾），这里整块覆盖文本部分
+				blocks = append(blocks, block{kind: blockXMP, offset: data, length: n, crcOff: data + n})
+			}
+		case "IEND":
+			return blocks, nil
+		}
+		off += 12 + n
+	}
+	return blocks, nil
+}
+
+// webpBlocks 遍历 WebP（RIFF）块
+func webpBlocks(r io.ReaderAt, size int64) ([]block, error) {
+	head := make([]byte, 12)
+	if size < int64(len(head)) {
+		return nil, errors.New("invalid webp header")
+	}
+	if _, err := r.ReadAt(head, 0); err != nil || string(head[:4]) != "RIFF" || string(head[8:]) != "WEBP" {
+		return nil, errors.New("invalid webp header")
+	}
+
+	var blocks []block
+	off := int64(12)
+	for off+8 <= size {
+		if _, err := r.ReadAt(head[:8], off); err != nil {
+			return nil, err
+		}
+		n := int64(binary.LittleEndian.Uint32(head[4:8]))
+		if off+8+n > size {
+			return nil, errors.New("invalid webp chunk length")
+		}
+		switch string(head[:4]) {
+		case "EXIF":
+			// 部分编码器会带上 JPEG 的 "Exif\0\0" 前缀
+			data, length := off+8, n
+			prefix := make([]byte, min(n, int64(len(exifHeader))))
+			if _, err := r.ReadAt(prefix, data); err != nil {
+				return nil, err
+			}
+			if bytes.Equal(prefix, exifHeader) {
+				data, length = data+6, length-6
+			}
+			blocks = append(blocks, block{kind: blockExif, offset: data, length: length, crcOff: -1})
+		case "XMP ":
+			blocks = append(blocks, block{kind: blockXMP, offset: off + 8, length: n, crcOff: -1})
+		}
+		off += 8 + n + n%2 // 块按偶数字节对齐
+	}
+	return blocks, nil
+}
+
+// blankXMP 用空格覆盖 XMP 内容（PNG iTXt 保留关键字与各字段的结束符）
+func blankXMP(data []byte) bool {
+	start := 0
+	if bytes.HasPrefix(data, pngXMPKey) {
+		// 跳过 关键字\0 压缩标志 压缩方法 语言标签\0 翻译关键字\0
+		start = len(pngXMPKey) + 2
+		for i := 0; i < 2 && start <= len(data); i++ {
+			idx := bytes.IndexByte(data[start:], 0)
+			if idx < 0 {
+				return false
+			}
+			start += idx + 1
+		}
+	}
+
+	changed := false
+	for i := start; i < len(data); i++ {
+		if data[i] != ' ' {
+			data[i] = ' '
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fixPNGCRC 重新计算 PNG 块的 CRC（覆盖块类型与数据）
+func fixPNGCRC(f File, b block) error {
+	chunk := make([]byte, 4+b.length)
+	if _, err := f.ReadAt(chunk, b.offset-4); err != nil {
+		return err
+	}
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk))
+	_, err := f.WriteAt(crc, b.crcOff)
+	return err
+}
+
+// TIFF 标签
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// TIFF 各数据类型的字节数
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// tiffIFD0 解析 TIFF 头，返回字节序与 IFD0 偏移
+func tiffIFD0(data []byte) (binary.ByteOrder, int, bool) {
+	if len(data) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, 0, false
+	}
+	return order, int(order.Uint32(data[4:])), true
+}
+
+// ifdEntries 返回 IFD 中条目的数量与起始偏移
+func ifdEntries(data []byte, order binary.ByteOrder, off int) (int, int, bool) {
+	if off < 8 || off+2 > len(data) {
+		return 0, 0, false
+	}
+	n := int(order.Uint16(data[off:]))
+	if off+2+n*12 > len(data) {
+		return 0, 0, false
+	}
+	return n, off + 2, true
+}
+
+// exifOrientation 读取 IFD0 中的 Orientation 标签
+func exifOrientation(data []byte) int {
+	order, ifd0, ok := tiffIFD0(data)
+	if !ok {
+		return 0
+	}
+	n, start, ok := ifdEntries(data, order, ifd0)
+	if !ok {
+		return 0
+	}
+	for i := 0; i < n; i++ {
+		e := data[start+i*12:]
+		if order.Uint16(e) == tagOrientation && order.Uint16(e[2:]) == 3 {
+			return int(order.Uint16(e[8:]))
+		}
+	}
+	return 0
+}
+
+// scrubGPS 清空 GPS IFD：所有条目及其引用的数据置零，条目数置为0
+func scrubGPS(data []byte) bool {
+	order, ifd0, ok := tiffIFD0(data)
+	if !ok {
+		return false
+	}
+	n, start, ok := ifdEntries(data, order, ifd0)
+	if !ok {
+		return false
+	}
+
+	gpsOff := -1
+	for i := 0; i < n; i++ {
+		e := data[start+i*12:]
+		if order.Uint16(e) == tagGPSInfo {
+			gpsOff = int(order.Uint32(e[8:]))
+			break
+		}
+	}
+	gn, gstart, ok := ifdEntries(data, order, gpsOff)
+	if !ok || gn == 0 {
+		return false
+	}
+
+	for i := 0; i < gn; i++ {
+		e := data[gstart+i*12:]
+		size := tiffTypeSize[order.Uint16(e[2:])] * int(order.Uint32(e[4:]))
+		if size > 4 {
+			valOff := int(order.Uint32(e[8:]))
+			if valOff >= 0 && size <= len(data) && valOff <= len(data)-size {
+				clear(data[valOff : valOff+size])
+			}
+		}
+	}
+	// 条目数、条目与下一个IFD偏移一并置零
+	end := min(gstart+gn*12+4, len(data))
+	clear(data[gpsOff:end])
+	return true
+}
@@ -0,0 +1,466 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// GPS 纬度、经度（度/分/秒的有理数），清除后文件中不应再出现
+var (
+	gpsLatitude  = []uint32{39, 1, 54, 1, 3000, 100}
+	gpsLongitude = []uint32{116, 1, 23, 1, 1234, 100}
+)
+
+// testXMP 带位置信息的 XMP 包
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+	`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="39,54.5N" exif:GPSLongitude="116,23.2E"/>` +
+	`</rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+// testWebP 1x1 无损 WebP（VP8L）
+const testWebP = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+// GPS IFD 及其引用的有理数在 buildEXIF 结果中的范围
+const (
+	exifGPSStart = 38
+	exifGPSEnd   = 128
+)
+
+// buildEXIF 构造 TIFF 结构的 EXIF：IFD0 含 Orientation=6 与 GPSInfo 指针，
+// GPS IFD 含纬度方向（内联）与经纬度（偏移引用）
+func buildEXIF(order binary.ByteOrder) []byte {
+	b := make([]byte, exifGPSEnd)
+	if order == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+
+	entry := func(off int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(b[off:], tag)
+		order.PutUint16(b[off+2:], typ)
+		order.PutUint32(b[off+4:], count)
+		order.PutUint32(b[off+8:], value)
+	}
+	// IFD0：8 ~ 38
+	order.PutUint16(b[8:], 2)
+	entry(10, tagOrientation, 3, 1, 0)
+	order.PutUint16(b[18:], 6)
+	entry(22, tagGPSInfo, 4, 1, exifGPSStart)
+	// GPS IFD：38 ~ 80，有理数：80 ~ 128
+	order.PutUint16(b[38:], 3)
+	entry(40, 1, 2, 2, 0)
+	copy(b[48:], "N\x00")
+	entry(52, 2, 5, 3, 80)
+	entry(64, 4, 5, 3, 104)
+	for i, v := range append(append([]uint32{}, gpsLatitude...), gpsLongitude...) {
+		order.PutUint32(b[80+i*4:], v)
+	}
+	return b
+}
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 32), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// buildJPEG 在 SOI 后插入 EXIF 与 XMP 两个 APP1 段
+func buildJPEG() []byte {
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, testImage(), nil); err != nil {
+		panic(err)
+	}
+	segment := func(payload ...[]byte) []byte {
+		data := bytes.Join(payload, nil)
+		seg := []byte{0xFF, 0xE1, 0, 0}
+		binary.BigEndian.PutUint16(seg[2:], uint16(len(data)+2))
+		return append(seg, data...)
+	}
+	out := []byte{0xFF, 0xD8}
+	out = append(out, segment(exifHeader, buildEXIF(binary.BigEndian))...)
+	out = append(out, segment(xmpHeader, []byte(testXMP))...)
+	return append(out, plain.Bytes()[2:]...)
+}
+
+// pngChunk 编码一个 PNG 块（长度、类型、数据、CRC）
+func pngChunk(typ string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// buildPNG 在 IHDR 后插入 eXIf 与 XMP（iTXt）块
+func buildPNG() []byte {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, testImage()); err != nil {
+		panic(err)
+	}
+	ihdrEnd := len(pngSignature) + 12 + 13
+	src := plain.Bytes()
+	out := append([]byte{}, src[:ihdrEnd]...)
+	out = append(out, pngChunk("eXIf", buildEXIF(binary.LittleEndian))...)
+	// 关键字\0 压缩标志 压缩方法 语言标签\0 翻译关键字\0 文本
+	out = append(out, pngChunk("iTXt", append(append([]byte{}, pngXMPKey...), append([]byte{0, 0, 0, 0}, testXMP...)...))...)
+	return append(out, src[ihdrEnd:]...)
+}
+
+// riffChunk 编码一个 RIFF 块，奇数长度补齐一个字节
+func riffChunk(fourCC string, data []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// buildWebP 将 1x1 的 VP8L 图像封装为扩展格式（VP8X），并附带 EXIF（带 JPEG 前缀）与 XMP 块
+func buildWebP() []byte {
+	simple, err := base64.StdEncoding.DecodeString(testWebP)
+	if err != nil {
+		panic(err)
+	}
+	vp8x := []byte{0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0} // EXIF、XMP 标志，画布 1x1
+	body := []byte("WEBP")
+	body = append(body, riffChunk("VP8X", vp8x)...)
+	body = append(body, simple[12:]...)
+	body = append(body, riffChunk("EXIF", append(append([]byte{}, exifHeader...), buildEXIF(binary.BigEndian)...))...)
+	body = append(body, riffChunk("XMP ", []byte(testXMP))...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// pngChunks 校验所有块的 CRC，返回 IDAT 数据与 iTXt 块
+func pngChunks(t *testing.T, data []byte) (idat, itxt []byte) {
+	t.Helper()
+	off := len(pngSignature)
+	for off+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[off:]))
+		typ := string(data[off+4 : off+8])
+		body := data[off+8 : off+8+n]
+		if crc := binary.BigEndian.Uint32(data[off+8+n:]); crc != crc32.ChecksumIEEE(data[off+4:off+8+n]) {
+			t.Errorf("png chunk %s: bad crc", typ)
+		}
+		switch typ {
+		case "IDAT":
+			idat = append(idat, body...)
+		case "iTXt":
+			itxt = body
+		}
+		off += 12 + n
+	}
+	return idat, itxt
+}
+
+// riffChunkData 返回 WebP 中指定块的数据
+func riffChunkData(data []byte, fourCC string) []byte {
+	for off := 12; off+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[off+4:]))
+		if string(data[off:off+4]) == fourCC {
+			return data[off+8 : off+8+n]
+		}
+		off += 8 + n + n%2
+	}
+	return nil
+}
+
+// rationals 将有理数按字节序编码，用于检查文件中是否仍残留坐标
+func rationals(order binary.ByteOrder, v []uint32) []byte {
+	b := make([]byte, len(v)*4)
+	for i, x := range v {
+		order.PutUint32(b[i*4:], x)
+	}
+	return b
+}
+
+// memFile 内存中的文件，读写超出文件范围时测试失败
+type memFile struct {
+	t    testing.TB
+	data []byte
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		f.t.Fatalf("read [%d, %d) out of bounds (size %d)", off, off+int64(len(p)), len(f.data))
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		f.t.Fatalf("write [%d, %d) out of bounds (size %d)", off, off+int64(len(p)), len(f.data))
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func decodePixels(t *testing.T, data []byte, decode func(io.Reader) (image.Image, error)) []color.Color {
+	t.Helper()
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var pixels []color.Color
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			pixels = append(pixels, img.At(x, y))
+		}
+	}
+	return pixels
+}
+
+func TestStripLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mime   string
+		build  func() []byte
+		decode func(io.Reader) (image.Image, error)
+		order  binary.ByteOrder
+		// pixels 返回图像数据部分，清除前后必须逐字节相同
+		pixels func(t *testing.T, data []byte) []byte
+	}{
+		{
+			name: "jpeg", mime: "image/jpeg", build: buildJPEG, decode: jpeg.Decode, order: binary.BigEndian,
+			pixels: func(t *testing.T, data []byte) []byte {
+				// 插入的两个 APP1 段之后为原图的全部段
+				return data[2+4+len(exifHeader)+exifGPSEnd+4+len(xmpHeader)+len(testXMP):]
+			},
+		},
+		{
+			name: "png", mime: "image/png", build: buildPNG, decode: png.Decode, order: binary.LittleEndian,
+			pixels: func(t *testing.T, data []byte) []byte {
+				idat, _ := pngChunks(t, data)
+				return idat
+			},
+		},
+		{
+			name: "webp", mime: "image/webp", build: buildWebP, decode: webp.Decode, order: binary.BigEndian,
+			pixels: func(t *testing.T, data []byte) []byte {
+				return riffChunkData(data, "VP8L")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.build()
+			wantPixels := decodePixels(t, orig, tt.decode)
+			if Orientation(bytes.NewReader(orig), int64(len(orig)), tt.mime) != 6 {
+				t.Fatal("fixture orientation not found")
+			}
+
+			f := &memFile{t: t, data: append([]byte{}, orig...)}
+			modified, err := StripLocation(f, int64(len(f.data)), tt.mime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !modified {
+				t.Fatal("StripLocation reported no change")
+			}
+			out := f.data
+
+			for _, v := range [][]uint32{gpsLatitude, gpsLongitude} {
+				if bytes.Contains(out, rationals(tt.order, v)) {
+					t.Errorf("gps coordinates %v still present", v)
+				}
+			}
+			for _, s := range []string{"GPSLatitude", "GPSLongitude", "39,54.5N", "xmpmeta"} {
+				if bytes.Contains(out, []byte(s)) {
+					t.Errorf("xmp text %q still present", s)
+				}
+			}
+			// GPS 以外的 EXIF 字段保留
+			if o := Orientation(bytes.NewReader(out), int64(len(out)), tt.mime); o != 6 {
+				t.Errorf("orientation = %d, want 6", o)
+			}
+			if !bytes.Equal(tt.pixels(t, out), tt.pixels(t, orig)) {
+				t.Error("image data changed")
+			}
+			gotPixels := decodePixels(t, out, tt.decode)
+			for i := range wantPixels {
+				if gotPixels[i] != wantPixels[i] {
+					t.Fatalf("pixel %d = %v, want %v", i, gotPixels[i], wantPixels[i])
+				}
+			}
+
+			// 再次处理无修改
+			if modified, err := StripLocation(f, int64(len(out)), tt.mime); err != nil || modified {
+				t.Errorf("second pass: modified = %v, err = %v", modified, err)
+			}
+		})
+	}
+}
+
+func TestStripLocationPNGKeepsXMPKeyword(t *testing.T) {
+	f := &memFile{t: t, data: buildPNG()}
+	if _, err := StripLocation(f, int64(len(f.data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	_, itxt := pngChunks(t, f.data)
+	head := append(append([]byte{}, pngXMPKey...), 0, 0, 0, 0)
+	if !bytes.HasPrefix(itxt, head) {
+		t.Fatalf("iTXt header = %q, want %q", itxt[:min(len(itxt), len(head))], head)
+	}
+	if text := itxt[len(head):]; len(bytes.Trim(text, " ")) != 0 {
+		t.Fatalf("iTXt text not blanked: %q", text)
+	}
+}
+
+func TestStripLocationWithoutMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	orig := buf.Bytes()
+	f := &memFile{t: t, data: append([]byte{}, orig...)}
+	modified, err := StripLocation(f, int64(len(orig)), "image/png")
+	if err != nil || modified {
+		t.Fatalf("modified = %v, err = %v", modified, err)
+	}
+	if !bytes.Equal(f.data, orig) {
+		t.Fatal("file changed")
+	}
+}
+
+func TestScrubGPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   func() []byte
+		want   bool
+		zeroed bool // GPS IFD 与引用的数据已置零
+	}{
+		{name: "little endian", data: func() []byte { return buildEXIF(binary.LittleEndian) }, want: true, zeroed: true},
+		{name: "big endian", data: func() []byte { return buildEXIF(binary.BigEndian) }, want: true, zeroed: true},
+		{name: "empty", data: func() []byte { return nil }},
+		{name: "short header", data: func() []byte { return []byte("II*\x00") }},
+		{name: "bad byte order", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			copy(b, "XX")
+			return b
+		}},
+		{name: "bad magic", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			b[2] = 43
+			return b
+		}},
+		{name: "ifd0 out of range", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			binary.LittleEndian.PutUint32(b[4:], 0xFFFFFFF0)
+			return b
+		}},
+		{name: "ifd0 count too large", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			binary.LittleEndian.PutUint16(b[8:], 0xFFFF)
+			return b
+		}},
+		{name: "gps pointer out of range", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			binary.LittleEndian.PutUint32(b[30:], 0xFFFFFFFF)
+			return b
+		}},
+		{name: "gps pointer into header", data: func() []byte {
+			b := buildEXIF(binary.LittleEndian)
+			binary.LittleEndian.PutUint32(b[30:], 2)
+			return b
+		}},
+		{name: "truncated gps ifd", data: func() []byte { return buildEXIF(binary.LittleEndian)[:60] }},
+		{name: "value offset out of range", data: func() []byte {
+			b := buildEXIF(binary.BigEndian)
+			binary.BigEndian.PutUint32(b[60:], 0xFFFFFFF8)
+			binary.BigEndian.PutUint32(b[56:], 0x7FFFFFFF) // count
+			return b
+		}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data()
+			orig := append([]byte{}, data...)
+			if got := scrubGPS(data); got != tt.want {
+				t.Fatalf("scrubGPS = %v, want %v", got, tt.want)
+			}
+			if !tt.want && !bytes.Equal(data, orig) {
+				t.Fatal("data changed though nothing was scrubbed")
+			}
+			if !tt.zeroed {
+				return
+			}
+			if !bytes.Equal(data[:exifGPSStart], orig[:exifGPSStart]) {
+				t.Error("IFD0 changed")
+			}
+			if len(bytes.Trim(data[exifGPSStart:exifGPSEnd], "\x00")) != 0 {
+				t.Errorf("gps data not cleared: %x", data[exifGPSStart:exifGPSEnd])
+			}
+			if o := exifOrientation(data); o != 6 {
+				t.Errorf("orientation = %d, want 6", o)
+			}
+		})
+	}
+}
+
+func TestBlankXMP(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		ok   bool
+	}{
+		{name: "plain", data: "<x/>", want: "    ", ok: true},
+		{name: "already blank", data: "   ", want: "   "},
+		{name: "png itxt", data: string(pngXMPKey) + "\x00\x00en\x00t\x00<x/>", want: string(pngXMPKey) + "\x00\x00en\x00t\x00    ", ok: true},
+		{name: "png itxt without terminators", data: string(pngXMPKey) + "\x00\x00en", want: string(pngXMPKey) + "\x00\x00en"},
+		{name: "png itxt keyword only", data: string(pngXMPKey), want: string(pngXMPKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if ok := blankXMP(data); ok != tt.ok {
+				t.Fatalf("blankXMP = %v, want %v", ok, tt.ok)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("data = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzStripLocation(f *testing.F) {
+	mimes := []string{"image/jpeg", "image/png", "image/webp"}
+	fixtures := [][]byte{buildJPEG(), buildPNG(), buildWebP()}
+	for i, data := range fixtures {
+		f.Add(uint8(i), data)
+		// 截断在元数据块内部
+		for _, n := range []int{1, 8, 12, 20, 40, 100, len(data) / 2} {
+			if n < len(data) {
+				f.Add(uint8(i), data[:n])
+			}
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, kind uint8, data []byte) {
+		mime := mimes[int(kind)%len(mimes)]
+		file := &memFile{t: t, data: append([]byte{}, data...)}
+		_, _ = StripLocation(file, int64(len(data)), mime)
+		if len(file.data) != len(data) {
+			t.Fatal("file length changed")
+		}
+		_ = Orientation(&memFile{t: t, data: data}, int64(len(data)), mime)
+	})
+}
@@ -0,0 +1,182 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册 WebP 解码器
+)
+
+// SupportedTypes 支持生成缩略图与提取元数据的图片类型
+var SupportedTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// Supported 判断是否支持生成缩略图与提取元数据
+func Supported(mime string) bool {
+	for _, t := range SupportedTypes {
+		if t == mime {
+			return true
+		}
+	}
+	return false
+}
+
+// Thumbnail 缩略图
+type Thumbnail struct {
+	Size   int // 规格：长边不超过该像素
+	Width  int
+	Height int
+	Mime   string
+	Data   []byte
+}
+
+// Result 图片处理结果，宽高为按拍摄方向校正后的显示尺寸
+type Result struct {
+	Width      int
+	Height     int
+	Thumbnails []Thumbnail
+}
+
+// Options 处理参数
+type Options struct {
+	Sizes       []int // 缩略图规格（长边像素），不大于原图长边的规格不生成
+	JPEGQuality int   // JPEG 编码质量（1~100）
+	MaxPixels   int   // 允许解码的最大像素数，防止解压炸弹
+}
+
+// Process 提取图片尺寸并生成缩略图
+// 缩略图按规格从大到小依次缩放（每次以上一张为源），再按 EXIF 方向旋转；
+// 不透明图片编码为 JPEG，带透明通道的编码为 PNG。重新编码后不含任何元数据
+func Process(r io.ReaderAt, size int64, mime string, opts Options) (*Result, error) {
+	if !Supported(mime) {
+		return nil, fmt.Errorf("unsupported image type: %s", mime)
+	}
+
+	cfg, _, err := image.DecodeConfig(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return nil, fmt.Errorf("解析图片头失败: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, errors.New("invalid image size")
+	}
+	if opts.MaxPixels > 0 && cfg.Width*cfg.Height > opts.MaxPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	orientation := Orientation(r, size, mime)
+	result := &Result{Width: cfg.Width, Height: cfg.Height}
+	if orientation >= 5 {
+		result.Width, result.Height = cfg.Height, cfg.Width
+	}
+
+	sizes := append([]int(nil), opts.Sizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	longest := max(cfg.Width, cfg.Height)
+	if len(sizes) == 0 || sizes[len(sizes)-1] >= longest {
+		return result, nil
+	}
+
+	src, _, err := image.Decode(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	opaque := isOpaque(src)
+
+	for _, s := range sizes {
+		if s <= 0 || s >= longest {
+			continue
+		}
+		scaled := scale(src, s)
+		src = scaled
+
+		oriented := orient(scaled, orientation)
+		thumb := Thumbnail{Size: s, Width: oriented.Bounds().Dx(), Height: oriented.Bounds().Dy()}
+		var buf bytes.Buffer
+		if opaque {
+			thumb.Mime = "image/jpeg"
+			err = jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: opts.JPEGQuality})
+		} else {
+			thumb.Mime = "image/png"
+			err = png.Encode(&buf, oriented)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("编码缩略图失败: %w", err)
+		}
+		thumb.Data = buf.Bytes()
+		result.Thumbnails = append(result.Thumbnails, thumb)
+	}
+
+	// 按规格从小到大返回
+	sort.Slice(result.Thumbnails, func(i, j int) bool { return result.Thumbnails[i].Size < result.Thumbnails[j].Size })
+	return result, nil
+}
+
+// scale 等比缩放到长边为 limit
+func scale(src image.Image, limit int) *image.NRGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		h = max(1, h*limit/w)
+		w = limit
+	} else {
+		w = max(1, w*limit/h)
+		h = limit
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+// orient 按 EXIF Orientation 变换图片
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转90°
+				dx, dy = h-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转90°
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// isOpaque 判断图片是否不含透明像素
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
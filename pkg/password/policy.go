@@ -0,0 +1,102 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBytes bcrypt 只使用密码的前 72 字节，超出部分会被忽略，因此直接拒绝
+const MaxBytes = 72
+
+// 未配置时的密码强度要求
+const (
+	defaultMinLength  = 8
+	defaultMinClasses = 2
+)
+
+var (
+	// ErrTooLong 密码超过 bcrypt 支持的长度
+	ErrTooLong = fmt.Errorf("password must be at most %d bytes", MaxBytes)
+	// ErrContainsUsername 密码包含用户名
+	ErrContainsUsername = errors.New("password must not contain the username")
+)
+
+// Policy 密码强度策略
+// 字符类别分为小写字母、大写字母、数字、符号四类，MinClasses 为至少包含的类别数；
+// Require* 为必须包含的类别，在 MinClasses 之外额外检查
+type Policy struct {
+	MinLength     int  // 最少字符数
+	MinClasses    int  // 至少包含的字符类别数（1-4）
+	RequireUpper  bool // 必须包含大写字母
+	RequireLower  bool // 必须包含小写字母
+	RequireDigit  bool // 必须包含数字
+	RequireSymbol bool // 必须包含符号
+}
+
+// withDefaults 未配置的项使用默认值
+func (p Policy) withDefaults() Policy {
+	if p.MinLength <= 0 {
+		p.MinLength = defaultMinLength
+	}
+	if p.MinClasses <= 0 {
+		p.MinClasses = defaultMinClasses
+	}
+	if p.MinClasses > 4 {
+		p.MinClasses = 4
+	}
+	return p
+}
+
+// Validate 校验密码是否满足策略；username 非空时不允许密码包含用户名（不区分大小写）
+func (p Policy) Validate(plain, username string) error {
+	p = p.withDefaults()
+	if len(plain) > MaxBytes {
+		return ErrTooLong
+	}
+	if utf8.RuneCountInString(plain) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsSpace(r):
+			// 空白不计入任何类别
+		default:
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return errors.New("password must contain an uppercase letter")
+	case p.RequireLower && !lower:
+		return errors.New("password must contain a lowercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+	classes := 0
+	for _, ok := range []bool{upper, lower, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("password must contain at least %d of: uppercase letters, lowercase letters, digits, symbols", p.MinClasses)
+	}
+
+	if username = strings.TrimSpace(username); username != "" && strings.Contains(strings.ToLower(plain), strings.ToLower(username)) {
+		return ErrContainsUsername
+	}
+	return nil
+}
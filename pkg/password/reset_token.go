@@ -0,0 +1,24 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewResetToken 生成随机的重置密码令牌，返回令牌明文（发给用户）与其哈希（服务端只保存哈希）
+func NewResetToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate reset token failed: %w", err)
+	}
+	token = hex.EncodeToString(b)
+	return token, HashResetToken(token), nil
+}
+
+// HashResetToken 计算重置密码令牌的哈希
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 令牌相关常量
+// 刷新令牌只保存哈希：im:auth:refresh:{sha256}，hash 字段 data 为令牌信息、used 为使用次数；
+// 轮换后旧令牌保留到过期，再次使用即视为泄露，由调用方吊销整个会话
+// 吊销列表：im:auth:revoked:jti:{jti} / im:auth:revoked:session:{sid}，过期时间不短于令牌剩余有效期
+const (
+	RefreshTokenKeyPrefix   = "im:auth:refresh:"
+	RevokedTokenKeyPrefix   = "im:auth:revoked:jti:"
+	RevokedSessionKeyPrefix = "im:auth:revoked:session:"
+)
+
+// refreshUseScript 标记刷新令牌已使用，返回 {使用次数, 令牌信息}；令牌不存在时返回 nil
+var refreshUseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local used = redis.call('HINCRBY', KEYS[1], 'used', 1)
+return {used, redis.call('HGET', KEYS[1], 'data')}
+`)
+
+// RefreshToken 刷新令牌信息
+type RefreshToken struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SaveRefreshToken 保存刷新令牌（tokenHash 为令牌的哈希），到期自动删除
+func SaveRefreshToken(tokenHash string, token *RefreshToken) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("序列化刷新令牌失败: %w", err)
+	}
+	key := RefreshTokenKeyPrefix + tokenHash
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, key, "data", data, "used", 0)
+	pipe.ExpireAt(ctx, key, token.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存刷新令牌失败: %w", err)
+	}
+	return nil
+}
+
+// UseRefreshToken 使用刷新令牌（原子地标记为已使用）
+// 令牌不存在或已过期时返回 nil；reused 为 true 表示令牌此前已被使用过
+func UseRefreshToken(tokenHash string) (token *RefreshToken, reused bool, err error) {
+	if client == nil {
+		return nil, false, fmt.Errorf("redis客户端未初始化")
+	}
+
+	res, err := refreshUseScript.Run(ctx, client, []string{RefreshTokenKeyPrefix + tokenHash}).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("使用刷新令牌失败: %w", err)
+	}
+	if len(res) != 2 {
+		return nil, false, fmt.Errorf("使用刷新令牌失败: 返回值格式错误")
+	}
+
+	used, _ := res[0].(int64)
+	data, _ := res[1].(string)
+	var t RefreshToken
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, false, fmt.Errorf("反序列化刷新令牌失败: %w", err)
+	}
+	return &t, used > 1, nil
+}
+
+// RevokeToken 吊销访问令牌，ttl 为令牌剩余有效期
+func RevokeToken(jti string, ttl time.Duration) error {
+	return setRevoked(RevokedTokenKeyPrefix+jti, ttl)
+}
+
+// RevokeSession 吊销会话（该会话签发的所有访问令牌与刷新令牌），ttl 不应短于令牌的最长有效期
+func RevokeSession(sessionID string, ttl time.Duration) error {
+	return setRevoked(RevokedSessionKeyPrefix+sessionID, ttl)
+}
+
+// IsRevoked 判断访问令牌或其所属会话是否已被吊销（为空的参数不检查）
+func IsRevoked(jti, sessionID string) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("redis客户端未初始化")
+	}
+
+	keys := make([]string, 0, 2)
+	if jti != "" {
+		keys = append(keys, RevokedTokenKeyPrefix+jti)
+	}
+	if sessionID != "" {
+		keys = append(keys, RevokedSessionKeyPrefix+sessionID)
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	n, err := client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("查询吊销列表失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// setRevoked 写入吊销记录
+func setRevoked(key string, ttl time.Duration) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	if err := client.Set(ctx, key, time.Now().Unix(), ttl).Err(); err != nil {
+		return fmt.Errorf("写入吊销列表失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 草稿相关常量
+// 每个用户一个 hash：im:draft:{userID}，字段为会话（u:{对方用户ID}），值为草稿JSON
+// 已清空的草稿同样缓存（内容为空），避免每次读取都回源数据库
+const (
+	DraftKeyPrefix = "im:draft:"        // 草稿key前缀
+	DraftTTL       = 7 * 24 * time.Hour // 草稿缓存过期时间，每次写入时续期；过期后从数据库读取
+)
+
+// Draft 会话草稿
+type Draft struct {
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PrivateDraftField 私聊草稿字段
+func PrivateDraftField(peerID uint) string {
+	return fmt.Sprintf("u:%d", peerID)
+}
+
+// SetDraft 缓存会话草稿
+func SetDraft(userID uint, field string, draft *Draft) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	data, err := json.Marshal(draft)
+	if err != nil {
+		return fmt.Errorf("序列化草稿失败: %w", err)
+	}
+	key := fmt.Sprintf("%s%d", DraftKeyPrefix, userID)
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, key, field, data)
+	pipe.Expire(ctx, key, DraftTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("缓存草稿失败: %w", err)
+	}
+	return nil
+}
+
+// GetDraft 获取缓存的会话草稿，未缓存时返回 nil
+func GetDraft(userID uint, field string) (*Draft, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := fmt.Sprintf("%s%d", DraftKeyPrefix, userID)
+	data, err := client.HGet(ctx, key, field).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取草稿失败: %w", err)
+	}
+
+	var draft Draft
+	if err := json.Unmarshal([]byte(data), &draft); err != nil {
+		return nil, fmt.Errorf("反序列化草稿失败: %w", err)
+	}
+	return &draft, nil
+}
+
+// DeleteDraft 删除缓存的会话草稿（下次读取时从数据库加载）
+func DeleteDraft(userID uint, field string) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	return client.HDel(ctx, fmt.Sprintf("%s%d", DraftKeyPrefix, userID), field).Err()
+}
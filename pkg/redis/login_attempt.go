@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 登录失败计数相关常量
+// 对象（subject）为账号 user:{userID} 或来源IP ip:{ip}：
+// im:login:fail:{subject} 失败次数（窗口内无新的失败时过期）；
+// im:login:backoff:{subject} 退避中，过期前拒绝登录；im:login:lock:{subject} 已锁定，过期前拒绝登录
+const (
+	LoginFailureKeyPrefix = "im:login:fail:"
+	LoginBackoffKeyPrefix = "im:login:backoff:"
+	LoginLockKeyPrefix    = "im:login:lock:"
+)
+
+// loginFailScript 失败次数 +1 并续期计数窗口，返回累计失败次数
+var loginFailScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return n
+`)
+
+// LoginSubjectUser 账号的登录限制对象
+func LoginSubjectUser(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// LoginSubjectIP 来源IP的登录限制对象
+func LoginSubjectIP(ip string) string {
+	return "ip:" + ip
+}
+
+// IncrLoginFailures 记录一次登录失败，返回窗口内的累计失败次数
+func IncrLoginFailures(subject string, window time.Duration) (int64, error) {
+	if client == nil {
+		return 0, fmt.Errorf("redis客户端未初始化")
+	}
+	n, err := loginFailScript.Run(ctx, client, []string{LoginFailureKeyPrefix + subject}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("记录登录失败次数失败: %w", err)
+	}
+	return n, nil
+}
+
+// SetLoginBackoff 设置退避时间，到期前拒绝登录
+func SetLoginBackoff(subject string, d time.Duration) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	return client.Set(ctx, LoginBackoffKeyPrefix+subject, time.Now().Unix(), d).Err()
+}
+
+// LockLogin 锁定登录，并清空失败计数（解锁后重新计数）
+func LockLogin(subject string, d time.Duration) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	pipe := client.TxPipeline()
+	pipe.Set(ctx, LoginLockKeyPrefix+subject, time.Now().Unix(), d)
+	pipe.Del(ctx, LoginFailureKeyPrefix+subject, LoginBackoffKeyPrefix+subject)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("锁定登录失败: %w", err)
+	}
+	return nil
+}
+
+// GetLoginBlock 查询登录限制：locked 表示已锁定，retryAfter 为剩余的锁定或退避时间（0 表示不受限制）
+func GetLoginBlock(subject string) (locked bool, retryAfter time.Duration, err error) {
+	if client == nil {
+		return false, 0, fmt.Errorf("redis客户端未初始化")
+	}
+	pipe := client.Pipeline()
+	lockTTL := pipe.PTTL(ctx, LoginLockKeyPrefix+subject)
+	backoffTTL := pipe.PTTL(ctx, LoginBackoffKeyPrefix+subject)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, fmt.Errorf("查询登录限制失败: %w", err)
+	}
+	// 不存在的key PTTL 返回负数
+	if ttl := lockTTL.Val(); ttl > 0 {
+		return true, ttl, nil
+	}
+	if ttl := backoffTTL.Val(); ttl > 0 {
+		return false, ttl, nil
+	}
+	return false, 0, nil
+}
+
+// ClearLoginFailures 清空失败计数与退避（登录成功时调用，不解除锁定）
+func ClearLoginFailures(subject string) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	return client.Del(ctx, LoginFailureKeyPrefix+subject, LoginBackoffKeyPrefix+subject).Err()
+}
+
+// UnlockLogin 解除锁定，并清空失败计数与退避
+func UnlockLogin(subject string) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	return client.Del(ctx, LoginLockKeyPrefix+subject, LoginFailureKeyPrefix+subject, LoginBackoffKeyPrefix+subject).Err()
+}
@@ -2,10 +2,13 @@ package redis
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"im-system/internal/model"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // 消息缓存相关常量
@@ -21,6 +24,9 @@ var (
 	MaxCachedConversations = 10            // 最大缓存对话数
 )
 
+// maxCacheUpdateRetries 并发修改消息缓存冲突时的最大重试次数
+const maxCacheUpdateRetries = 5
+
 // SetCacheConfig 设置缓存配置
 func SetCacheConfig(messageTTL time.Duration, maxMessages, maxConversations int) {
 	MessageCacheTTL = messageTTL
@@ -30,136 +36,242 @@ func SetCacheConfig(messageTTL time.Duration, maxMessages, maxConversations int)
 
 // CachedMessage 缓存的消息结构
 type CachedMessage struct {
-	ID         uint      `json:"id"`
-	SenderID   uint      `json:"sender_id"`
-	ReceiverID uint      `json:"receiver_id"`
-	Content    string    `json:"content"`
-	IsRead     bool      `json:"is_read"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         uint            `json:"id"`
+	SenderID   uint            `json:"sender_id"`
+	ReceiverID uint            `json:"receiver_id"`
+	Seq        uint64          `json:"seq"`
+	Content    string          `json:"content"`
+	MsgType    string          `json:"msg_type"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Status     string          `json:"status"`
+	IsRead     bool            `json:"is_read"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	RecalledAt *time.Time      `json:"recalled_at,omitempty"`
+	EditedAt   *time.Time      `json:"edited_at,omitempty"`
 }
 
 // CachedConversation 缓存的对话结构
 type CachedConversation struct {
-	UserID      uint      `json:"user_id"`
-	Username    string    `json:"username"`
-	LastMessage string    `json:"last_message"`
-	LastTime    time.Time `json:"last_time"`
-	UnreadCount int64     `json:"unread_count"`
+	UserID         uint       `json:"user_id"`
+	Username       string     `json:"username"`
+	Title          string     `json:"title,omitempty"` // 用户自定义的会话名称
+	LastMessage    string     `json:"last_message"`
+	LastTime       time.Time  `json:"last_time"`
+	UnreadCount    int64      `json:"unread_count"`
+	Pinned         bool       `json:"pinned"`
+	Muted          bool       `json:"muted"`
+	Archived       bool       `json:"archived"`
+	LastReadMsgID  uint       `json:"last_read_msg_id"`
+	LastReadSeq    uint64     `json:"last_read_seq"`
+	Draft          string     `json:"draft,omitempty"`
+	DraftUpdatedAt *time.Time `json:"draft_updated_at,omitempty"`
 }
 
-// CachePrivateMessages 缓存私聊消息
-func CachePrivateMessages(userID1, userID2 uint, messages []*model.Message) error {
-	if client == nil {
-		return fmt.Errorf("redis客户端未初始化")
-	}
-
+// privateMessagesKey 私聊消息缓存key（与双方顺序无关）
+func privateMessagesKey(userID1, userID2 uint) string {
 	// 确保userID1 < userID2，保证key的一致性
 	if userID1 > userID2 {
 		userID1, userID2 = userID2, userID1
 	}
+	return fmt.Sprintf("%s%d:%d", PrivateMessagesKeyPrefix, userID1, userID2)
+}
 
-	key := fmt.Sprintf("%s%d:%d", PrivateMessagesKeyPrefix, userID1, userID2)
-
-	// 转换为缓存格式
+// encodeCachedMessages 序列化为缓存格式
+func encodeCachedMessages(messages []*model.Message) ([]byte, error) {
 	var cachedMessages []CachedMessage
 	for _, msg := range messages {
 		cachedMessages = append(cachedMessages, CachedMessage{
 			ID:         msg.ID,
 			SenderID:   msg.SenderID,
 			ReceiverID: msg.ReceiverID,
+			Seq:        msg.Seq,
 			Content:    msg.Content,
+			MsgType:    msg.MsgType,
+			Payload:    msg.Payload,
+			Status:     msg.Status,
 			IsRead:     msg.IsRead,
 			CreatedAt:  msg.CreatedAt,
 			UpdatedAt:  msg.UpdatedAt,
+			RecalledAt: msg.RecalledAt,
+			EditedAt:   msg.EditedAt,
 		})
 	}
 
-	// 序列化并存储
 	data, err := json.Marshal(cachedMessages)
 	if err != nil {
-		return fmt.Errorf("序列化消息失败: %w", err)
-	}
-
-	err = Set(key, data, MessageCacheTTL)
-	if err != nil {
-		return fmt.Errorf("缓存私聊消息失败: %w", err)
+		return nil, fmt.Errorf("序列化消息失败: %w", err)
 	}
-
-	return nil
+	return data, nil
 }
 
-// GetCachedPrivateMessages 获取缓存的私聊消息
-func GetCachedPrivateMessages(userID1, userID2 uint) ([]*model.Message, error) {
-	if client == nil {
-		return nil, fmt.Errorf("redis客户端未初始化")
-	}
-
-	// 确保userID1 < userID2，保证key的一致性
-	if userID1 > userID2 {
-		userID1, userID2 = userID2, userID1
-	}
-
-	key := fmt.Sprintf("%s%d:%d", PrivateMessagesKeyPrefix, userID1, userID2)
-
-	// 从Redis获取数据
-	data, err := Get(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// 反序列化
+// decodeCachedMessages 从缓存格式反序列化
+func decodeCachedMessages(data []byte) ([]*model.Message, error) {
 	var cachedMessages []CachedMessage
-	err = json.Unmarshal([]byte(data), &cachedMessages)
-	if err != nil {
+	if err := json.Unmarshal(data, &cachedMessages); err != nil {
 		return nil, fmt.Errorf("反序列化消息失败: %w", err)
 	}
 
-	// 转换为模型格式
 	var messages []*model.Message
 	for _, cached := range cachedMessages {
 		messages = append(messages, &model.Message{
 			ID:         cached.ID,
 			SenderID:   cached.SenderID,
 			ReceiverID: cached.ReceiverID,
+			Seq:        cached.Seq,
 			Content:    cached.Content,
+			MsgType:    cached.MsgType,
+			Payload:    cached.Payload,
+			Status:     cached.Status,
 			IsRead:     cached.IsRead,
 			CreatedAt:  cached.CreatedAt,
 			UpdatedAt:  cached.UpdatedAt,
+			RecalledAt: cached.RecalledAt,
+			EditedAt:   cached.EditedAt,
 		})
 	}
-
 	return messages, nil
 }
 
-// AddMessageToCache 添加新消息到缓存
-func AddMessageToCache(userID1, userID2 uint, message *model.Message) error {
+// CachePrivateMessages 缓存私聊消息
+func CachePrivateMessages(userID1, userID2 uint, messages []*model.Message) error {
 	if client == nil {
 		return fmt.Errorf("redis客户端未初始化")
 	}
 
-	// 确保userID1 < userID2
-	if userID1 > userID2 {
-		userID1, userID2 = userID2, userID1
+	data, err := encodeCachedMessages(messages)
+	if err != nil {
+		return err
 	}
 
-	// 获取现有缓存
-	existingMessages, err := GetCachedPrivateMessages(userID1, userID2)
+	err = Set(privateMessagesKey(userID1, userID2), data, MessageCacheTTL)
 	if err != nil {
-		// 如果缓存不存在，创建新的
-		existingMessages = []*model.Message{}
+		return fmt.Errorf("缓存私聊消息失败: %w", err)
 	}
 
-	// 添加新消息到开头
-	existingMessages = append([]*model.Message{message}, existingMessages...)
+	return nil
+}
 
-	// 限制缓存数量
-	if len(existingMessages) > MaxCachedMessages {
-		existingMessages = existingMessages[:MaxCachedMessages]
+// GetCachedPrivateMessages 获取缓存的私聊消息
+func GetCachedPrivateMessages(userID1, userID2 uint) ([]*model.Message, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis客户端未初始化")
 	}
 
-	// 重新缓存
-	return CachePrivateMessages(userID1, userID2, existingMessages)
+	data, err := Get(privateMessagesKey(userID1, userID2))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCachedMessages([]byte(data))
+}
+
+// updateCachedPrivateMessages 以 WATCH 事务读改写私聊消息缓存，并发修改冲突时重试，缓存不存在时跳过
+// update 返回修改后的消息及是否写回，返回 nil 且写回时删除缓存
+func updateCachedPrivateMessages(userID1, userID2 uint, update func([]*model.Message) ([]*model.Message, bool)) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := privateMessagesKey(userID1, userID2)
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		messages, err := decodeCachedMessages(data)
+		if err != nil {
+			return err
+		}
+		messages, write := update(messages)
+		if !write {
+			return nil
+		}
+		if messages == nil {
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, key)
+				return nil
+			})
+			return err
+		}
+		data, err = encodeCachedMessages(messages)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, MessageCacheTTL)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxCacheUpdateRetries; i++ {
+		err := client.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			if err != nil {
+				return fmt.Errorf("更新私聊消息缓存失败: %w", err)
+			}
+			return nil
+		}
+	}
+
+	// 冲突重试仍未成功时删除缓存，下次查询从数据库回填
+	return Del(key)
+}
+
+// AddMessageToCache 添加新消息到缓存
+// 缓存需保持为会话最新的一段连续消息，缓存不存在时不单独写入新消息，等下次查询时整段回填；
+// 新消息的序号与缓存中最新一条不连续时（并发发送乱序写入或有消息未写入缓存）删除缓存
+func AddMessageToCache(userID1, userID2 uint, message *model.Message) error {
+	return updateCachedPrivateMessages(userID1, userID2, func(existing []*model.Message) ([]*model.Message, bool) {
+		if len(existing) > 0 && message.Seq != existing[0].Seq+1 {
+			return nil, true
+		}
+
+		// 添加新消息到开头
+		existing = append([]*model.Message{message}, existing...)
+
+		// 限制缓存数量
+		if len(existing) > MaxCachedMessages {
+			existing = existing[:MaxCachedMessages]
+		}
+		return existing, true
+	})
+}
+
+// UpdateCachedMessage 更新缓存中的指定消息（如编辑后的内容），缓存不存在或不包含该消息时跳过
+func UpdateCachedMessage(userID1, userID2 uint, message *model.Message) error {
+	return updateCachedPrivateMessages(userID1, userID2, func(existing []*model.Message) ([]*model.Message, bool) {
+		for i, msg := range existing {
+			if msg.ID == message.ID {
+				existing[i] = message
+				return existing, true
+			}
+		}
+		return nil, false
+	})
+}
+
+// MarkCachedMessagesRead 将缓存中 receiverID 收到的、ID 不大于 upToID 的消息标记为已读（与数据库的已读更新一致，已撤回的消息状态不变）
+// 缓存不存在或没有需要更新的消息时跳过
+func MarkCachedMessagesRead(userID1, userID2, receiverID, upToID uint) error {
+	return updateCachedPrivateMessages(userID1, userID2, func(existing []*model.Message) ([]*model.Message, bool) {
+		changed := false
+		for _, msg := range existing {
+			if msg.ReceiverID != receiverID || msg.ID > upToID || msg.IsRead {
+				continue
+			}
+			msg.IsRead = true
+			if msg.Status != "recalled" {
+				msg.Status = "read"
+			}
+			changed = true
+		}
+		return existing, changed
+	})
 }
 
 // CacheConversations 缓存对话列表
@@ -270,13 +382,7 @@ func ClearMessageCache(userID1, userID2 uint) error {
 		return fmt.Errorf("redis客户端未初始化")
 	}
 
-	// 确保userID1 < userID2
-	if userID1 > userID2 {
-		userID1, userID2 = userID2, userID1
-	}
-
-	key := fmt.Sprintf("%s%d:%d", PrivateMessagesKeyPrefix, userID1, userID2)
-	return Del(key)
+	return Del(privateMessagesKey(userID1, userID2))
 }
 
 // ClearConversationCache 清除对话缓存
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"sync"
+	"testing"
+
+	"im-system/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// useMiniredis 将包内客户端替换为连接 miniredis 的客户端
+func useMiniredis(t *testing.T) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	prev := client
+	client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		client = prev
+	})
+}
+
+func TestAddMessageToCacheConcurrent(t *testing.T) {
+	useMiniredis(t)
+	if err := CachePrivateMessages(1, 2, []*model.Message{{ID: 1, SenderID: 1, ReceiverID: 2, Seq: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发追加不会互相覆盖：要么全部按序写入，要么因乱序删除缓存，不会留下缺消息的缓存
+	var wg sync.WaitGroup
+	for seq := uint64(2); seq <= 9; seq++ {
+		wg.Add(1)
+		go func(seq uint64) {
+			defer wg.Done()
+			_ = AddMessageToCache(1, 2, &model.Message{ID: uint(seq), SenderID: 1, ReceiverID: 2, Seq: seq})
+		}(seq)
+	}
+	wg.Wait()
+
+	cached, err := GetCachedPrivateMessages(1, 2)
+	if err != nil {
+		return
+	}
+	for i := 1; i < len(cached); i++ {
+		if cached[i-1].Seq != cached[i].Seq+1 {
+			t.Fatalf("cached seqs not contiguous at %d: %d, %d", i, cached[i-1].Seq, cached[i].Seq)
+		}
+	}
+	if last := cached[len(cached)-1].Seq; last != 1 {
+		t.Fatalf("oldest cached seq = %d, want 1", last)
+	}
+}
+
+func TestAddMessageToCacheDropsOnGap(t *testing.T) {
+	useMiniredis(t)
+	if err := CachePrivateMessages(1, 2, []*model.Message{{ID: 1, SenderID: 1, ReceiverID: 2, Seq: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddMessageToCache(1, 2, &model.Message{ID: 3, SenderID: 1, ReceiverID: 2, Seq: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetCachedPrivateMessages(1, 2); err == nil {
+		t.Fatal("cache should be dropped when the new message is not contiguous")
+	}
+}
+
+func TestMarkCachedMessagesRead(t *testing.T) {
+	useMiniredis(t)
+	// 按最新在前缓存：3(2→1) 2(1→2，已撤回) 1(1→2)
+	cached := []*model.Message{
+		{ID: 3, SenderID: 2, ReceiverID: 1, Seq: 3, Status: "sent"},
+		{ID: 2, SenderID: 1, ReceiverID: 2, Seq: 2, Status: "recalled"},
+		{ID: 1, SenderID: 1, ReceiverID: 2, Seq: 1, Status: "delivered"},
+	}
+	if err := CachePrivateMessages(1, 2, cached); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MarkCachedMessagesRead(1, 2, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := GetCachedPrivateMessages(1, 2)
+	if err != nil {
+		t.Fatal("cache should be kept when marking messages as read")
+	}
+	want := map[uint]struct {
+		read   bool
+		status string
+	}{
+		3: {false, "sent"}, // 其他接收者
+		2: {true, "recalled"},
+		1: {true, "read"},
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("cached %d messages, want %d", len(messages), len(want))
+	}
+	for _, m := range messages {
+		if w := want[m.ID]; m.IsRead != w.read || m.Status != w.status {
+			t.Errorf("message %d: is_read = %v, status = %q, want %v, %q", m.ID, m.IsRead, m.Status, w.read, w.status)
+		}
+	}
+}
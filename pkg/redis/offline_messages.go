@@ -11,12 +11,17 @@ import (
 
 // OfflineMessage 离线消息结构
 type OfflineMessage struct {
-	ID         uint      `json:"id"`
-	SenderID   uint      `json:"sender_id"`
-	ReceiverID uint      `json:"receiver_id"`
-	Content    string    `json:"content"`
-	Type       string    `json:"type"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         uint            `json:"id"`
+	SenderID   uint            `json:"sender_id"`
+	ReceiverID uint            `json:"receiver_id"`
+	GroupID    uint            `json:"group_id,omitempty"` // 群聊消息的群ID，单聊为0
+	Seq        uint64          `json:"seq,omitempty"`      // 会话内序号
+	Content    string          `json:"content"`
+	MsgType    string          `json:"msg_type,omitempty"` // 消息类型（text/image/file...），为空时为文本
+	Payload    json.RawMessage `json:"payload,omitempty"`  // 非文本消息的结构化内容
+	Status     string          `json:"status,omitempty"`   // 已撤回的消息为 recalled
+	Type       string          `json:"type"`
+	CreatedAt  time.Time       `json:"created_at"`
 }
 
 // 离线消息相关常量
@@ -158,6 +163,7 @@ func BatchAddOfflineMessages(receiverID uint, messages []*OfflineMessage) error
 }
 
 // RemoveOfflineMessage 移除指定的离线消息
+// 按原始内容 LREM，保持队列中其余消息的顺序不变
 func RemoveOfflineMessage(receiverID uint, messageID uint) error {
 	if client == nil {
 		return fmt.Errorf("redis客户端未初始化")
@@ -165,31 +171,50 @@ func RemoveOfflineMessage(receiverID uint, messageID uint) error {
 
 	key := fmt.Sprintf("%s%d", OfflineMessagesKeyPrefix, receiverID)
 
-	// 获取所有离线消息
-	messages, err := GetOfflineMessages(receiverID, 100)
+	// 获取所有离线消息（队列最多保存100条）
+	results, err := client.LRange(ctx, key, 0, -1).Result()
 	if err != nil {
-		return err
+		return fmt.Errorf("获取离线消息失败: %w", err)
 	}
 
-	// 找到要删除的消息并重新构建列表
-	var newMessages []*OfflineMessage
-	for _, msg := range messages {
-		if msg.ID != messageID {
-			newMessages = append(newMessages, msg)
+	for _, result := range results {
+		var message OfflineMessage
+		if err := json.Unmarshal([]byte(result), &message); err != nil || message.ID != messageID {
+			continue
+		}
+		if err := client.LRem(ctx, key, 0, result).Err(); err != nil {
+			return fmt.Errorf("移除离线消息失败: %w", err)
 		}
 	}
 
-	// 清空原列表
-	err = client.Del(ctx, key).Err()
+	return nil
+}
+
+// UpdateOfflineMessageContent 更新离线队列中指定消息的内容（消息被编辑时调用），不存在时跳过
+func UpdateOfflineMessageContent(receiverID uint, messageID uint, content string) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := fmt.Sprintf("%s%d", OfflineMessagesKeyPrefix, receiverID)
+
+	results, err := client.LRange(ctx, key, 0, -1).Result()
 	if err != nil {
-		return fmt.Errorf("清空离线消息列表失败: %w", err)
+		return fmt.Errorf("获取离线消息失败: %w", err)
 	}
 
-	// 重新添加剩余消息
-	if len(newMessages) > 0 {
-		err = BatchAddOfflineMessages(receiverID, newMessages)
+	for i, result := range results {
+		var message OfflineMessage
+		if err := json.Unmarshal([]byte(result), &message); err != nil || message.ID != messageID {
+			continue
+		}
+		message.Content = content
+		messageData, err := json.Marshal(&message)
 		if err != nil {
-			return err
+			return fmt.Errorf("序列化离线消息失败: %w", err)
+		}
+		if err := client.LSet(ctx, key, int64(i), messageData).Err(); err != nil {
+			return fmt.Errorf("更新离线消息失败: %w", err)
 		}
 	}
 
@@ -264,3 +289,34 @@ func GetOfflineMessageStats() (map[uint]int64, error) {
 
 	return stats, nil
 }
+
+// PopOfflineMessages 取出并移除用户最新的 limit 条离线消息（原子操作）
+func PopOfflineMessages(receiverID uint, limit int) ([]*OfflineMessage, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := fmt.Sprintf("%s%d", OfflineMessagesKeyPrefix, receiverID)
+
+	// 在同一事务中读取并裁剪，避免期间新写入的消息被误删
+	var rangeCmd *redis.StringSliceCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		rangeCmd = pipe.LRange(ctx, key, 0, int64(limit-1))
+		pipe.LTrim(ctx, key, int64(limit), -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("取出离线消息失败: %w", err)
+	}
+
+	var messages []*OfflineMessage
+	for _, result := range rangeCmd.Val() {
+		var message OfflineMessage
+		if err := json.Unmarshal([]byte(result), &message); err != nil {
+			continue // 跳过无法解析的消息
+		}
+		messages = append(messages, &message)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 重置密码令牌相关常量
+// 令牌只保存哈希：im:auth:pwreset:{sha256} -> 用户ID；每个用户同时只有一个有效令牌，
+// im:auth:pwreset:user:{userID} 记录当前令牌的哈希，签发新令牌时旧令牌失效
+// im:auth:pwreset:cooldown:{userID} 存在期间不再发送重置邮件
+const (
+	PasswordResetKeyPrefix         = "im:auth:pwreset:"
+	PasswordResetUserKeyPrefix     = "im:auth:pwreset:user:"
+	PasswordResetCooldownKeyPrefix = "im:auth:pwreset:cooldown:"
+)
+
+// passwordResetSaveScript 保存新令牌并删除该用户的旧令牌
+// KEYS[1] 令牌key，KEYS[2] 用户key；ARGV[1] 用户ID，ARGV[2] 令牌哈希，ARGV[3] 有效期（毫秒），ARGV[4] 令牌key前缀
+var passwordResetSaveScript = redis.NewScript(`
+local old = redis.call('GET', KEYS[2])
+if old then
+	redis.call('DEL', ARGV[4] .. old)
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// passwordResetUseScript 取出并删除令牌（只能使用一次），返回用户ID；令牌不存在时返回 nil
+// KEYS[1] 令牌key；ARGV[1] 令牌哈希，ARGV[2] 用户key前缀
+var passwordResetUseScript = redis.NewScript(`
+local uid = redis.call('GET', KEYS[1])
+if not uid then
+	return false
+end
+redis.call('DEL', KEYS[1])
+local userKey = ARGV[2] .. uid
+if redis.call('GET', userKey) == ARGV[1] then
+	redis.call('DEL', userKey)
+end
+return uid
+`)
+
+// SavePasswordResetToken 保存重置密码令牌（tokenHash 为令牌的哈希），该用户此前的令牌失效
+func SavePasswordResetToken(userID uint, tokenHash string, ttl time.Duration) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	keys := []string{PasswordResetKeyPrefix + tokenHash, fmt.Sprintf("%s%d", PasswordResetUserKeyPrefix, userID)}
+	if err := passwordResetSaveScript.Run(ctx, client, keys, userID, tokenHash, ttl.Milliseconds(), PasswordResetKeyPrefix).Err(); err != nil {
+		return fmt.Errorf("保存重置密码令牌失败: %w", err)
+	}
+	return nil
+}
+
+// GetPasswordResetToken 查询重置密码令牌所属用户（不消耗令牌）；令牌不存在或已过期时返回0
+func GetPasswordResetToken(tokenHash string) (uint, error) {
+	if client == nil {
+		return 0, fmt.Errorf("redis客户端未初始化")
+	}
+	res, err := client.Get(ctx, PasswordResetKeyPrefix+tokenHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询重置密码令牌失败: %w", err)
+	}
+	userID, err := strconv.ParseUint(res, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("解析重置密码令牌失败: %w", err)
+	}
+	return uint(userID), nil
+}
+
+// UsePasswordResetToken 使用重置密码令牌（原子地删除），返回令牌所属用户；令牌不存在、已过期或已使用时返回0
+func UsePasswordResetToken(tokenHash string) (uint, error) {
+	if client == nil {
+		return 0, fmt.Errorf("redis客户端未初始化")
+	}
+	res, err := passwordResetUseScript.Run(ctx, client, []string{PasswordResetKeyPrefix + tokenHash}, tokenHash, PasswordResetUserKeyPrefix).Text()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("使用重置密码令牌失败: %w", err)
+	}
+	userID, err := strconv.ParseUint(res, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("解析重置密码令牌失败: %w", err)
+	}
+	return uint(userID), nil
+}
+
+// DeletePasswordResetToken 删除用户当前的重置密码令牌（密码修改后调用）
+func DeletePasswordResetToken(userID uint) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	userKey := fmt.Sprintf("%s%d", PasswordResetUserKeyPrefix, userID)
+	hash, err := client.GetDel(ctx, userKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("删除重置密码令牌失败: %w", err)
+	}
+	return client.Del(ctx, PasswordResetKeyPrefix+hash).Err()
+}
+
+// AcquirePasswordResetCooldown 占用发送重置邮件的冷却时间，返回 false 表示仍在冷却中
+func AcquirePasswordResetCooldown(userID uint, d time.Duration) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("redis客户端未初始化")
+	}
+	ok, err := client.SetNX(ctx, fmt.Sprintf("%s%d", PasswordResetCooldownKeyPrefix, userID), time.Now().Unix(), d).Result()
+	if err != nil {
+		return false, fmt.Errorf("设置重置密码冷却时间失败: %w", err)
+	}
+	return ok, nil
+}
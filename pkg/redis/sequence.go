@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 会话序号相关常量
+const (
+	SeqKeyPrefix = "im:seq:" // 会话序号key前缀：im:seq:{会话标识}，如 im:seq:private:{小ID}:{大ID} / im:seq:group:{群ID}
+)
+
+// seqSyncScript 计数小于给定值时抬高到该值（只增不减）
+var seqSyncScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) > current then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// SeqKey 根据会话标识（见 model.Message.ConversationKey）生成会话序号key
+func SeqKey(convKey string) string {
+	return SeqKeyPrefix + convKey
+}
+
+// SyncSeq 以数据库中的最大序号校正会话序号：当前计数更小时抬高到 current，避免重复分配已使用的序号
+func SyncSeq(key string, current uint64) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+	if err := seqSyncScript.Run(ctx, client, []string{key}, current).Err(); err != nil {
+		return fmt.Errorf("校正会话序号失败: %w", err)
+	}
+	return nil
+}
+
+// NextSeq 原子获取会话的下一个序号
+// key不存在时（首次使用或Redis数据丢失）先用 initFn 返回的当前最大序号初始化，避免序号回退
+func NextSeq(key string, initFn func() (uint64, error)) (uint64, error) {
+	if client == nil {
+		return 0, fmt.Errorf("redis客户端未初始化")
+	}
+
+	exists, err := client.Exists(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("检查会话序号失败: %w", err)
+	}
+	if exists == 0 {
+		current, err := initFn()
+		if err != nil {
+			return 0, fmt.Errorf("初始化会话序号失败: %w", err)
+		}
+		// SETNX 保证并发初始化时只有一个生效
+		if err := client.SetNX(ctx, key, current, 0).Err(); err != nil {
+			return 0, fmt.Errorf("初始化会话序号失败: %w", err)
+		}
+	}
+
+	seq, err := client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取会话序号失败: %w", err)
+	}
+	return uint64(seq), nil
+}
+
+// CurrentSeq 获取会话当前已分配的最大序号，计数不存在时返回0
+func CurrentSeq(key string) (uint64, error) {
+	if client == nil {
+		return 0, fmt.Errorf("redis客户端未初始化")
+	}
+	seq, err := client.Get(ctx, key).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("获取会话序号失败: %w", err)
+	}
+	return seq, nil
+}
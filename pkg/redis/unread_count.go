@@ -9,224 +9,230 @@ import (
 )
 
 // 未读消息计数相关常量
+// 每个用户一个 hash：im:unread:conv:{userID}，字段为会话（u:{对方用户ID} / g:{群ID}），值为该会话的未读数
+// 字段 "_" 标记计数已从数据库初始化；hash 不存在时（过期或Redis数据丢失）增减操作直接跳过，读取时从数据库重建
 const (
-	UnreadCountKeyPrefix = "im:unread:" // 未读消息计数key前缀
+	UnreadCountKeyPrefix = "im:unread:conv:" // 未读消息计数key前缀
+	UnreadCountTTL       = 24 * time.Hour    // 未读计数过期时间，每次写入时续期
+	unreadInitField      = "_"               // 已初始化标记字段
 )
 
-// IncrementUnreadCount 增加用户未读消息计数
-func IncrementUnreadCount(userID uint) error {
-	if client == nil {
-		return fmt.Errorf("redis客户端未初始化")
-	}
+// unreadIncrScript 已初始化时增减会话未读数，减到0及以下时删除字段
+var unreadIncrScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local n = redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+if n <= 0 then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// unreadSetScript 已初始化时设置会话未读数，为0时删除字段
+var unreadSetScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+else
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// PrivateUnreadField 私聊会话的未读计数字段
+func PrivateUnreadField(peerID uint) string {
+	return fmt.Sprintf("u:%d", peerID)
+}
 
-	key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
+// GroupUnreadField 群聊会话的未读计数字段
+func GroupUnreadField(groupID uint) string {
+	return fmt.Sprintf("g:%d", groupID)
+}
 
-	// 使用Redis INCR命令原子性增加计数
-	err := client.Incr(ctx, key).Err()
-	if err != nil {
-		return fmt.Errorf("增加未读消息计数失败: %w", err)
-	}
+func unreadKey(userID uint) string {
+	return fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
+}
 
-	// 设置TTL，避免计数无限增长（24小时过期）
-	err = client.Expire(ctx, key, 24*time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("设置未读消息计数TTL失败: %w", err)
-	}
+// IncrementUnreadCount 增加用户某个会话的未读消息计数
+func IncrementUnreadCount(userID uint, field string) error {
+	return incrUnreadCount(userID, field, 1)
+}
 
-	return nil
+// DecrementUnreadCount 减少用户某个会话的未读消息计数
+func DecrementUnreadCount(userID uint, field string) error {
+	return incrUnreadCount(userID, field, -1)
 }
 
-// DecrementUnreadCount 减少用户未读消息计数
-func DecrementUnreadCount(userID uint) error {
+func incrUnreadCount(userID uint, field string, delta int64) error {
 	if client == nil {
 		return fmt.Errorf("redis客户端未初始化")
 	}
 
-	key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-
-	// 使用Redis DECR命令原子性减少计数
-	err := client.Decr(ctx, key).Err()
+	err := unreadIncrScript.Run(ctx, client, []string{unreadKey(userID)}, field, delta, int(UnreadCountTTL/time.Second)).Err()
 	if err != nil {
-		return fmt.Errorf("减少未读消息计数失败: %w", err)
+		return fmt.Errorf("更新未读消息计数失败: %w", err)
 	}
+	return nil
+}
 
-	// 如果计数为0或负数，删除key
-	count, err := client.Get(ctx, key).Int64()
-	if err == nil && count <= 0 {
-		client.Del(ctx, key)
+// SetConversationUnreadCount 设置用户某个会话的未读消息计数（计数未初始化时跳过）
+func SetConversationUnreadCount(userID uint, field string, count int64) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
 	}
 
+	err := unreadSetScript.Run(ctx, client, []string{unreadKey(userID)}, field, count, int(UnreadCountTTL/time.Second)).Err()
+	if err != nil {
+		return fmt.Errorf("设置会话未读消息计数失败: %w", err)
+	}
 	return nil
 }
 
-// GetUnreadCount 获取用户未读消息计数
-func GetUnreadCount(userID uint) (int64, error) {
+// GetUnreadCounts 获取用户各会话的未读消息计数
+// 计数未初始化时 ok 为 false，需要从数据库重建
+func GetUnreadCounts(userID uint) (counts map[string]int64, ok bool, err error) {
 	if client == nil {
-		return 0, fmt.Errorf("redis客户端未初始化")
+		return nil, false, fmt.Errorf("redis客户端未初始化")
 	}
 
-	key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-
-	// 从Redis获取计数
-	result, err := client.Get(ctx, key).Result()
+	values, err := client.HGetAll(ctx, unreadKey(userID)).Result()
 	if err != nil {
-		// 如果key不存在，返回-1表示需要从数据库获取
-		if err.Error() == "redis: nil" {
-			return -1, nil
+		return nil, false, fmt.Errorf("获取未读消息计数失败: %w", err)
+	}
+	if _, ok := values[unreadInitField]; !ok {
+		return nil, false, nil
+	}
+
+	counts = make(map[string]int64, len(values))
+	for field, value := range values {
+		if field == unreadInitField {
+			continue
+		}
+		if count, err := strconv.ParseInt(value, 10, 64); err == nil && count > 0 {
+			counts[field] = count
 		}
-		return 0, fmt.Errorf("获取未读消息计数失败: %w", err)
 	}
+	return counts, true, nil
+}
 
-	// 转换为int64
-	count, err := strconv.ParseInt(result, 10, 64)
+// GetUnreadCount 获取用户未读消息总数（各会话之和），计数未初始化时返回-1
+func GetUnreadCount(userID uint) (int64, error) {
+	counts, ok, err := GetUnreadCounts(userID)
 	if err != nil {
-		return 0, fmt.Errorf("解析未读消息计数失败: %w", err)
+		return 0, err
+	}
+	if !ok {
+		return -1, nil
 	}
 
-	return count, nil
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
 }
 
-// SetUnreadCount 设置用户未读消息计数（用于初始化或重置）
-func SetUnreadCount(userID uint, count int64) error {
+// SetUnreadCounts 以数据库统计结果整体替换用户的未读消息计数（用于初始化或重建）
+func SetUnreadCounts(userID uint, counts map[string]int64) error {
 	if client == nil {
 		return fmt.Errorf("redis客户端未初始化")
 	}
 
-	key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
+	key := unreadKey(userID)
+	values := []interface{}{unreadInitField, 1}
+	for field, count := range counts {
+		if count > 0 {
+			values = append(values, field, count)
+		}
+	}
 
-	// 设置计数
-	err := client.Set(ctx, key, count, 24*time.Hour).Err()
-	if err != nil {
+	// 使用事务保证读取方不会看到删除后尚未写入的中间状态
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, values...)
+	pipe.Expire(ctx, key, UnreadCountTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("设置未读消息计数失败: %w", err)
 	}
-
 	return nil
 }
 
-// ResetUnreadCount 重置用户未读消息计数为0
+// ResetUnreadCount 重置用户所有会话的未读消息计数为0
 func ResetUnreadCount(userID uint) error {
-	if client == nil {
-		return fmt.Errorf("redis客户端未初始化")
-	}
-
-	key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-
-	// 删除key，相当于重置为0
-	err := client.Del(ctx, key).Err()
-	if err != nil {
-		return fmt.Errorf("重置未读消息计数失败: %w", err)
-	}
-
-	return nil
+	return SetUnreadCounts(userID, nil)
 }
 
-// BatchIncrementUnreadCount 批量增加用户未读消息计数
-func BatchIncrementUnreadCount(userIDs []uint, count int64) error {
-	if client == nil {
-		return fmt.Errorf("redis客户端未初始化")
-	}
-
-	// 使用Pipeline批量操作
-	pipe := client.Pipeline()
-
-	for _, userID := range userIDs {
-		key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-		pipe.IncrBy(ctx, key, count)
-		pipe.Expire(ctx, key, 24*time.Hour)
-	}
-
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("批量增加未读消息计数失败: %w", err)
-	}
+// BatchIncrementUnreadCount 批量增加多个用户同一会话的未读消息计数（如群聊消息扇出）
+func BatchIncrementUnreadCount(userIDs []uint, field string, count int64) error {
+	return batchIncrUnreadCount(userIDs, field, count)
+}
 
-	return nil
+// BatchDecrementUnreadCount 批量减少多个用户同一会话的未读消息计数
+func BatchDecrementUnreadCount(userIDs []uint, field string, count int64) error {
+	return batchIncrUnreadCount(userIDs, field, -count)
 }
 
-// BatchDecrementUnreadCount 批量减少用户未读消息计数
-func BatchDecrementUnreadCount(userIDs []uint, count int64) error {
+func batchIncrUnreadCount(userIDs []uint, field string, delta int64) error {
 	if client == nil {
 		return fmt.Errorf("redis客户端未初始化")
 	}
 
 	// 使用Pipeline批量操作
 	pipe := client.Pipeline()
-
 	for _, userID := range userIDs {
-		key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-		pipe.DecrBy(ctx, key, count)
+		unreadIncrScript.Eval(ctx, pipe, []string{unreadKey(userID)}, field, delta, int(UnreadCountTTL/time.Second))
 	}
-
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("批量减少未读消息计数失败: %w", err)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("批量更新未读消息计数失败: %w", err)
 	}
-
-	// 检查并删除计数为0或负数的key
-	for _, userID := range userIDs {
-		key := fmt.Sprintf("%s%d", UnreadCountKeyPrefix, userID)
-		count, err := client.Get(ctx, key).Int64()
-		if err == nil && count <= 0 {
-			client.Del(ctx, key)
-		}
-	}
-
 	return nil
 }
 
-// GetAllUnreadCounts 获取所有用户的未读消息计数（用于管理后台）
-func GetAllUnreadCounts() (map[uint]int64, error) {
+// ScanUnreadUserIDs 获取已初始化未读计数的用户ID（用于定时校正）
+func ScanUnreadUserIDs() ([]uint, error) {
 	if client == nil {
 		return nil, fmt.Errorf("redis客户端未初始化")
 	}
 
 	// 使用 SCAN 非阻塞地遍历所有未读计数 key
-	var keys []string
+	var userIDs []uint
 	var cursor uint64
 	pattern := fmt.Sprintf("%s*", UnreadCountKeyPrefix)
 	for {
-		ks, c, err := client.Scan(ctx, cursor, pattern, 1000).Result()
+		keys, c, err := client.Scan(ctx, cursor, pattern, 1000).Result()
 		if err != nil {
 			return nil, fmt.Errorf("获取未读计数key失败: %w", err)
 		}
-		keys = append(keys, ks...)
+		for _, key := range keys {
+			if userID, err := strconv.ParseUint(key[len(UnreadCountKeyPrefix):], 10, 32); err == nil {
+				userIDs = append(userIDs, uint(userID))
+			}
+		}
 		cursor = c
 		if cursor == 0 {
 			break
 		}
 	}
+	return userIDs, nil
+}
 
-	result := make(map[uint]int64)
-
-	// 批量获取所有计数
-	if len(keys) > 0 {
-		pipe := client.Pipeline()
-		cmds := make(map[string]*redis.StringCmd)
-
-		for _, key := range keys {
-			cmds[key] = pipe.Get(ctx, key)
-		}
-
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("批量获取未读计数失败: %w", err)
-		}
+// GetAllUnreadCounts 获取所有用户的未读消息总数（用于管理后台）
+func GetAllUnreadCounts() (map[uint]int64, error) {
+	userIDs, err := ScanUnreadUserIDs()
+	if err != nil {
+		return nil, err
+	}
 
-		// 解析结果
-		for key, cmd := range cmds {
-			val, err := cmd.Result()
-			if err == nil {
-				count, err := strconv.ParseInt(val, 10, 64)
-				if err == nil {
-					// 从key中提取userID
-					userIDStr := key[len(UnreadCountKeyPrefix):]
-					if userID, err := strconv.ParseUint(userIDStr, 10, 32); err == nil {
-						result[uint(userID)] = count
-					}
-				}
-			}
+	result := make(map[uint]int64, len(userIDs))
+	for _, userID := range userIDs {
+		if total, err := GetUnreadCount(userID); err == nil && total >= 0 {
+			result[userID] = total
 		}
 	}
-
 	return result, nil
 }
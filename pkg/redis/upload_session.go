@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 分片上传相关常量
+const (
+	UploadSessionKeyPrefix = "im:upload:"   // 分片上传会话key前缀
+	UploadSessionTTL       = 24 * time.Hour // 上传会话有效期，过期后需重新上传
+)
+
+// UploadSession 分片上传会话
+type UploadSession struct {
+	ID          string    `json:"id"`
+	UserID      uint      `json:"user_id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ChunkSize   int64     `json:"chunk_size"`
+	TotalChunks int       `json:"total_chunks"`
+	SHA256      string    `json:"sha256,omitempty"` // 客户端声明的文件内容哈希（小写十六进制），合并时校验
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SaveUploadSession 保存分片上传会话
+func SaveUploadSession(session *UploadSession) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("序列化上传会话失败: %w", err)
+	}
+	if err := client.Set(ctx, UploadSessionKeyPrefix+session.ID, data, UploadSessionTTL).Err(); err != nil {
+		return fmt.Errorf("保存上传会话失败: %w", err)
+	}
+	return nil
+}
+
+// GetUploadSession 获取分片上传会话
+func GetUploadSession(uploadID string) (*UploadSession, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis客户端未初始化")
+	}
+
+	data, err := client.Get(ctx, UploadSessionKeyPrefix+uploadID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取上传会话失败: %w", err)
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, fmt.Errorf("反序列化上传会话失败: %w", err)
+	}
+	return &session, nil
+}
+
+// AddUploadedChunk 记录已上传的分片
+func AddUploadedChunk(uploadID string, index int) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := UploadSessionKeyPrefix + uploadID + ":chunks"
+	pipe := client.TxPipeline()
+	pipe.SAdd(ctx, key, index)
+	pipe.Expire(ctx, key, UploadSessionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("记录已上传分片失败: %w", err)
+	}
+	return nil
+}
+
+// GetUploadedChunks 获取已上传的分片序号（升序）
+func GetUploadedChunks(uploadID string) ([]int, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis客户端未初始化")
+	}
+
+	members, err := client.SMembers(ctx, UploadSessionKeyPrefix+uploadID+":chunks").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取已上传分片失败: %w", err)
+	}
+
+	chunks := make([]int, 0, len(members))
+	for _, m := range members {
+		if index, err := strconv.Atoi(m); err == nil {
+			chunks = append(chunks, index)
+		}
+	}
+	sort.Ints(chunks)
+	return chunks, nil
+}
+
+// DeleteUploadSession 删除分片上传会话
+func DeleteUploadSession(uploadID string) error {
+	if client == nil {
+		return fmt.Errorf("redis客户端未初始化")
+	}
+
+	key := UploadSessionKeyPrefix + uploadID
+	if err := client.Del(ctx, key, key+":chunks").Err(); err != nil {
+		return fmt.Errorf("删除上传会话失败: %w", err)
+	}
+	return nil
+}
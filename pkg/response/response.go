@@ -1,7 +1,9 @@
 package response
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"im-system/internal/model"
 
@@ -16,6 +18,15 @@ type Response struct {
 	Error   string      `json:"error,omitempty"` // 错误详情（仅在开发环境显示）
 }
 
+// CodeBlocked 双方存在拉黑关系时返回的错误码
+const CodeBlocked = 4031
+
+// 登录限制错误码
+const (
+	CodeLoginThrottled = 4291 // 连续登录失败，处于退避中
+	CodeLoginLocked    = 4231 // 登录失败次数过多，账号或IP被临时锁定
+)
+
 // Success 成功响应
 func Success(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, Response{
@@ -72,6 +83,21 @@ func Forbidden(c *gin.Context, message string) {
 	Error(c, 403, message)
 }
 
+// Blocked 拉黑错误（双方存在拉黑关系，与普通403区分）
+func Blocked(c *gin.Context, message string) {
+	Error(c, CodeBlocked, message)
+}
+
+// LoginRejected 登录被限制：设置 Retry-After 响应头，data 中返回需要等待的秒数
+func LoginRejected(c *gin.Context, code int, message string, retryAfter int64) {
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	c.JSON(http.StatusOK, Response{
+		Code:    code,
+		Message: message,
+		Data:    gin.H{"retry_after": retryAfter},
+	})
+}
+
 // NotFound 404错误
 func NotFound(c *gin.Context, message string) {
 	Error(c, 404, message)
@@ -116,14 +142,25 @@ func FilterUserInfo(user *model.User) *UserInfo {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	User        *UserInfo `json:"user"`
-	AccessToken string    `json:"access_token"`
+	User         *UserInfo `json:"user"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int64     `json:"expires_in"` // 访问令牌有效期（秒）
 }
 
 // RegisterResponse 注册响应
 type RegisterResponse struct {
-	User        *UserInfo `json:"user"`
-	AccessToken string    `json:"access_token"`
+	User         *UserInfo `json:"user"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int64     `json:"expires_in"` // 访问令牌有效期（秒）
+}
+
+// TokenResponse 刷新令牌响应
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期（秒）
 }
 
 // ProfileResponse 用户资料响应
@@ -142,16 +179,20 @@ type TokenInfoResponse struct {
 
 // MessageResponse 消息响应
 type MessageResponse struct {
-	ID          uint   `json:"id"`
-	SenderID    uint   `json:"sender_id"`
-	ReceiverID  uint   `json:"receiver_id"`
-	Content     string `json:"content"`
-	MsgType     string `json:"msg_type"`
-	Status      string `json:"status"`
-	IsRead      bool   `json:"is_read"`
-	SessionType int    `json:"session_type"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ID          uint            `json:"id"`
+	SenderID    uint            `json:"sender_id"`
+	ReceiverID  uint            `json:"receiver_id"`
+	Seq         uint64          `json:"seq"`
+	Content     string          `json:"content"`
+	MsgType     string          `json:"msg_type"`
+	Payload     json.RawMessage `json:"payload,omitempty"` // 非文本消息的结构化内容
+	Status      string          `json:"status"`
+	IsRead      bool            `json:"is_read"`
+	SessionType int             `json:"session_type"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+	RecalledAt  string          `json:"recalled_at,omitempty"` // 撤回时间，未撤回时为空
+	EditedAt    string          `json:"edited_at,omitempty"`   // 最后编辑时间，未编辑时为空
 }
 
 // FilterMessageInfo 过滤消息信息
@@ -160,16 +201,25 @@ func FilterMessageInfo(message *model.Message) *MessageResponse {
 		return nil
 	}
 
-	return &MessageResponse{
+	resp := &MessageResponse{
 		ID:          message.ID,
 		SenderID:    message.SenderID,
 		ReceiverID:  message.ReceiverID,
+		Seq:         message.Seq,
 		Content:     message.Content,
 		MsgType:     message.MsgType,
+		Payload:     message.Payload,
 		Status:      message.Status,
 		IsRead:      message.IsRead,
 		SessionType: message.SessionType,
 		CreatedAt:   message.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   message.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
+	if message.RecalledAt != nil {
+		resp.RecalledAt = message.RecalledAt.Format("2006-01-02 15:04:05")
+	}
+	if message.EditedAt != nil {
+		resp.EditedAt = message.EditedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
 }
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"im-system/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Backend 文件存储后端
+// key 为存储路径（如 "ab/cd/abcd..."），由调用方保证唯一；实现需保证 Put 的原子性，不能读到写了一半的对象
+type Backend interface {
+	// Put 写入对象，已存在时覆盖
+	Put(key string, r io.Reader) error
+	// Open 打开对象用于读取，对象不存在时返回 ErrNotFound
+	Open(key string) (io.ReadSeekCloser, error)
+	// Exists 判断对象是否存在
+	Exists(key string) (bool, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(key string) error
+}
+
+// NewBackend 根据配置创建存储后端
+func NewBackend(cfg config.StorageConfig) (Backend, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalBackend(cfg.LocalDir)
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,221 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 集群路由相关常量
+const (
+	NodeKeyPrefix      = "im:node:"       // 节点注册key前缀，值为最近心跳时间，带TTL
+	RouteKeyPrefix     = "im:route:user:" // 用户路由表key前缀（hash：连接ID -> 节点ID）
+	RelayChannelPrefix = "im:relay:node:" // 节点转发通道前缀，每个节点订阅自己的通道
+	NodeTTL            = 30 * time.Second // 节点存活TTL，超时未续期视为节点下线
+	nodeHeartbeat      = NodeTTL / 3      // 节点续期间隔
+)
+
+// cluster 跨节点消息路由
+// 每个节点在Redis中注册自己，并把本节点上的连接写入用户路由表；
+// 推送消息时查路由表，对持有该用户连接的其他节点通过pub/sub转发
+
+type cluster struct {
+	rdb    *goredis.Client
+	nodeID string
+	ctx    context.Context
+	cancel context.CancelFunc
+	pubsub *goredis.PubSub
+}
+
+// relayEnvelope 跨节点转发的消息
+type relayEnvelope struct {
+	UserID       uint          `json:"user_id"`
+	ExceptConnID string        `json:"except_conn_id,omitempty"`
+	Track        bool          `json:"track,omitempty"` // 是否需要投递确认（多设备同步消息为false）
+	Payload      []byte        `json:"payload"`
+	CloseSession string        `json:"close_session,omitempty"` // 不为空时断开该登录会话的连接，不投递 Payload
+	CloseReason  string        `json:"close_reason,omitempty"`
+	Patch        *MessagePatch `json:"patch,omitempty"` // 不为空时 Payload 为撤回/编辑事件，按 Manager.SendPatchToUser 投递
+}
+
+// EnableCluster 启用跨节点路由：注册节点、订阅本节点转发通道
+// rdb 与 nodeID 由调用方传入，便于在同一进程内创建多个Manager模拟多节点
+func (m *Manager) EnableCluster(rdb *goredis.Client, nodeID string) error {
+	if rdb == nil || nodeID == "" {
+		return fmt.Errorf("启用集群路由失败: redis客户端或节点ID为空")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cluster{
+		rdb:    rdb,
+		nodeID: nodeID,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// 注册节点
+	if err := rdb.Set(ctx, NodeKeyPrefix+nodeID, time.Now().Unix(), NodeTTL).Err(); err != nil {
+		cancel()
+		return fmt.Errorf("注册节点失败: %w", err)
+	}
+
+	// 订阅本节点转发通道，等待订阅确认后再对外提供路由
+	c.pubsub = rdb.Subscribe(ctx, RelayChannelPrefix+nodeID)
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		_ = c.pubsub.Close()
+		cancel()
+		return fmt.Errorf("订阅节点转发通道失败: %w", err)
+	}
+
+	m.lock.Lock()
+	m.cluster = c
+	m.lock.Unlock()
+
+	go m.keepNodeAlive(c)
+	go m.relayLoop(c)
+
+	return nil
+}
+
+// Close 关闭跨节点路由：移除本节点的路由记录并注销节点
+func (m *Manager) Close() {
+	m.lock.Lock()
+	c := m.cluster
+	m.cluster = nil
+	var clients []*Client
+	for _, conns := range m.clients {
+		for _, client := range conns {
+			clients = append(clients, client)
+		}
+	}
+	m.lock.Unlock()
+
+	if c == nil {
+		return
+	}
+
+	for _, client := range clients {
+		c.removeRoute(client)
+	}
+	_ = c.rdb.Del(c.ctx, NodeKeyPrefix+c.nodeID).Err()
+	_ = c.pubsub.Close()
+	c.cancel()
+}
+
+// NodeID 获取当前节点ID（未启用集群时为空）
+func (m *Manager) NodeID() string {
+	if c := m.getCluster(); c != nil {
+		return c.nodeID
+	}
+	return ""
+}
+
+// getCluster 获取集群路由（未启用时为nil）
+func (m *Manager) getCluster() *cluster {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.cluster
+}
+
+// keepNodeAlive 定时续期节点注册
+func (m *Manager) keepNodeAlive(c *cluster) {
+	ticker := time.NewTicker(nodeHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			_ = c.rdb.Set(c.ctx, NodeKeyPrefix+c.nodeID, time.Now().Unix(), NodeTTL).Err()
+		}
+	}
+}
+
+// relayLoop 接收其他节点转发的消息并投递给本地连接
+func (m *Manager) relayLoop(c *cluster) {
+	for msg := range c.pubsub.Channel() {
+		var env relayEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+			continue
+		}
+		if env.CloseSession != "" {
+			m.closeLocalSession(env.UserID, env.CloseSession, env.CloseReason)
+			continue
+		}
+		if env.Patch != nil {
+			m.patchConns(env.UserID, env.Patch, env.Payload)
+			continue
+		}
+		// 转发途中用户已断开，按离线消息处理（多设备同步消息除外）
+		if m.sendToConns(env.UserID, env.ExceptConnID, env.Payload, env.Track) == 0 && env.Track {
+			go m.storeOfflineMessage(env.UserID, env.Payload)
+		}
+	}
+}
+
+// addRoute 将连接写入用户路由表
+func (c *cluster) addRoute(client *Client) {
+	_ = c.rdb.HSet(c.ctx, routeKey(client.UserID), client.ConnID, c.nodeID).Err()
+}
+
+// removeRoute 从用户路由表移除连接
+func (c *cluster) removeRoute(client *Client) {
+	_ = c.rdb.HDel(c.ctx, routeKey(client.UserID), client.ConnID).Err()
+}
+
+// remoteNodes 查询持有该用户连接的其他存活节点（排除本节点），顺带清理已下线节点的路由记录
+func (c *cluster) remoteNodes(userID uint, exceptConnID string) []string {
+	routes, err := c.rdb.HGetAll(c.ctx, routeKey(userID)).Result()
+	if err != nil {
+		return nil
+	}
+
+	alive := make(map[string]bool)
+	var nodes []string
+	for connID, nodeID := range routes {
+		if nodeID == c.nodeID || connID == exceptConnID {
+			continue
+		}
+		isAlive, checked := alive[nodeID]
+		if !checked {
+			n, err := c.rdb.Exists(c.ctx, NodeKeyPrefix+nodeID).Result()
+			isAlive = err == nil && n > 0
+			alive[nodeID] = isAlive
+			if isAlive {
+				nodes = append(nodes, nodeID)
+			}
+		}
+		if !isAlive {
+			_ = c.rdb.HDel(c.ctx, routeKey(userID), connID).Err()
+		}
+	}
+	return nodes
+}
+
+// relay 将消息转发到指定节点
+func (c *cluster) relay(nodeID string, userID uint, exceptConnID string, msg []byte, track bool) error {
+	return c.publish(nodeID, relayEnvelope{
+		UserID:       userID,
+		ExceptConnID: exceptConnID,
+		Track:        track,
+		Payload:      msg,
+	})
+}
+
+// publish 向指定节点的转发通道发布消息
+func (c *cluster) publish(nodeID string, env relayEnvelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Publish(c.ctx, RelayChannelPrefix+nodeID, data).Err()
+}
+
+// routeKey 用户路由表key
+func routeKey(userID uint) string {
+	return RouteKeyPrefix + strconv.FormatUint(uint64(userID), 10)
+}
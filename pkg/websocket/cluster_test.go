@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// newTestCluster 在同一个 miniredis 上创建两个启用集群路由的Manager，模拟两个节点
+func newTestCluster(t *testing.T) (*miniredis.Miniredis, *Manager, *Manager) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	nodes := make([]*Manager, 0, 2)
+	for _, nodeID := range []string{"node-1", "node-2"} {
+		rdb := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = rdb.Close() })
+
+		m := NewManager()
+		if err := m.EnableCluster(rdb, nodeID); err != nil {
+			t.Fatalf("EnableCluster(%s): %v", nodeID, err)
+		}
+		t.Cleanup(m.Close)
+		nodes = append(nodes, m)
+	}
+	return mr, nodes[0], nodes[1]
+}
+
+// newTestClient 创建不带真实WebSocket连接的客户端，推送的消息写入 Send
+func newTestClient(userID uint, connID, sessionID string) *Client {
+	return &Client{
+		UserID:    userID,
+		ConnID:    connID,
+		SessionID: sessionID,
+		Send:      make(chan []byte, 16),
+		window:    newDeliveryWindow(time.Minute, 1),
+		kicked:    make(chan string, 1),
+	}
+}
+
+func TestClusterRelayToRemoteNode(t *testing.T) {
+	mr, node1, node2 := newTestCluster(t)
+
+	client := newTestClient(7, "conn-a", "session-a")
+	node2.AddClient(client)
+
+	if !mr.Exists(routeKey(7)) {
+		t.Fatal("route for user 7 not registered")
+	}
+	if !node1.IsOnline(7) {
+		t.Fatal("node-1 should see user 7 online via node-2")
+	}
+
+	msg := []byte(`{"type":"chat","msg_id":42,"from":1,"content":"hi"}`)
+	node1.SendToUser(7, msg)
+
+	select {
+	case got := <-client.Send:
+		if string(got) != string(msg) {
+			t.Fatalf("relayed frame = %s, want %s", got, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not relayed to node-2")
+	}
+
+	// 跨节点转发的消息同样进入目标连接的未确认窗口
+	if !client.ack(42) {
+		t.Fatal("relayed message should be pending delivery ack on node-2")
+	}
+}
+
+func TestClusterRouteRemovedOnDisconnect(t *testing.T) {
+	mr, node1, node2 := newTestCluster(t)
+
+	client := newTestClient(7, "conn-a", "session-a")
+	node2.AddClient(client)
+
+	if offline := node2.RemoveClient(client); !offline {
+		t.Fatal("RemoveClient should report the user fully offline")
+	}
+	if mr.Exists(routeKey(7)) {
+		fields, _ := mr.HKeys(routeKey(7))
+		t.Fatalf("route not removed on disconnect: %v", fields)
+	}
+	if node1.IsOnline(7) {
+		t.Fatal("node-1 should see user 7 offline after disconnect")
+	}
+}
+
+func TestClusterCloseSessionFanOut(t *testing.T) {
+	_, node1, node2 := newTestCluster(t)
+
+	kept := newTestClient(7, "conn-a", "session-a")
+	revoked := newTestClient(7, "conn-b", "session-b")
+	node2.AddClient(kept)
+	node2.AddClient(revoked)
+
+	node1.CloseSession(7, "session-b", "logout")
+
+	select {
+	case reason := <-revoked.kicked:
+		if reason != "logout" {
+			t.Fatalf("kick reason = %q, want logout", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CloseSession was not relayed to node-2")
+	}
+	select {
+	case reason := <-kept.kicked:
+		t.Fatalf("connection of another session was kicked: %q", reason)
+	default:
+	}
+}
+
+func TestClusterRelayPatch(t *testing.T) {
+	_, node1, node2 := newTestCluster(t)
+
+	client := newTestClient(7, "conn-a", "session-a")
+	node2.AddClient(client)
+
+	node1.SendToUser(7, []byte(`{"type":"chat","msg_id":42,"from":1,"content":"hi"}`))
+	<-client.Send
+
+	event := []byte(`{"type":"edit","target_msg_id":42,"content":"hello"}`)
+	node1.SendPatchToUser(7, &MessagePatch{MsgID: 42, Content: "hello", Fields: map[string]interface{}{"edited_at": 100}}, event)
+
+	select {
+	case got := <-client.Send:
+		if string(got) != string(event) {
+			t.Fatalf("relayed event = %s, want %s", got, event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("edit event was not relayed to node-2")
+	}
+
+	client.window.lock.Lock()
+	pending := client.window.pending[42]
+	client.window.lock.Unlock()
+	if pending == nil {
+		t.Fatal("original message should stay pending after the edit event")
+	}
+	if !strings.Contains(string(pending.data), `"content":"hello"`) || !strings.Contains(string(pending.data), `"edited_at":100`) {
+		t.Fatalf("pending frame not patched: %s", pending.data)
+	}
+}
@@ -0,0 +1,285 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"im-system/pkg/redis"
+)
+
+// 投递确认相关默认值
+const (
+	DefaultAckTimeout     = 10 * time.Second // 等待客户端投递确认的超时时间
+	DefaultMaxRetransmits = 3                // 超时后的最大重传次数
+	PendingWindow         = 256              // 每个连接最多允许的未确认消息数
+)
+
+// pendingFrame 已推送但尚未收到客户端投递确认的消息
+type pendingFrame struct {
+	data    []byte
+	sentAt  time.Time
+	retries int
+	offline *redis.OfflineMessage // 来自离线队列的消息，重传失败时按原样放回队列
+}
+
+// deliveryWindow 连接级别的未确认消息窗口
+
+type deliveryWindow struct {
+	pending        map[uint]*pendingFrame // 消息ID -> 待确认消息
+	ackTimeout     time.Duration
+	maxRetransmits int
+	lock           sync.Mutex
+}
+
+// newDeliveryWindow 创建投递窗口，参数非法时使用默认值
+func newDeliveryWindow(ackTimeout time.Duration, maxRetransmits int) *deliveryWindow {
+	if ackTimeout <= 0 {
+		ackTimeout = DefaultAckTimeout
+	}
+	if maxRetransmits <= 0 {
+		maxRetransmits = DefaultMaxRetransmits
+	}
+	return &deliveryWindow{
+		pending:        make(map[uint]*pendingFrame),
+		ackTimeout:     ackTimeout,
+		maxRetransmits: maxRetransmits,
+	}
+}
+
+// deliver 推送消息到连接
+// 带 msg_id 的消息进入未确认窗口，等待客户端 ack_delivered，超时重传；窗口已满或连接已关闭时返回false
+// 不带 msg_id 的事件（好友通知、回执等）直接推送，不做确认
+func (c *Client) deliver(msgID uint, data []byte, offline *redis.OfflineMessage) bool {
+	if msgID == 0 || c.window == nil {
+		return c.trySend(data)
+	}
+
+	c.window.lock.Lock()
+	// 连接关闭后（RemoveClient 先关闭再取出未确认消息）不再进入窗口，由调用方写入离线队列
+	if c.isClosed() {
+		c.window.lock.Unlock()
+		return false
+	}
+	if _, ok := c.window.pending[msgID]; !ok && len(c.window.pending) >= PendingWindow {
+		c.window.lock.Unlock()
+		return false
+	}
+	c.window.pending[msgID] = &pendingFrame{
+		data:    data,
+		sentAt:  time.Now(),
+		offline: offline,
+	}
+	c.window.lock.Unlock()
+
+	// 发送缓冲区已满时不丢弃，由重传逻辑补发
+	c.trySend(data)
+	return true
+}
+
+// trySend 非阻塞写入发送缓冲区，连接已关闭或缓冲区已满时返回false
+func (c *Client) trySend(data []byte) bool {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// isClosed 连接是否已关闭
+func (c *Client) isClosed() bool {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	return c.closed
+}
+
+// kick 通知写协程断开连接（可重复调用，只生效一次）
+func (c *Client) kick(reason string) {
+	select {
+	case c.kicked <- reason:
+	default:
+	}
+}
+
+// close 关闭发送缓冲区（可重复调用）
+func (c *Client) close() {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// ack 处理客户端投递确认，返回该消息是否在本连接的未确认窗口中
+func (c *Client) ack(msgID uint) bool {
+	if c.window == nil {
+		return false
+	}
+	c.window.lock.Lock()
+	defer c.window.lock.Unlock()
+	if _, ok := c.window.pending[msgID]; !ok {
+		return false
+	}
+	delete(c.window.pending, msgID)
+	return true
+}
+
+// retransmit 重传超时未确认的消息，超过最大重传次数的消息移出窗口并返回（由调用方放回离线队列）
+func (c *Client) retransmit() []*pendingFrame {
+	if c.window == nil {
+		return nil
+	}
+	c.window.lock.Lock()
+	defer c.window.lock.Unlock()
+
+	var expired []*pendingFrame
+	now := time.Now()
+	for msgID, frame := range c.window.pending {
+		if now.Sub(frame.sentAt) < c.window.ackTimeout {
+			continue
+		}
+		if frame.retries >= c.window.maxRetransmits {
+			delete(c.window.pending, msgID)
+			expired = append(expired, frame)
+			continue
+		}
+		frame.retries++
+		frame.sentAt = now
+		c.trySend(frame.data)
+	}
+	return expired
+}
+
+// drainPending 取出所有未确认消息（连接关闭时调用）
+func (c *Client) drainPending() []*pendingFrame {
+	if c.window == nil {
+		return nil
+	}
+	c.window.lock.Lock()
+	defer c.window.lock.Unlock()
+
+	frames := make([]*pendingFrame, 0, len(c.window.pending))
+	for msgID, frame := range c.window.pending {
+		frames = append(frames, frame)
+		delete(c.window.pending, msgID)
+	}
+	return frames
+}
+
+// requeue 将未确认的消息放回离线队列，用户下次上线时重新推送
+func (m *Manager) requeue(userID uint, frames []*pendingFrame) {
+	for _, frame := range frames {
+		if frame.offline != nil {
+			_ = redis.AddOfflineMessage(userID, frame.offline)
+			continue
+		}
+		m.storeOfflineMessage(userID, frame.data)
+	}
+}
+
+// handoff 连接关闭但用户仍在线时处理其未确认消息
+// 实时推送的消息已发给用户的所有连接，直接丢弃；来自离线队列的消息只推送给了关闭的连接，
+// 转交给本节点上的其他连接，没有可用连接时放回离线队列
+func (m *Manager) handoff(userID uint, frames []*pendingFrame) {
+	for _, frame := range frames {
+		if frame.offline == nil {
+			continue
+		}
+		if !m.deliverToAnyConn(userID, frame) {
+			_ = redis.AddOfflineMessage(userID, frame.offline)
+		}
+	}
+}
+
+// deliverToAnyConn 将未确认消息交给用户在本节点上的任一连接，保留其离线队列记录
+func (m *Manager) deliverToAnyConn(userID uint, frame *pendingFrame) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, client := range m.clients[userID] {
+		if client.deliver(frame.offline.ID, frame.data, frame.offline) {
+			return true
+		}
+	}
+	return false
+}
+
+// MessagePatch 撤回、编辑已发送消息时对原消息的修改
+// 原消息仍在连接的未确认窗口中时按此原地更新，之后的重传或放回离线队列都使用修改后的内容
+type MessagePatch struct {
+	MsgID   uint                   `json:"msg_id"`
+	Content string                 `json:"content"`
+	Status  string                 `json:"status,omitempty"` // 撤回时为 recalled，同时清空结构化内容
+	Fields  map[string]interface{} `json:"fields,omitempty"` // 附加到原消息帧的其他字段（如 edited_at、recalled_at）
+}
+
+// apply 返回修改后的消息帧
+func (p *MessagePatch) apply(data []byte) ([]byte, error) {
+	var frame map[string]json.RawMessage
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{"content": p.Content}
+	if p.Status != "" {
+		fields["status"] = p.Status
+		delete(frame, "payload")
+	}
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	for k, v := range fields {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		frame[k] = raw
+	}
+	return json.Marshal(frame)
+}
+
+// applyOffline 返回修改后的离线消息记录（不修改原记录）
+func (p *MessagePatch) applyOffline(offline *redis.OfflineMessage) *redis.OfflineMessage {
+	patched := *offline
+	patched.Content = p.Content
+	if p.Status != "" {
+		patched.Status = p.Status
+		patched.Payload = nil
+	}
+	return &patched
+}
+
+// patch 原消息仍在本连接的未确认窗口中时按修改更新其内容，保留离线队列记录与重传状态
+func (c *Client) patch(p *MessagePatch) {
+	if c.window == nil {
+		return
+	}
+	c.window.lock.Lock()
+	defer c.window.lock.Unlock()
+	frame, ok := c.window.pending[p.MsgID]
+	if !ok {
+		return
+	}
+	if data, err := p.apply(frame.data); err == nil {
+		frame.data = data
+	}
+	if frame.offline != nil {
+		frame.offline = p.applyOffline(frame.offline)
+	}
+}
+
+// frameMsgID 解析消息中的 msg_id（没有则为0）
+func frameMsgID(data []byte) uint {
+	var frame struct {
+		MsgID uint `json:"msg_id"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return 0
+	}
+	return frame.MsgID
+}
@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"im-system/pkg/redis"
+)
+
+func TestRemoveClientHandsOffOfflineFrames(t *testing.T) {
+	m := NewManager()
+	closing := newTestClient(7, "conn-a", "session-a")
+	surviving := newTestClient(7, "conn-b", "session-b")
+	m.AddClient(closing)
+	m.AddClient(surviving)
+
+	// 从离线队列取出、只推送给了 closing 的消息
+	offline := &redis.OfflineMessage{ID: 42, SenderID: 1, ReceiverID: 7, Content: "hi"}
+	frame := []byte(`{"type":"offline_message","msg_id":42}`)
+	if !closing.deliver(42, frame, offline) {
+		t.Fatal("deliver to closing connection failed")
+	}
+	<-closing.Send
+
+	if offlineNow := m.RemoveClient(closing); offlineNow {
+		t.Fatal("user still has a connection, RemoveClient should return false")
+	}
+
+	select {
+	case got := <-surviving.Send:
+		if string(got) != string(frame) {
+			t.Fatalf("handed off frame = %s, want %s", got, frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending offline frame was not handed to the surviving connection")
+	}
+
+	surviving.window.lock.Lock()
+	pending := surviving.window.pending[42]
+	surviving.window.lock.Unlock()
+	if pending == nil || pending.offline != offline {
+		t.Fatal("handed off frame should keep its offline queue record")
+	}
+}
+
+func TestSendPatchToUserKeepsPendingOriginal(t *testing.T) {
+	m := NewManager()
+	client := newTestClient(7, "conn-a", "session-a")
+	m.AddClient(client)
+
+	offline := &redis.OfflineMessage{ID: 42, SenderID: 1, ReceiverID: 7, Content: "hi", Payload: []byte(`{"k":1}`)}
+	if !client.deliver(42, []byte(`{"type":"offline_message","msg_id":42,"content":"hi","payload":{"k":1}}`), offline) {
+		t.Fatal("deliver failed")
+	}
+	<-client.Send
+
+	event := []byte(`{"type":"recall","target_msg_id":42}`)
+	m.SendPatchToUser(7, &MessagePatch{MsgID: 42, Status: "recalled", Fields: map[string]interface{}{"recalled_at": 100}}, event)
+	if got := <-client.Send; string(got) != string(event) {
+		t.Fatalf("event = %s, want %s", got, event)
+	}
+
+	client.window.lock.Lock()
+	pending := client.window.pending[42]
+	client.window.lock.Unlock()
+	if pending == nil {
+		t.Fatal("original message should stay pending after the recall event")
+	}
+	if pending.offline == nil || pending.offline.Status != "recalled" || pending.offline.Payload != nil || pending.offline.ID != 42 {
+		t.Fatalf("offline record not patched: %+v", pending.offline)
+	}
+	var frame map[string]interface{}
+	if err := json.Unmarshal(pending.data, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame["status"] != "recalled" || frame["content"] != "" || frame["payload"] != nil || frame["msg_id"] != float64(42) {
+		t.Fatalf("pending frame not patched: %s", pending.data)
+	}
+	if offline.Content != "hi" {
+		t.Fatal("patch should not modify the original offline record in place")
+	}
+}
+
+func TestDeliverToClosedConnectionFails(t *testing.T) {
+	m := NewManager()
+	client := newTestClient(7, "conn-a", "session-a")
+	m.AddClient(client)
+	m.RemoveClient(client)
+
+	if client.deliver(42, []byte(`{"type":"chat","msg_id":42}`), nil) {
+		t.Fatal("deliver to a closed connection should fail so the caller stores the message offline")
+	}
+	if client.ack(42) {
+		t.Fatal("frame should not enter the window of a closed connection")
+	}
+}
@@ -1,8 +1,12 @@
 package websocket
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"im-system/config"
+	"im-system/internal/model"
 	"im-system/internal/repository"
 	dbPkg "im-system/pkg/db"
 	"im-system/pkg/jwt"
@@ -23,6 +27,48 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// MessageSender 消息发送接口，由业务层（MessageService）实现并在启动时注入，避免包循环依赖
+// connID 为发起发送的连接，消息会同步到发送者的其他设备
+// msgType 为空时为文本消息，非文本消息的结构化内容放在 payload 中
+type MessageSender interface {
+	SendMessageFromConn(senderID uint, connID, receiverIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error)
+	SendGroupMessageFromConn(senderID uint, connID, groupIDStr, msgType, content string, payload json.RawMessage) (*model.Message, error)
+}
+
+var messageSender MessageSender
+
+// SetMessageSender 设置WebSocket上行聊天消息的处理者
+func SetMessageSender(s MessageSender) {
+	messageSender = s
+}
+
+// ReadMarker 已读标记接口，由业务层（MessageService）实现并在启动时注入
+// 与 HTTP 接口相同：更新消息状态与未读计数，并向发送者推送已读回执
+type ReadMarker interface {
+	MarkAsRead(messageIDStr string, userID uint) error
+	MarkConversationAsRead(userID, otherUserID, upToID uint, upToSeq uint64) (*repository.ReadRange, error)
+}
+
+var readMarker ReadMarker
+
+// SetReadMarker 设置WebSocket上行已读回执的处理者
+func SetReadMarker(m ReadMarker) {
+	readMarker = m
+}
+
+// DraftSaver 草稿保存接口，由业务层（MessageService）实现并在启动时注入
+// connID 为发起保存的连接，草稿会同步到用户的其他连接
+type DraftSaver interface {
+	SaveDraftFromConn(userID uint, connID, peerIDStr, content string) (*redis.Draft, error)
+}
+
+var draftSaver DraftSaver
+
+// SetDraftSaver 设置WebSocket上行草稿的处理者
+func SetDraftSaver(d DraftSaver) {
+	draftSaver = d
+}
+
 // WsHandler Gin路由处理函数
 func WsHandler(c *gin.Context) {
 	token := c.Query("token")
@@ -34,8 +80,7 @@ func WsHandler(c *gin.Context) {
 		return
 	}
 
-	jwtCfg := c.MustGet("jwt_config").(config.JWTConfig) // 需在main.go注入
-	jwtSvc := jwt.NewJWTService(jwtCfg)
+	jwtSvc := c.MustGet("jwt_service").(*jwt.JWTService) // 需在main.go注入
 	claims, err := jwtSvc.ValidateToken(token)
 	if err != nil {
 		response.Unauthorized(c, "token无效或已过期")
@@ -58,12 +103,21 @@ func WsHandler(c *gin.Context) {
 		return
 	}
 
+	// 从上下文读取心跳与投递确认配置
+	wsCfg := c.MustGet("ws_config").(config.WebSocketConfig)
+
 	client := &Client{
-		UserID: uint(userID),
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
+		UserID:    uint(userID),
+		ConnID:    newConnID(),
+		DeviceID:  c.Query("device_id"),
+		SessionID: claims.SessionID,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		window:    newDeliveryWindow(wsCfg.AckTimeout, wsCfg.MaxRetransmits),
+		typing:    newTypingTracker(wsCfg.TypingTimeout),
+		kicked:    make(chan string, 1),
 	}
-	GetManager().AddClient(uint(userID), client)
+	GetManager().AddClient(client)
 
 	// WebSocket连接建立后，设置用户状态为 online
 	// 1. 更新数据库状态
@@ -76,10 +130,21 @@ func WsHandler(c *gin.Context) {
 	username := claims.Data["username"].(string)
 	_ = redis.SetUserPresence(uint(userID), username, "online")
 
+	// 3. 更新登录会话的最近活跃时间
+	if db := dbPkg.GetDB(); db != nil && claims.SessionID != "" {
+		_ = repository.NewUserSessionRepository(db).Touch(claims.SessionID)
+	}
+
 	defer func() {
-		GetManager().RemoveClient(uint(userID))
+		// 结束本连接的输入状态
+		client.typing.clear(client.UserID)
+
+		// 用户还有其他设备在线时保持 online
+		if !GetManager().RemoveClient(client) {
+			return
+		}
 
-		// 连接关闭后，设置用户状态为 offline
+		// 最后一个连接关闭后，设置用户状态为 offline
 		// 1. 更新数据库状态
 		if db := dbPkg.GetDB(); db != nil {
 			userRepo := repository.NewUserRepository()
@@ -90,14 +155,13 @@ func WsHandler(c *gin.Context) {
 		_ = redis.SetUserPresence(uint(userID), username, "offline")
 	}()
 
-	// 从上下文读取心跳配置
-	wsCfg := c.MustGet("ws_config").(config.WebSocketConfig)
-
-	// 启动写协程 + 定时发送ping心跳
+	// 启动写协程 + 定时发送ping心跳 + 重传未确认消息
 	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(wsCfg.PingInterval)
 		defer ticker.Stop()
+		retryTicker := time.NewTicker(client.window.ackTimeout / 2)
+		defer retryTicker.Stop()
 		for {
 			select {
 			case msg, ok := <-client.Send:
@@ -105,11 +169,25 @@ func WsHandler(c *gin.Context) {
 					return
 				}
 				_ = conn.WriteMessage(websocket.TextMessage, msg)
+			case reason := <-client.kicked:
+				// 登录会话被吊销：先发送 kicked 说明原因，再以关闭帧断开，读协程随之退出
+				if b, e := json.Marshal(map[string]interface{}{"type": "kicked", "reason": reason}); e == nil {
+					_ = conn.WriteMessage(websocket.TextMessage, b)
+				}
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(CloseSessionRevoked, reason), time.Now().Add(time.Second))
+				_ = conn.Close()
+				return
 			case <-ticker.C:
 				if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(5*time.Second)); err != nil {
 					close(done)
 					return
 				}
+			case <-retryTicker.C:
+				// 超过最大重传次数仍未确认的消息放回离线队列
+				if expired := client.retransmit(); len(expired) > 0 {
+					go GetManager().requeue(client.UserID, expired)
+				}
 			}
 		}
 	}()
@@ -117,18 +195,28 @@ func WsHandler(c *gin.Context) {
 	// 用户上线后，自动推送数据库中的未读消息
 	if db := dbPkg.GetDB(); db != nil {
 		msgRepo := repository.NewMessageRepository(db)
+		// 跳过与当前用户存在拉黑关系的发送者
+		hidden, _ := repository.NewFriendshipRepository(db).GetBlockRelatedIDs(uint(userID))
 		if unreadMessages, err := msgRepo.GetUnreadMessages(uint(userID)); err == nil {
 			for _, m := range unreadMessages {
+				if hidden[m.SenderID] {
+					continue
+				}
 				payload := map[string]interface{}{
 					"type":      "chat",
 					"from":      m.SenderID,
 					"to":        m.ReceiverID,
 					"content":   m.Content,
+					"msg_type":  m.MsgType,
 					"msg_id":    m.ID,
+					"seq":       m.Seq,
 					"timestamp": m.CreatedAt.Unix(),
 				}
+				if len(m.Payload) > 0 {
+					payload["payload"] = m.Payload
+				}
 				if b, e := json.Marshal(payload); e == nil {
-					client.Send <- b
+					client.deliver(m.ID, b, nil)
 				}
 			}
 		}
@@ -150,25 +238,27 @@ func WsHandler(c *gin.Context) {
 			if t, ok := msg["type"].(string); ok {
 				switch t {
 				case "ack_read":
-					var msgID uint64
-					switch v := msg["msg_id"].(type) {
-					case float64:
-						msgID = uint64(v)
-					case string:
-						if id, e := strconv.ParseUint(v, 10, 64); e == nil {
-							msgID = id
-						}
-					}
-					if msgID > 0 {
+					handleReadFrame(client, msg)
+				case "ack_delivered":
+					// 投递确认：只有本连接未确认窗口中的消息才更新为 delivered
+					if msgID, e := strconv.ParseUint(idString(msg["msg_id"]), 10, 32); e == nil && client.ack(uint(msgID)) {
 						if db := dbPkg.GetDB(); db != nil {
 							repo := repository.NewMessageRepository(db)
-							if m, e := repo.GetByID(uint(msgID)); e == nil {
-								if m.ReceiverID == uint(userID) {
-									_ = repo.MarkAsRead(uint(msgID))
-								}
+							if m, e := repo.GetByID(uint(msgID)); e == nil && m.SenderID != uint(userID) {
+								_ = repo.MarkAsDelivered(uint(msgID))
 							}
 						}
 					}
+				case "chat", "group_chat":
+					handleChatFrame(client, t, msg)
+				case "typing_start", "typing_stop":
+					handleTypingFrame(client, t, msg)
+				case "draft":
+					// 草稿：保存并同步到本用户的其他连接
+					if draftSaver != nil {
+						content, _ := msg["content"].(string)
+						_, _ = draftSaver.SaveDraftFromConn(client.UserID, client.ConnID, idString(msg["to"]), content)
+					}
 				case "heartbeat":
 					// 刷新用户在线状态（延长TTL）
 					_ = redis.RefreshUserPresence(uint(userID))
@@ -186,3 +276,80 @@ func WsHandler(c *gin.Context) {
 		close(done)
 	}
 }
+
+// handleChatFrame 处理客户端上行的聊天消息（chat/group_chat），复用HTTP接口相同的校验与落库逻辑
+// 处理完成后在同一连接回复 send_ack，回显客户端的 client_msg_id
+func handleChatFrame(client *Client, frameType string, msg map[string]interface{}) {
+	clientMsgID := msg["client_msg_id"]
+	content, _ := msg["content"].(string)
+	msgType, _ := msg["msg_type"].(string)
+	var payload json.RawMessage
+	if p, ok := msg["payload"]; ok && p != nil {
+		payload, _ = json.Marshal(p)
+	}
+
+	var message *model.Message
+	var err error
+	switch {
+	case messageSender == nil:
+		err = errors.New("message sending over websocket is not enabled")
+	case frameType == "group_chat":
+		message, err = messageSender.SendGroupMessageFromConn(client.UserID, client.ConnID, idString(msg["group_id"]), msgType, content, payload)
+	default:
+		message, err = messageSender.SendMessageFromConn(client.UserID, client.ConnID, idString(msg["to"]), msgType, content, payload)
+	}
+
+	ack := map[string]interface{}{
+		"type":          "send_ack",
+		"client_msg_id": clientMsgID,
+	}
+	if err != nil {
+		ack["error"] = err.Error()
+	} else {
+		ack["msg_id"] = message.ID
+		ack["timestamp"] = message.CreatedAt.Unix()
+	}
+	if b, e := json.Marshal(ack); e == nil {
+		client.trySend(b)
+	}
+}
+
+// handleReadFrame 处理客户端上行的已读回执
+// 带 msg_id 时标记单条消息；带 user_id 时批量标记与该用户的对话，可用 up_to_msg_id / up_to_seq 限定范围
+func handleReadFrame(client *Client, msg map[string]interface{}) {
+	if readMarker == nil {
+		return
+	}
+	if msgID := idString(msg["msg_id"]); msgID != "" {
+		_ = readMarker.MarkAsRead(msgID, client.UserID)
+		return
+	}
+	otherID, err := strconv.ParseUint(idString(msg["user_id"]), 10, 32)
+	if err != nil || otherID == 0 {
+		return
+	}
+	upToID, _ := strconv.ParseUint(idString(msg["up_to_msg_id"]), 10, 32)
+	upToSeq, _ := strconv.ParseUint(idString(msg["up_to_seq"]), 10, 64)
+	_, _ = readMarker.MarkConversationAsRead(client.UserID, uint(otherID), uint(upToID), upToSeq)
+}
+
+// idString 将JSON中的ID（数字或字符串）统一转换为字符串
+func idString(v interface{}) string {
+	switch id := v.(type) {
+	case float64:
+		return strconv.FormatUint(uint64(id), 10)
+	case string:
+		return id
+	default:
+		return ""
+	}
+}
+
+// newConnID 生成连接ID
+func newConnID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -10,27 +10,51 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// Client 代表一个WebSocket连接的用户
+// CloseSessionRevoked 登录会话被吊销（登出等）时关闭连接使用的关闭码
+const CloseSessionRevoked = 4001
+
+// Client 代表一个WebSocket连接
 // UserID: 用户ID
+// ConnID: 连接ID（同一用户的多个设备各自独立）
+// DeviceID: 客户端上报的设备标识，可为空
+// SessionID: 建立连接所用令牌的登录会话，会话被吊销时断开连接
 // Conn: WebSocket连接
 // Send: 发送消息的通道
+// window: 未确认消息窗口（为nil时不做投递确认）
+// typing: 正在输入等临时信号的状态
+// kicked: 登录会话被吊销时写入关闭原因，由写协程发送 kicked 后断开
 
 type Client struct {
-	UserID uint
-	Conn   *websocket.Conn
-	Send   chan []byte
+	UserID    uint
+	ConnID    string
+	DeviceID  string
+	SessionID string
+	Conn      *websocket.Conn
+	Send      chan []byte
+	window    *deliveryWindow
+	typing    *typingTracker
+	kicked    chan string
+	sendLock  sync.Mutex // 保护 Send 的关闭，避免向已关闭的通道写入
+	closed    bool
 }
 
 // Manager 管理所有在线用户的WebSocket连接
-// 支持并发安全、Redis离线消息存储
+// 每个用户可同时保持多个连接（多设备登录），按用户ID+连接ID索引
+// 支持并发安全、Redis离线消息存储；启用集群路由后可投递到其他节点上的连接
 
 type Manager struct {
-	clients map[uint]*Client // 在线用户
+	clients map[uint]map[string]*Client // 在线用户 -> 连接ID -> 连接
+	cluster *cluster                    // 跨节点路由，未启用时为nil
 	lock    sync.RWMutex
 }
 
-var manager = &Manager{
-	clients: make(map[uint]*Client),
+var manager = NewManager()
+
+// NewManager 创建WebSocket管理器
+func NewManager() *Manager {
+	return &Manager{
+		clients: make(map[uint]map[string]*Client),
+	}
 }
 
 // GetManager 获取全局WebSocket管理器
@@ -39,83 +63,230 @@ func GetManager() *Manager {
 }
 
 // AddClient 添加新连接
-func (m *Manager) AddClient(userID uint, client *Client) {
+func (m *Manager) AddClient(client *Client) {
 	m.lock.Lock()
-	defer m.lock.Unlock()
-	m.clients[userID] = client
+	conns, ok := m.clients[client.UserID]
+	if !ok {
+		conns = make(map[string]*Client)
+		m.clients[client.UserID] = conns
+	}
+	conns[client.ConnID] = client
+	c := m.cluster
+	m.lock.Unlock()
+
+	// 写入用户路由表，供其他节点查询
+	if c != nil {
+		c.addRoute(client)
+	}
 
 	// 推送Redis中的离线消息
-	go m.pushOfflineMessages(userID, client)
+	go m.pushOfflineMessages(client.UserID, client)
 }
 
-// RemoveClient 移除连接
-func (m *Manager) RemoveClient(userID uint) {
+// RemoveClient 移除连接，返回该用户是否已没有任何在线连接（包括其他节点）
+// 用户完全离线时，该连接上未确认的消息放回离线队列；
+// 用户仍在其他连接上在线时，只有从离线队列取出、仅推送给了本连接的消息需要转交或放回离线队列
+func (m *Manager) RemoveClient(client *Client) bool {
 	m.lock.Lock()
-	defer m.lock.Unlock()
-	if c, ok := m.clients[userID]; ok {
-		close(c.Send)
-		delete(m.clients, userID)
+	if conns, ok := m.clients[client.UserID]; ok {
+		if c, ok := conns[client.ConnID]; ok {
+			c.close()
+			delete(conns, client.ConnID)
+		}
+		if len(conns) == 0 {
+			delete(m.clients, client.UserID)
+		}
+	}
+	_, stillLocal := m.clients[client.UserID]
+	c := m.cluster
+	m.lock.Unlock()
+
+	if c != nil {
+		c.removeRoute(client)
+	}
+	pending := client.drainPending()
+	if stillLocal || (c != nil && len(c.remoteNodes(client.UserID, "")) > 0) {
+		go m.handoff(client.UserID, pending)
+		return false
 	}
+	go m.requeue(client.UserID, pending)
+	return true
 }
 
-// SendToUser 推送消息给指定用户
+// SendToUser 推送消息给指定用户的所有在线连接（包括其他节点上的连接）
 // 若用户不在线则存储到Redis离线消息
 func (m *Manager) SendToUser(userID uint, msg []byte) {
-	m.lock.RLock()
-	client, ok := m.clients[userID]
-	m.lock.RUnlock()
-	if ok {
-		// 在线，直接推送
-		select {
-		case client.Send <- msg:
-		default:
-			// 发送失败，可能连接已断开
-		}
-	} else {
+	delivered := m.sendToConns(userID, "", msg, true)
+	delivered += m.relayToNodes(userID, "", msg, true)
+	if delivered == 0 {
 		// 不在线，存储到Redis离线消息
 		go m.storeOfflineMessage(userID, msg)
 	}
 }
 
-// IsOnline 判断用户是否在线
-func (m *Manager) IsOnline(userID uint) bool {
+// SendToUserExcept 推送消息给指定用户除 exceptConnID 外的所有在线连接（用于多设备同步）
+// 仅做在线同步，不做投递确认，也不写入离线消息
+func (m *Manager) SendToUserExcept(userID uint, exceptConnID string, msg []byte) {
+	m.sendToConns(userID, exceptConnID, msg, false)
+	m.relayToNodes(userID, exceptConnID, msg, false)
+}
+
+// SendPatchToUser 推送撤回、编辑等修改已发送消息的事件（包括其他节点上的连接）
+// 事件不进入未确认窗口，也不写入离线消息（不在线时由调用方处理离线队列中的原消息）；
+// 原消息仍在连接的未确认窗口中时按 patch 原地更新，不会被事件替换
+func (m *Manager) SendPatchToUser(userID uint, patch *MessagePatch, event []byte) {
+	m.patchConns(userID, patch, event)
+
+	c := m.getCluster()
+	if c == nil {
+		return
+	}
+	for _, nodeID := range c.remoteNodes(userID, "") {
+		_ = c.publish(nodeID, relayEnvelope{
+			UserID:  userID,
+			Payload: event,
+			Patch:   patch,
+		})
+	}
+}
+
+// patchConns 更新用户本节点连接中未确认的原消息，并推送修改事件
+func (m *Manager) patchConns(userID uint, patch *MessagePatch, event []byte) {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
+	for _, client := range m.clients[userID] {
+		client.patch(patch)
+		client.trySend(event)
+	}
+}
+
+// CloseSession 断开用户指定登录会话的所有连接（包括其他节点上的连接），reason 作为关闭原因发给客户端
+func (m *Manager) CloseSession(userID uint, sessionID, reason string) {
+	if sessionID == "" {
+		return
+	}
+	m.closeLocalSession(userID, sessionID, reason)
+
+	c := m.getCluster()
+	if c == nil {
+		return
+	}
+	for _, nodeID := range c.remoteNodes(userID, "") {
+		_ = c.publish(nodeID, relayEnvelope{
+			UserID:       userID,
+			CloseSession: sessionID,
+			CloseReason:  reason,
+		})
+	}
+}
+
+// closeLocalSession 断开本节点上用户指定登录会话的连接
+func (m *Manager) closeLocalSession(userID uint, sessionID, reason string) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, client := range m.clients[userID] {
+		if client.SessionID == sessionID {
+			client.kick(reason)
+		}
+	}
+}
+
+// relayToNodes 将消息转发给持有该用户连接的其他节点，返回成功转发的节点数
+func (m *Manager) relayToNodes(userID uint, exceptConnID string, msg []byte, track bool) int {
+	c := m.getCluster()
+	if c == nil {
+		return 0
+	}
+	count := 0
+	for _, nodeID := range c.remoteNodes(userID, exceptConnID) {
+		if err := c.relay(nodeID, userID, exceptConnID, msg, track); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// sendToConns 向用户的在线连接推送消息，返回成功推送的连接数
+// track 为true时带 msg_id 的消息需要客户端投递确认，超时重传
+func (m *Manager) sendToConns(userID uint, exceptConnID string, msg []byte, track bool) int {
+	var msgID uint
+	if track {
+		msgID = frameMsgID(msg)
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	count := 0
+	for connID, client := range m.clients[userID] {
+		if connID == exceptConnID {
+			continue
+		}
+		if client.deliver(msgID, msg, nil) {
+			count++
+		}
+	}
+	return count
+}
+
+// IsOnline 判断用户是否在线（任一节点上有连接即为在线）
+func (m *Manager) IsOnline(userID uint) bool {
+	m.lock.RLock()
 	_, ok := m.clients[userID]
-	return ok
+	c := m.cluster
+	m.lock.RUnlock()
+	if ok {
+		return true
+	}
+	return c != nil && len(c.remoteNodes(userID, "")) > 0
 }
 
 // pushOfflineMessages 推送离线消息给用户
+// 消息从离线队列取出后进入连接的未确认窗口，未收到投递确认的消息会重新放回离线队列
 func (m *Manager) pushOfflineMessages(userID uint, client *Client) {
-	// 从Redis获取离线消息
-	offlineMessages, err := redis.GetOfflineMessages(userID, 50) // 最多推送50条
+	// 从Redis取出离线消息
+	offlineMessages, err := redis.PopOfflineMessages(userID, 50) // 最多推送50条
 	if err != nil {
 		return
 	}
 
 	// 推送离线消息
-	for _, msg := range offlineMessages {
-		msgData, err := json.Marshal(map[string]interface{}{
+	for i, msg := range offlineMessages {
+		data := map[string]interface{}{
 			"type":       "offline_message",
 			"id":         msg.ID,
+			"msg_id":     msg.ID,
 			"sender_id":  msg.SenderID,
 			"content":    msg.Content,
 			"created_at": msg.CreatedAt.Format("2006-01-02 15:04:05"),
-		})
+		}
+		if msg.GroupID > 0 {
+			data["group_id"] = msg.GroupID
+		}
+		if msg.Seq > 0 {
+			data["seq"] = msg.Seq
+		}
+		if msg.MsgType != "" {
+			data["msg_type"] = msg.MsgType
+		}
+		if len(msg.Payload) > 0 {
+			data["payload"] = msg.Payload
+		}
+		if msg.Status != "" {
+			data["status"] = msg.Status
+		}
+		msgData, err := json.Marshal(data)
 		if err != nil {
 			continue
 		}
 
-		select {
-		case client.Send <- msgData:
-		case <-time.After(5 * time.Second):
-			// 发送超时，停止推送
+		if !client.deliver(msg.ID, msgData, msg) {
+			// 窗口已满或连接繁忙，剩余消息放回离线队列
+			for _, rest := range offlineMessages[i:] {
+				_ = redis.AddOfflineMessage(userID, rest)
+			}
 			return
 		}
 	}
-
-	// 推送完成后清空离线消息
-	_ = redis.ClearOfflineMessages(userID)
 }
 
 // storeOfflineMessage 存储离线消息到Redis
@@ -127,14 +298,43 @@ func (m *Manager) storeOfflineMessage(userID uint, msgData []byte) {
 		return
 	}
 
+	// 只有聊天消息才写入离线队列，好友通知、撤回/编辑等事件可通过接口查询
+	msgType, _ := msg["type"].(string)
+	if msgType != "chat" && msgType != "group_chat" {
+		return
+	}
+	from, ok := msg["from"].(float64)
+	if !ok {
+		return
+	}
+	content, ok := msg["content"].(string)
+	if !ok {
+		return
+	}
+
 	// 构建离线消息对象
 	offlineMsg := &redis.OfflineMessage{
-		SenderID:   uint(msg["from"].(float64)),
+		SenderID:   uint(from),
 		ReceiverID: userID,
-		Content:    msg["content"].(string),
-		Type:       msg["type"].(string),
+		Content:    content,
+		Type:       msgType,
 		CreatedAt:  time.Now(),
 	}
+	if id, ok := msg["msg_id"].(float64); ok {
+		offlineMsg.ID = uint(id)
+	}
+	if groupID, ok := msg["group_id"].(float64); ok {
+		offlineMsg.GroupID = uint(groupID)
+	}
+	if seq, ok := msg["seq"].(float64); ok {
+		offlineMsg.Seq = uint64(seq)
+	}
+	if msgType, ok := msg["msg_type"].(string); ok {
+		offlineMsg.MsgType = msgType
+	}
+	if payload, ok := msg["payload"]; ok && payload != nil {
+		offlineMsg.Payload, _ = json.Marshal(payload)
+	}
 
 	// 存储到Redis
 	_ = redis.AddOfflineMessage(userID, offlineMsg)
@@ -0,0 +1,216 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 临时信号相关常量
+const (
+	maxTypingPeers      = 20              // 单个连接同时处于输入状态的对方数量上限
+	maxSignalsPerSecond = 10              // 单个连接每秒最多转发的 typing_start 数
+	signalPermissionTTL = time.Minute     // 信号权限校验结果的缓存时间
+	maxSignalPermCache  = 200             // 权限缓存条目上限，超过时清空
+	defaultTypingExpiry = 6 * time.Second // 未配置时的输入状态过期时间
+)
+
+// SignalAuthorizer 临时信号权限校验，由业务层（MessageService）实现并在启动时注入
+type SignalAuthorizer interface {
+	// CanSignal 是否允许 fromID 向 toID 发送正在输入等临时信号
+	CanSignal(fromID, toID uint) bool
+}
+
+var signalAuthorizer SignalAuthorizer
+
+// SetSignalAuthorizer 设置临时信号的权限校验者，未设置时不转发任何信号
+func SetSignalAuthorizer(a SignalAuthorizer) {
+	signalAuthorizer = a
+}
+
+// typingState 对某个用户的输入状态
+type typingState struct {
+	deadline  time.Time // 超过该时间未收到新的 typing_start 则自动结束
+	lastRelay time.Time // 上次转发 typing_start 的时间
+	timer     *time.Timer
+}
+
+// signalPermission 权限校验缓存
+type signalPermission struct {
+	allowed   bool
+	checkedAt time.Time
+}
+
+// typingTracker 单个连接的输入状态
+// typing_start 在过期时间的一半内只转发一次（对方据 expires_in 自行过期，转发间隔小于过期时间即可保持状态），
+// 超时未续期时由服务端代发 typing_stop；信号不落库、不进入离线队列，也不做投递确认
+type typingTracker struct {
+	lock        sync.Mutex
+	expiry      time.Duration
+	peers       map[uint]*typingState
+	permissions map[uint]signalPermission
+	windowStart time.Time // 限流窗口开始时间
+	windowCount int       // 窗口内已转发的信号数
+}
+
+func newTypingTracker(expiry time.Duration) *typingTracker {
+	if expiry <= 0 {
+		expiry = defaultTypingExpiry
+	}
+	return &typingTracker{
+		expiry:      expiry,
+		peers:       make(map[uint]*typingState),
+		permissions: make(map[uint]signalPermission),
+	}
+}
+
+// handleTypingFrame 处理客户端上行的 typing_start / typing_stop
+func handleTypingFrame(client *Client, frameType string, msg map[string]interface{}) {
+	toID, err := strconv.ParseUint(idString(msg["to"]), 10, 32)
+	if err != nil || toID == 0 || uint(toID) == client.UserID {
+		return
+	}
+	to := uint(toID)
+	if !client.typing.allowed(client.UserID, to) {
+		return
+	}
+
+	switch frameType {
+	case "typing_start":
+		if client.typing.start(client, to) {
+			relaySignal(client.UserID, to, "typing_start", client.typing.expiry)
+		}
+	case "typing_stop":
+		if client.typing.stop(to) {
+			relaySignal(client.UserID, to, "typing_stop", 0)
+		}
+	}
+}
+
+// allowed 校验是否允许向对方发送信号，结果缓存一段时间
+func (t *typingTracker) allowed(from, to uint) bool {
+	if signalAuthorizer == nil {
+		return false
+	}
+	t.lock.Lock()
+	perm, ok := t.permissions[to]
+	t.lock.Unlock()
+	if ok && time.Since(perm.checkedAt) < signalPermissionTTL {
+		return perm.allowed
+	}
+
+	allowed := signalAuthorizer.CanSignal(from, to)
+	t.lock.Lock()
+	if len(t.permissions) >= maxSignalPermCache {
+		t.permissions = make(map[uint]signalPermission)
+	}
+	t.permissions[to] = signalPermission{allowed: allowed, checkedAt: time.Now()}
+	t.lock.Unlock()
+	return allowed
+}
+
+// start 记录输入状态并续期，返回是否需要转发给对方
+func (t *typingTracker) start(client *Client, to uint) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	st, ok := t.peers[to]
+	if !ok {
+		if len(t.peers) >= maxTypingPeers {
+			return false
+		}
+		st = &typingState{}
+		t.peers[to] = st
+		st.timer = time.AfterFunc(t.expiry, func() { t.expire(client, to, st) })
+	}
+	st.deadline = now.Add(t.expiry)
+
+	if now.Sub(st.lastRelay) < t.expiry/2 || !t.take(now) {
+		return false
+	}
+	st.lastRelay = now
+	return true
+}
+
+// stop 结束输入状态，返回是否需要转发给对方（对方未收到过 typing_start 则不转发）
+func (t *typingTracker) stop(to uint) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	st, ok := t.peers[to]
+	if !ok {
+		return false
+	}
+	st.timer.Stop()
+	delete(t.peers, to)
+	return !st.lastRelay.IsZero()
+}
+
+// expire 输入状态到期：期间有续期则重新计时，否则代发 typing_stop
+func (t *typingTracker) expire(client *Client, to uint, st *typingState) {
+	t.lock.Lock()
+	if t.peers[to] != st {
+		t.lock.Unlock()
+		return
+	}
+	if remaining := time.Until(st.deadline); remaining > 0 {
+		st.timer = time.AfterFunc(remaining, func() { t.expire(client, to, st) })
+		t.lock.Unlock()
+		return
+	}
+	delete(t.peers, to)
+	t.lock.Unlock()
+
+	if !st.lastRelay.IsZero() {
+		relaySignal(client.UserID, to, "typing_stop", 0)
+	}
+}
+
+// clear 连接关闭时结束所有输入状态并通知对方
+func (t *typingTracker) clear(from uint) {
+	t.lock.Lock()
+	peers := make([]uint, 0, len(t.peers))
+	for to, st := range t.peers {
+		st.timer.Stop()
+		if !st.lastRelay.IsZero() {
+			peers = append(peers, to)
+		}
+	}
+	t.peers = make(map[uint]*typingState)
+	t.lock.Unlock()
+
+	for _, to := range peers {
+		relaySignal(from, to, "typing_stop", 0)
+	}
+}
+
+// take 限流：每秒最多转发 maxSignalsPerSecond 个 typing_start（调用方需持有锁）
+func (t *typingTracker) take(now time.Time) bool {
+	if now.Sub(t.windowStart) >= time.Second {
+		t.windowStart = now
+		t.windowCount = 0
+	}
+	if t.windowCount >= maxSignalsPerSecond {
+		return false
+	}
+	t.windowCount++
+	return true
+}
+
+// relaySignal 向对方的所有在线连接转发信号
+// 信号帧不带 msg_id，不进入未确认窗口；对方不在线时直接丢弃，不写入离线队列
+func relaySignal(from, to uint, frameType string, expiry time.Duration) {
+	frame := map[string]interface{}{
+		"type":      frameType,
+		"from":      from,
+		"timestamp": time.Now().Unix(),
+	}
+	if expiry > 0 {
+		frame["expires_in"] = int(expiry / time.Second)
+	}
+	if b, err := json.Marshal(frame); err == nil {
+		GetManager().SendToUserExcept(to, "", b)
+	}
+}
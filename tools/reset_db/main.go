@@ -50,7 +50,7 @@ func main() {
 	fmt.Printf("Database: %s\n", config.Database.Database)
 
 	// Confirm
-	fmt.Print("\nWARNING: This operation will CLEAR ALL DATA in tables [message, friendship, user]!\n")
+	fmt.Print("\nWARNING: This operation will CLEAR ALL DATA in tables [message, group_member, im_group, friendship, user]!\n")
 	fmt.Print("Type 'YES' to confirm: ")
 	var confirm string
 	fmt.Scanln(&confirm)
@@ -63,7 +63,7 @@ func main() {
 	_, _ = db.Exec("SET FOREIGN_KEY_CHECKS=0")
 
 	// Clear data (child tables first)
-	tables := []string{"message", "friendship", "user"}
+	tables := []string{"message", "group_member", "im_group", "friendship", "user"}
 	for _, table := range tables {
 		fmt.Printf("Clearing table %s... ", table)
 		if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {